@@ -0,0 +1,452 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// createBatchTables creates the stock batch and wastage tables
+func (db *DB) createBatchTables() error {
+	// Create stock batches table. The remaining quantities of a product's
+	// batches add up to the units physically on the shelf, including those
+	// held in carts and in orders not yet handed to the kitchen.
+	batchesTable := `
+    CREATE TABLE IF NOT EXISTS stock_batches (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        product_id INTEGER NOT NULL,
+        quantity_received INTEGER NOT NULL,
+        quantity_remaining INTEGER NOT NULL CHECK(quantity_remaining >= 0),
+        unit_cost REAL NOT NULL DEFAULT 0,
+        received_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        expires_at DATETIME,
+        goods_receipt_id INTEGER,
+        note TEXT,
+        FOREIGN KEY (product_id) REFERENCES products(id),
+        FOREIGN KEY (goods_receipt_id) REFERENCES goods_receipts(id)
+    )`
+
+	// Create wastage table
+	wastageTable := `
+    CREATE TABLE IF NOT EXISTS wastage (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        batch_id INTEGER,
+        product_id INTEGER NOT NULL,
+        quantity INTEGER NOT NULL CHECK(quantity > 0),
+        unit_cost REAL NOT NULL DEFAULT 0,
+        reason TEXT NOT NULL,
+        note TEXT,
+        actor_id INTEGER,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (batch_id) REFERENCES stock_batches(id),
+        FOREIGN KEY (product_id) REFERENCES products(id),
+        FOREIGN KEY (actor_id) REFERENCES users(id)
+    )`
+
+	for _, table := range []string{batchesTable, wastageTable} {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_stock_batches_product ON stock_batches(product_id, quantity_remaining)")
+	if err != nil {
+		return err
+	}
+
+	// Products that had stock before batches existed get one opening batch
+	// without an expiry date. Recipe products are left out, their stock
+	// follows their ingredients.
+	_, err = db.Exec(`
+		INSERT INTO stock_batches (product_id, quantity_received, quantity_remaining, note)
+		SELECT id, shelf, shelf, 'Opening balance' FROM (
+			SELECT p.id, p.stock
+			       + (SELECT COALESCE(SUM(ci.quantity), 0) FROM cart_items ci WHERE ci.product_id = p.id)
+			       + (SELECT COALESCE(SUM(oi.quantity), 0) FROM order_items oi JOIN orders o ON oi.order_id = o.id
+			          WHERE oi.product_id = p.id AND o.fulfilled_at IS NULL AND o.status IN (?, ?, ?)) AS shelf
+			FROM products p
+			WHERE p.id NOT IN (SELECT product_id FROM stock_batches)
+			  AND p.id NOT IN (SELECT product_id FROM recipe_items)
+		) WHERE shelf > 0
+	`, models.OrderStatusScheduled, models.OrderStatusPending, models.OrderStatusPreparing)
+	return err
+}
+
+// nullableTime maps an unset (zero) time to NULL
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(timeLayout)
+}
+
+// addBatch puts newly received units of a product on the shelf
+func addBatch(tx execer, productID, quantity int, unitCost float64, expiresAt time.Time, receiptID int64, note string) error {
+	if quantity <= 0 {
+		return nil
+	}
+
+	var receipt interface{}
+	if receiptID != 0 {
+		receipt = receiptID
+	}
+
+	_, err := tx.Exec(
+		`INSERT INTO stock_batches (product_id, quantity_received, quantity_remaining, unit_cost, expires_at, goods_receipt_id, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		productID, quantity, quantity, unitCost, nullableTime(expiresAt), receipt, note,
+	)
+	return err
+}
+
+// batchTake is a quantity taken from one batch
+type batchTake struct {
+	batchID  int
+	quantity int
+	unitCost float64
+}
+
+// takeFromBatches removes quantity units of a product from its batches, first
+// expiry first out, with batches that never expire used last. Units beyond
+// what the batches hold are returned as a take with no batch.
+func takeFromBatches(tx *sql.Tx, productID, quantity int) ([]batchTake, error) {
+	rows, err := tx.Query(`
+		SELECT id, quantity_remaining, unit_cost FROM stock_batches
+		WHERE product_id = ? AND quantity_remaining > 0
+		ORDER BY expires_at IS NULL, expires_at, received_at, id
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var takes []batchTake
+	for quantity > 0 && rows.Next() {
+		var take batchTake
+		var remaining int
+		if err := rows.Scan(&take.batchID, &remaining, &take.unitCost); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		take.quantity = remaining
+		if take.quantity > quantity {
+			take.quantity = quantity
+		}
+		quantity -= take.quantity
+		takes = append(takes, take)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, take := range takes {
+		_, err := tx.Exec("UPDATE stock_batches SET quantity_remaining = quantity_remaining - ? WHERE id = ?", take.quantity, take.batchID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if quantity > 0 {
+		takes = append(takes, batchTake{quantity: quantity})
+	}
+	return takes, nil
+}
+
+// logWastage records units thrown away
+func logWastage(tx execer, productID int, take batchTake, reason string, actorID int, note string) error {
+	var batch interface{}
+	if take.batchID != 0 {
+		batch = take.batchID
+	}
+
+	_, err := tx.Exec(
+		"INSERT INTO wastage (batch_id, product_id, quantity, unit_cost, reason, note, actor_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		batch, productID, take.quantity, take.unitCost, reason, note, nullableID(actorID),
+	)
+	return err
+}
+
+// changeShelfStock keeps a product's batches in step with a stock change made
+// by hand. Units added go into a batch without an expiry date, units removed
+// are taken first expiry first out, and wasted units are logged.
+func changeShelfStock(tx *sql.Tx, productID, change int, reason string, actorID int, note string) error {
+	if change > 0 {
+		return addBatch(tx, productID, change, 0, time.Time{}, 0, note)
+	}
+	if change == 0 {
+		return nil
+	}
+
+	takes, err := takeFromBatches(tx, productID, -change)
+	if err != nil {
+		return err
+	}
+
+	if reason == models.MovementWastage {
+		for _, take := range takes {
+			if err := logWastage(tx, productID, take, models.WastageOther, actorID, note); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// consumeOrderBatches takes the units of an order's products out of their
+// batches. Recipe products have no batches and are skipped, and units
+// refunded as missing were already written off by writeOffMissing.
+func consumeOrderBatches(tx *sql.Tx, orderID int) error {
+	rows, err := tx.Query(`
+		SELECT i.product_id, SUM(i.quantity - (SELECT COALESCE(SUM(quantity), 0) FROM refunds WHERE order_item_id = i.id))
+		FROM order_items i
+		WHERE i.order_id = ? AND i.product_id NOT IN (SELECT product_id FROM recipe_items)
+		GROUP BY i.product_id
+	`, orderID)
+	if err != nil {
+		return err
+	}
+
+	used := make(map[int]int)
+	for rows.Next() {
+		var productID, quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		used[productID] = quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for productID, quantity := range used {
+		if _, err := takeFromBatches(tx, productID, quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOffMissing takes units found missing from an order that was not
+// fulfilled yet out of the product's batches and logs them as wastage.
+// Otherwise the batches would keep holding units that no longer exist.
+func writeOffMissing(tx *sql.Tx, productID, quantity, actorID int, note string) error {
+	var hasRecipe bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM recipe_items WHERE product_id = ?)", productID).Scan(&hasRecipe)
+	if err != nil || hasRecipe {
+		return err
+	}
+
+	takes, err := takeFromBatches(tx, productID, quantity)
+	if err != nil {
+		return err
+	}
+	for _, take := range takes {
+		if err := logWastage(tx, productID, take, models.WastageOther, actorID, note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BATCH RELATED METHODS
+
+// batchColumns is the column list scanned by scanBatch
+const batchColumns = `b.id, b.product_id, p.name, b.quantity_received, b.quantity_remaining, b.unit_cost,
+	b.received_at, b.expires_at, COALESCE(b.note, '')`
+
+// scanBatch scans a row selected with batchColumns
+func scanBatch(row rowScanner) (models.StockBatch, error) {
+	var batch models.StockBatch
+	var expiresAt sql.NullTime
+	err := row.Scan(&batch.ID, &batch.ProductID, &batch.ProductName, &batch.QuantityReceived, &batch.QuantityRemaining,
+		&batch.UnitCost, &batch.ReceivedAt, &expiresAt, &batch.Note)
+	if expiresAt.Valid {
+		batch.ExpiresAt = expiresAt.Time
+	}
+	return batch, err
+}
+
+// queryBatches runs a batch query and scans the results
+func (db *DB) queryBatches(query string, args ...interface{}) ([]models.StockBatch, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batches []models.StockBatch
+	for rows.Next() {
+		batch, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch)
+	}
+
+	return batches, rows.Err()
+}
+
+// GetProductBatches retrieves a product's batches that still hold units, in
+// the order they will be consumed
+func (db *DB) GetProductBatches(productID int) ([]models.StockBatch, error) {
+	return db.queryBatches(`
+		SELECT `+batchColumns+` FROM stock_batches b JOIN products p ON b.product_id = p.id
+		WHERE b.product_id = ? AND b.quantity_remaining > 0
+		ORDER BY b.expires_at IS NULL, b.expires_at, b.received_at, b.id
+	`, productID)
+}
+
+// GetExpiringBatches retrieves batches of products on the menu that still
+// hold units and expire before the given time, soonest first. Batches that
+// have already expired are included.
+func (db *DB) GetExpiringBatches(before time.Time) ([]models.StockBatch, error) {
+	return db.queryBatches(`
+		SELECT `+batchColumns+` FROM stock_batches b JOIN products p ON b.product_id = p.id
+		WHERE b.quantity_remaining > 0 AND b.expires_at IS NOT NULL AND b.expires_at < ?
+		  AND p.archived_at IS NULL
+		ORDER BY b.expires_at, b.id
+	`, before.UTC().Format(timeLayout))
+}
+
+// ReceiveStock puts a restock of a product on the shelf as a new batch,
+// recording the movement in the ledger. expiresAt may be zero for units that
+// do not expire.
+func (db *DB) ReceiveStock(productID, quantity int, unitCost float64, expiresAt time.Time, actorID int, note string) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasRecipe bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM recipe_items WHERE product_id = ?)", productID).Scan(&hasRecipe)
+	if err != nil {
+		return err
+	}
+	if hasRecipe {
+		return models.ErrRecipeStock
+	}
+
+	if err := changeStock(tx, productID, quantity, models.MovementRestock, actorID, note); err != nil {
+		return err
+	}
+
+	if err := addBatch(tx, productID, quantity, unitCost, expiresAt, 0, note); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// WasteBatch records units of a batch thrown away. It fails with
+// ErrInsufficientStock if the batch holds fewer units, or if they are not on
+// sale because they are held in carts.
+func (db *DB) WasteBatch(batchID, quantity int, reason string, actorID int, note string) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var productID, remaining, stock int
+	var unitCost float64
+	err = tx.QueryRow(`
+		SELECT b.product_id, b.quantity_remaining, b.unit_cost, p.stock
+		FROM stock_batches b JOIN products p ON b.product_id = p.id
+		WHERE b.id = ?
+	`, batchID).Scan(&productID, &remaining, &unitCost, &stock)
+	if err != nil {
+		return err
+	}
+
+	if quantity > remaining || quantity > stock {
+		return models.ErrInsufficientStock
+	}
+
+	_, err = tx.Exec("UPDATE stock_batches SET quantity_remaining = quantity_remaining - ? WHERE id = ?", quantity, batchID)
+	if err != nil {
+		return err
+	}
+
+	ledgerNote := fmt.Sprintf("Batch #%d %s", batchID, reason)
+	if note != "" {
+		ledgerNote += ": " + note
+	}
+	if err := changeStock(tx, productID, -quantity, models.MovementWastage, actorID, ledgerNote); err != nil {
+		return err
+	}
+
+	take := batchTake{batchID: batchID, quantity: quantity, unitCost: unitCost}
+	if err := logWastage(tx, productID, take, reason, actorID, note); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// WASTAGE RELATED METHODS
+
+// GetWastage retrieves the wastage recorded between from and to, newest first
+func (db *DB) GetWastage(from, to time.Time) ([]models.WastageEntry, error) {
+	rows, err := db.Query(`
+		SELECT w.id, COALESCE(w.batch_id, 0), w.product_id, p.name, w.quantity, w.unit_cost, w.reason,
+		       COALESCE(w.note, ''), COALESCE(u.username, ''), w.created_at
+		FROM wastage w
+		JOIN products p ON w.product_id = p.id
+		LEFT JOIN users u ON w.actor_id = u.id
+		WHERE w.created_at >= ? AND w.created_at < ?
+		ORDER BY w.created_at DESC, w.id DESC
+	`, from.UTC().Format(timeLayout), to.UTC().Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.WastageEntry
+	for rows.Next() {
+		var entry models.WastageEntry
+		err := rows.Scan(&entry.ID, &entry.BatchID, &entry.ProductID, &entry.ProductName, &entry.Quantity,
+			&entry.UnitCost, &entry.Reason, &entry.Note, &entry.ActorName, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetWastageReport totals the wastage recorded between from and to by
+// product and reason, costliest first
+func (db *DB) GetWastageReport(from, to time.Time) ([]models.WastageLine, error) {
+	rows, err := db.Query(`
+		SELECT w.product_id, p.name, w.reason, SUM(w.quantity), SUM(w.quantity * w.unit_cost) AS cost
+		FROM wastage w
+		JOIN products p ON w.product_id = p.id
+		WHERE w.created_at >= ? AND w.created_at < ?
+		GROUP BY w.product_id, p.name, w.reason
+		ORDER BY cost DESC, p.name
+	`, from.UTC().Format(timeLayout), to.UTC().Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []models.WastageLine
+	for rows.Next() {
+		var line models.WastageLine
+		if err := rows.Scan(&line.ProductID, &line.ProductName, &line.Reason, &line.Quantity, &line.Cost); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
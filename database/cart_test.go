@@ -0,0 +1,638 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// cartLine is a row of cart_items as the tests see it
+type cartLine struct {
+	id, userID, productID, variantID, quantity int
+}
+
+// allCartLines returns every line of every cart, oldest first
+func allCartLines(t *testing.T, db *DB) []cartLine {
+	t.Helper()
+
+	rows, err := db.Query(`
+		SELECT ci.id, c.user_id, ci.product_id, COALESCE(ci.variant_id, 0), ci.quantity
+		FROM cart_items ci JOIN carts c ON ci.cart_id = c.id ORDER BY ci.id
+	`)
+	if err != nil {
+		t.Fatalf("cart lines: %v", err)
+	}
+	defer rows.Close()
+
+	var lines []cartLine
+	for rows.Next() {
+		var line cartLine
+		if err := rows.Scan(&line.id, &line.userID, &line.productID, &line.variantID, &line.quantity); err != nil {
+			t.Fatalf("cart lines: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("cart lines: %v", err)
+	}
+	return lines
+}
+
+// heldInCarts returns how many units of a product sit in carts
+func heldInCarts(t *testing.T, db *DB, productID int) int {
+	t.Helper()
+
+	held := 0
+	for _, line := range allCartLines(t, db) {
+		if line.productID == productID {
+			held += line.quantity
+		}
+	}
+	return held
+}
+
+// variantStock returns the stock of a variant that tracks its own
+func variantStock(t *testing.T, db *DB, variantID int) int {
+	t.Helper()
+
+	var stock int
+	if err := db.QueryRow("SELECT stock FROM product_variants WHERE id = ?", variantID).Scan(&stock); err != nil {
+		t.Fatalf("variant %d stock: %v", variantID, err)
+	}
+	return stock
+}
+
+// createTestVariants adds a variant with its own stock and one sharing the
+// product's stock, and returns their IDs
+func createTestVariants(t *testing.T, db *DB, productID, trackedStock int) (tracked, shared int) {
+	t.Helper()
+
+	if err := db.CreateVariant(productID, "Small", 0, trackedStock, true, 1); err != nil {
+		t.Fatalf("CreateVariant: %v", err)
+	}
+	if err := db.CreateVariant(productID, "Large", 5, 0, false, 2); err != nil {
+		t.Fatalf("CreateVariant: %v", err)
+	}
+	options, err := db.GetProductOptions(productID, true)
+	if err != nil {
+		t.Fatalf("GetProductOptions: %v", err)
+	}
+	for _, variant := range options.Variants {
+		if variant.TracksStock {
+			tracked = variant.ID
+		} else {
+			shared = variant.ID
+		}
+	}
+	return tracked, shared
+}
+
+func TestAddToCart(t *testing.T) {
+	tests := []struct {
+		name      string
+		stock     int
+		adds      []int
+		wantErrs  []error
+		wantStock int
+		wantHeld  int
+	}{
+		{
+			name:      "single add",
+			stock:     10,
+			adds:      []int{3},
+			wantErrs:  []error{nil},
+			wantStock: 7,
+			wantHeld:  3,
+		},
+		{
+			name:      "repeat add merges into one line",
+			stock:     10,
+			adds:      []int{3, 4},
+			wantErrs:  []error{nil, nil},
+			wantStock: 3,
+			wantHeld:  7,
+		},
+		{
+			name:      "repeat add can take the last units",
+			stock:     10,
+			adds:      []int{6, 4},
+			wantErrs:  []error{nil, nil},
+			wantStock: 0,
+			wantHeld:  10,
+		},
+		{
+			name:      "more than in stock",
+			stock:     10,
+			adds:      []int{11},
+			wantErrs:  []error{models.ErrInsufficientStock},
+			wantStock: 10,
+			wantHeld:  0,
+		},
+		{
+			name:      "more than is left after an earlier add",
+			stock:     10,
+			adds:      []int{6, 5, 4},
+			wantErrs:  []error{nil, models.ErrInsufficientStock, nil},
+			wantStock: 0,
+			wantHeld:  10,
+		},
+		{
+			name:      "out of stock",
+			stock:     0,
+			adds:      []int{1},
+			wantErrs:  []error{models.ErrInsufficientStock},
+			wantStock: 0,
+			wantHeld:  0,
+		},
+		{
+			name:      "zero",
+			stock:     10,
+			adds:      []int{0},
+			wantErrs:  []error{models.ErrInvalidQuantity},
+			wantStock: 10,
+			wantHeld:  0,
+		},
+		{
+			name:      "negative cannot shrink a line or raise stock",
+			stock:     10,
+			adds:      []int{3, -5},
+			wantErrs:  []error{nil, models.ErrInvalidQuantity},
+			wantStock: 7,
+			wantHeld:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			userID := createTestUser(t, db, "alice")
+			productID := createTestProduct(t, db, "Tea", tt.stock)
+
+			for i, quantity := range tt.adds {
+				err := db.AddToCart(userID, productID, quantity, models.OptionSelection{})
+				if !errors.Is(err, tt.wantErrs[i]) {
+					t.Errorf("add %d of %d: got error %v, want %v", i+1, quantity, err, tt.wantErrs[i])
+				}
+			}
+
+			if got := productStock(t, db, productID); got != tt.wantStock {
+				t.Errorf("stock = %d, want %d", got, tt.wantStock)
+			}
+			if got := heldInCarts(t, db, productID); got != tt.wantHeld {
+				t.Errorf("held in cart = %d, want %d", got, tt.wantHeld)
+			}
+			if lines := allCartLines(t, db); tt.wantHeld > 0 && len(lines) != 1 {
+				t.Errorf("got %d cart lines, want 1", len(lines))
+			}
+		})
+	}
+}
+
+func TestAddToCartUnavailableProduct(t *testing.T) {
+	db := newTestDB(t)
+	userID := createTestUser(t, db, "alice")
+	productID := createTestProduct(t, db, "Tea", 10)
+
+	if err := db.ArchiveProduct(productID, 0); err != nil {
+		t.Fatalf("ArchiveProduct: %v", err)
+	}
+	if err := db.AddToCart(userID, productID, 1, models.OptionSelection{}); !errors.Is(err, models.ErrProductUnavailable) {
+		t.Errorf("add archived product: got error %v, want %v", err, models.ErrProductUnavailable)
+	}
+	if err := db.AddToCart(userID, productID+1, 1, models.OptionSelection{}); !errors.Is(err, models.ErrProductUnavailable) {
+		t.Errorf("add missing product: got error %v, want %v", err, models.ErrProductUnavailable)
+	}
+	if got := productStock(t, db, productID); got != 10 {
+		t.Errorf("stock = %d, want 10", got)
+	}
+}
+
+func TestAddToCartVariants(t *testing.T) {
+	db := newTestDB(t)
+	userID := createTestUser(t, db, "alice")
+	productID := createTestProduct(t, db, "Juice", 10)
+	small, large := createTestVariants(t, db, productID, 3)
+
+	steps := []struct {
+		name      string
+		variantID int
+		quantity  int
+		wantErr   error
+	}{
+		{"variant is required", 0, 1, models.ErrInvalidOptions},
+		{"unknown variant", large + small, 1, models.ErrInvalidOptions},
+		{"tracked variant within its stock", small, 2, nil},
+		{"tracked variant beyond its stock", small, 2, models.ErrInsufficientStock},
+		{"tracked variant takes its last unit", small, 1, nil},
+		{"shared variant draws on the product", large, 4, nil},
+		{"shared variant beyond the product", large, 4, models.ErrInsufficientStock},
+	}
+	for _, step := range steps {
+		err := db.AddToCart(userID, productID, step.quantity, models.OptionSelection{VariantID: step.variantID})
+		if !errors.Is(err, step.wantErr) {
+			t.Errorf("%s: got error %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+
+	if got := productStock(t, db, productID); got != 3 {
+		t.Errorf("product stock = %d, want 3", got)
+	}
+	if got := variantStock(t, db, small); got != 0 {
+		t.Errorf("tracked variant stock = %d, want 0", got)
+	}
+	if lines := allCartLines(t, db); len(lines) != 2 {
+		t.Errorf("got %d cart lines, want one per variant", len(lines))
+	}
+}
+
+func TestUpdateCartItemQuantity(t *testing.T) {
+	tests := []struct {
+		name      string
+		quantity  int
+		wantErr   error
+		wantStock int
+		wantLine  bool
+	}{
+		{"increase", 6, nil, 4, true},
+		{"decrease", 1, nil, 9, true},
+		{"unchanged", 4, nil, 6, true},
+		{"zero removes the line", 0, nil, 10, false},
+		{"negative removes the line", -2, nil, 10, false},
+		{"up to all the stock", 10, nil, 0, true},
+		{"beyond the stock", 11, models.ErrInsufficientStock, 6, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			userID := createTestUser(t, db, "alice")
+			productID := createTestProduct(t, db, "Tea", 10)
+			if err := db.AddToCart(userID, productID, 4, models.OptionSelection{}); err != nil {
+				t.Fatalf("AddToCart: %v", err)
+			}
+			lineID := allCartLines(t, db)[0].id
+
+			if err := db.UpdateCartItemQuantity(userID, lineID, tt.quantity); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if got := productStock(t, db, productID); got != tt.wantStock {
+				t.Errorf("stock = %d, want %d", got, tt.wantStock)
+			}
+			lines := allCartLines(t, db)
+			if (len(lines) == 1) != tt.wantLine {
+				t.Fatalf("got %d cart lines, want line kept = %v", len(lines), tt.wantLine)
+			}
+			if tt.wantLine && lines[0].quantity+tt.wantStock != 10 {
+				t.Errorf("cart holds %d with %d in stock, want 10 in total", lines[0].quantity, tt.wantStock)
+			}
+		})
+	}
+}
+
+func TestUpdateCartItemQuantityTrackedVariant(t *testing.T) {
+	db := newTestDB(t)
+	userID := createTestUser(t, db, "alice")
+	productID := createTestProduct(t, db, "Juice", 10)
+	small, _ := createTestVariants(t, db, productID, 3)
+
+	if err := db.AddToCart(userID, productID, 1, models.OptionSelection{VariantID: small}); err != nil {
+		t.Fatalf("AddToCart: %v", err)
+	}
+	lineID := allCartLines(t, db)[0].id
+
+	if err := db.UpdateCartItemQuantity(userID, lineID, 4); !errors.Is(err, models.ErrInsufficientStock) {
+		t.Errorf("beyond the variant's stock: got error %v, want %v", err, models.ErrInsufficientStock)
+	}
+	if err := db.UpdateCartItemQuantity(userID, lineID, 3); err != nil {
+		t.Errorf("up to the variant's stock: %v", err)
+	}
+	if got := variantStock(t, db, small); got != 0 {
+		t.Errorf("variant stock = %d, want 0", got)
+	}
+	if err := db.UpdateCartItemQuantity(userID, lineID, 0); err != nil {
+		t.Errorf("remove: %v", err)
+	}
+	if got := variantStock(t, db, small); got != 3 {
+		t.Errorf("variant stock after removing = %d, want 3", got)
+	}
+	if got := productStock(t, db, productID); got != 10 {
+		t.Errorf("product stock after removing = %d, want 10", got)
+	}
+}
+
+func TestUpdateCartItemQuantityMissingLine(t *testing.T) {
+	db := newTestDB(t)
+	userID := createTestUser(t, db, "alice")
+	if err := db.UpdateCartItemQuantity(userID, 1, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("updating a missing line: got error %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := db.RemoveFromCart(userID, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("removing a missing line: got error %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestCartLinesOfOtherUsers(t *testing.T) {
+	db := newTestDB(t)
+	bob := createTestUser(t, db, "bob")
+	eve := createTestUser(t, db, "eve")
+	productID := createTestProduct(t, db, "Tea", 20)
+	if err := db.AddToCart(bob, productID, 2, models.OptionSelection{}); err != nil {
+		t.Fatalf("AddToCart: %v", err)
+	}
+	lineID := allCartLines(t, db)[0].id
+
+	if err := db.UpdateCartItemQuantity(eve, lineID, 15); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("updating another user's line: got error %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := db.RemoveFromCart(eve, lineID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("removing another user's line: got error %v, want %v", err, sql.ErrNoRows)
+	}
+
+	lines := allCartLines(t, db)
+	if len(lines) != 1 || lines[0].quantity != 2 {
+		t.Errorf("cart lines = %+v, want bob's line of 2 untouched", lines)
+	}
+	if got := productStock(t, db, productID); got != 18 {
+		t.Errorf("stock = %d, want 18", got)
+	}
+}
+
+func TestRemoveFromCart(t *testing.T) {
+	db := newTestDB(t)
+	userID := createTestUser(t, db, "alice")
+	tea := createTestProduct(t, db, "Tea", 10)
+	coffee := createTestProduct(t, db, "Coffee", 5)
+
+	for _, add := range []struct{ productID, quantity int }{{tea, 3}, {coffee, 2}} {
+		if err := db.AddToCart(userID, add.productID, add.quantity, models.OptionSelection{}); err != nil {
+			t.Fatalf("AddToCart: %v", err)
+		}
+	}
+
+	if err := db.RemoveFromCart(userID, allCartLines(t, db)[0].id); err != nil {
+		t.Fatalf("RemoveFromCart: %v", err)
+	}
+
+	if got := productStock(t, db, tea); got != 10 {
+		t.Errorf("removed product stock = %d, want 10", got)
+	}
+	if got := productStock(t, db, coffee); got != 3 {
+		t.Errorf("kept product stock = %d, want 3", got)
+	}
+	if lines := allCartLines(t, db); len(lines) != 1 || lines[0].productID != coffee {
+		t.Errorf("cart lines = %+v, want only the coffee", lines)
+	}
+}
+
+func TestClearCart(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	tea := createTestProduct(t, db, "Tea", 10)
+	juice := createTestProduct(t, db, "Juice", 10)
+	small, large := createTestVariants(t, db, juice, 4)
+
+	adds := []struct {
+		userID, productID, variantID, quantity int
+	}{
+		{alice, tea, 0, 3},
+		{alice, juice, small, 2},
+		{alice, juice, large, 1},
+		{bob, tea, 0, 2},
+		{bob, juice, small, 1},
+	}
+	for _, add := range adds {
+		if err := db.AddToCart(add.userID, add.productID, add.quantity, models.OptionSelection{VariantID: add.variantID}); err != nil {
+			t.Fatalf("AddToCart: %v", err)
+		}
+	}
+
+	if err := db.ClearCart(alice); err != nil {
+		t.Fatalf("ClearCart: %v", err)
+	}
+
+	// Only Bob's units are still held
+	if got := productStock(t, db, tea); got != 8 {
+		t.Errorf("tea stock = %d, want 8", got)
+	}
+	if got := productStock(t, db, juice); got != 9 {
+		t.Errorf("juice stock = %d, want 9", got)
+	}
+	if got := variantStock(t, db, small); got != 3 {
+		t.Errorf("tracked variant stock = %d, want 3", got)
+	}
+	for _, line := range allCartLines(t, db) {
+		if line.userID != bob {
+			t.Errorf("line %d of user %d survived clearing", line.id, line.userID)
+		}
+	}
+
+	// Clearing an empty cart, or a user without one, is a no-op
+	if err := db.ClearCart(alice); err != nil {
+		t.Errorf("ClearCart of empty cart: %v", err)
+	}
+	carol := createTestUser(t, db, "carol")
+	if err := db.ClearCart(carol); err != nil {
+		t.Errorf("ClearCart without cart: %v", err)
+	}
+}
+
+// cartModel is what the property test expects the database to hold
+type cartModel struct {
+	productStock map[int]int // Initial stock of every product
+	variantStock map[int]int // Initial stock of every variant that tracks its own
+	variantOf    map[int]int // Product of every tracked variant
+	archived     map[int]bool
+}
+
+// checkConservation asserts that no unit was created or lost: the stock of
+// every product and tracked variant plus what carts hold of it adds up to
+// what it started with, and no stock is negative. It also checks the stock
+// movement ledger still agrees with the stock.
+func (m cartModel) checkConservation(t *testing.T, db *DB, step string) {
+	t.Helper()
+
+	heldProducts := make(map[int]int)
+	heldVariants := make(map[int]int)
+	for _, line := range allCartLines(t, db) {
+		if line.quantity <= 0 {
+			t.Fatalf("%s: line %d holds %d units", step, line.id, line.quantity)
+		}
+		heldProducts[line.productID] += line.quantity
+		heldVariants[line.variantID] += line.quantity
+	}
+
+	for productID, initial := range m.productStock {
+		stock := productStock(t, db, productID)
+		if stock < 0 {
+			t.Fatalf("%s: product %d stock is %d", step, productID, stock)
+		}
+		if stock+heldProducts[productID] != initial {
+			t.Fatalf("%s: product %d has %d in stock and %d in carts, want %d in total",
+				step, productID, stock, heldProducts[productID], initial)
+		}
+	}
+	for variantID, initial := range m.variantStock {
+		stock := variantStock(t, db, variantID)
+		if stock < 0 {
+			t.Fatalf("%s: variant %d stock is %d", step, variantID, stock)
+		}
+		if stock+heldVariants[variantID] != initial {
+			t.Fatalf("%s: variant %d has %d in stock and %d in carts, want %d in total",
+				step, variantID, stock, heldVariants[variantID], initial)
+		}
+	}
+
+	drifts, err := db.GetStockDrift()
+	if err != nil {
+		t.Fatalf("%s: GetStockDrift: %v", step, err)
+	}
+	if len(drifts) > 0 {
+		t.Fatalf("%s: stock ledger drifted: %+v", step, drifts)
+	}
+}
+
+// canTake reports whether quantity more units of a product, and of a
+// tracked variant if one is given, are on the shelf
+func (m cartModel) canTake(t *testing.T, db *DB, productID, variantID, quantity int) bool {
+	if productStock(t, db, productID) < quantity {
+		return false
+	}
+	if _, tracked := m.variantStock[variantID]; tracked && variantStock(t, db, variantID) < quantity {
+		return false
+	}
+	return true
+}
+
+// TestCartStockConservation runs random sequences of cart operations and
+// checks after each one that stock is neither created nor lost, and that an
+// operation fails for lack of stock exactly when there is not enough of it
+func TestCartStockConservation(t *testing.T) {
+	seeds := []int64{1, 2, 3, 4, 5, 42, 1234, 99991}
+	if testing.Short() {
+		seeds = seeds[:2]
+	}
+	const steps = 150
+
+	for _, seed := range seeds {
+		seed := seed
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			rng := rand.New(rand.NewSource(seed))
+			db := newTestDB(t)
+
+			users := []int{createTestUser(t, db, "alice"), createTestUser(t, db, "bob"), createTestUser(t, db, "carol")}
+			model := cartModel{
+				productStock: make(map[int]int),
+				variantStock: make(map[int]int),
+				variantOf:    make(map[int]int),
+				archived:     make(map[int]bool),
+			}
+
+			// Plain products, and one whose variants must be picked
+			var products []int
+			for i, name := range []string{"Tea", "Coffee", "Samosa"} {
+				stock := rng.Intn(12) + i
+				id := createTestProduct(t, db, name, stock)
+				model.productStock[id] = stock
+				products = append(products, id)
+			}
+			juiceStock := rng.Intn(15) + 5
+			juice := createTestProduct(t, db, "Juice", juiceStock)
+			model.productStock[juice] = juiceStock
+			products = append(products, juice)
+			smallStock := rng.Intn(6)
+			small, large := createTestVariants(t, db, juice, smallStock)
+			model.variantStock[small] = smallStock
+			model.variantOf[small] = juice
+
+			model.checkConservation(t, db, "setup")
+
+			for i := 0; i < steps; i++ {
+				var step string
+				lines := allCartLines(t, db)
+
+				switch op := rng.Intn(10); {
+				case op < 4:
+					// Add a random product, picking a variant where one is needed
+					userID := users[rng.Intn(len(users))]
+					productID := products[rng.Intn(len(products))]
+					variantID := 0
+					if productID == juice {
+						variantID = []int{small, large}[rng.Intn(2)]
+					}
+					quantity := rng.Intn(5) + 1
+					step = "add"
+
+					wantErr := error(nil)
+					if model.archived[productID] {
+						wantErr = models.ErrProductUnavailable
+					} else if !model.canTake(t, db, productID, variantID, quantity) {
+						wantErr = models.ErrInsufficientStock
+					}
+					err := db.AddToCart(userID, productID, quantity, models.OptionSelection{VariantID: variantID})
+					if !errors.Is(err, wantErr) {
+						t.Fatalf("seed %d step %d: add %d of product %d variant %d: got error %v, want %v",
+							seed, i, quantity, productID, variantID, err, wantErr)
+					}
+
+				case op < 7 && len(lines) > 0:
+					// Change the quantity of a random line, sometimes to zero
+					line := lines[rng.Intn(len(lines))]
+					quantity := rng.Intn(line.quantity + 6)
+					step = "update"
+
+					wantErr := error(nil)
+					if more := quantity - line.quantity; more > 0 && !model.canTake(t, db, line.productID, line.variantID, more) {
+						wantErr = models.ErrInsufficientStock
+					}
+					if err := db.UpdateCartItemQuantity(line.userID, line.id, quantity); !errors.Is(err, wantErr) {
+						t.Fatalf("seed %d step %d: update line %d from %d to %d: got error %v, want %v",
+							seed, i, line.id, line.quantity, quantity, err, wantErr)
+					}
+
+				case op < 8 && len(lines) > 0:
+					line := lines[rng.Intn(len(lines))]
+					step = "remove"
+					if err := db.RemoveFromCart(line.userID, line.id); err != nil {
+						t.Fatalf("seed %d step %d: remove line %d: %v", seed, i, line.id, err)
+					}
+
+				case op < 9:
+					userID := users[rng.Intn(len(users))]
+					step = "clear"
+					if err := db.ClearCart(userID); err != nil {
+						t.Fatalf("seed %d step %d: clear cart of user %d: %v", seed, i, userID, err)
+					}
+
+				default:
+					// Take a product off the menu, releasing what carts held, or put it back
+					productID := products[rng.Intn(len(products))]
+					if model.archived[productID] {
+						step = "restore"
+						if err := db.RestoreProduct(productID); err != nil {
+							t.Fatalf("seed %d step %d: restore product %d: %v", seed, i, productID, err)
+						}
+					} else {
+						step = "archive"
+						if err := db.ArchiveProduct(productID, 0); err != nil {
+							t.Fatalf("seed %d step %d: archive product %d: %v", seed, i, productID, err)
+						}
+					}
+					model.archived[productID] = !model.archived[productID]
+				}
+
+				if step == "" {
+					continue
+				}
+				model.checkConservation(t, db, step)
+				if t.Failed() {
+					t.Fatalf("seed %d failed at step %d", seed, i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"auth-website/models"
+	"regexp"
+	"strings"
+)
+
+// Categories created on a fresh database, matching the choices the menu used to hard-code
+var defaultCategories = []string{"Snacks", "Drinks", "Dessert"}
+
+// createCategoryTable creates the categories table and links products to it
+func (db *DB) createCategoryTable() error {
+	categoryTable := `
+    CREATE TABLE IF NOT EXISTS categories (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT UNIQUE NOT NULL,
+        slug TEXT UNIQUE NOT NULL,
+        display_order INTEGER NOT NULL DEFAULT 0,
+        icon_url TEXT,
+        active INTEGER NOT NULL DEFAULT 1,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`
+
+	if _, err := db.Exec(categoryTable); err != nil {
+		return err
+	}
+
+	if err := db.addColumnIfMissing("products", "category_id", "INTEGER REFERENCES categories(id)"); err != nil {
+		return err
+	}
+
+	return db.migrateProductCategories()
+}
+
+// migrateProductCategories turns the free-text products.category values into
+// category rows and points every product at its row. It is a no-op once all
+// products have a category_id.
+func (db *DB) migrateProductCategories() error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count); err != nil {
+		return err
+	}
+
+	names := []string{}
+	if count == 0 {
+		names = append(names, defaultCategories...)
+	}
+	var legacy []string
+
+	rows, err := db.Query(`
+		SELECT DISTINCT TRIM(category) FROM products
+		WHERE category_id IS NULL AND TRIM(COALESCE(category, '')) != ''
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Names that slugify alike, like "Hot Drinks" and "Hot-Drinks", share
+	// one category, the first of them naming it
+	seen := make(map[string]bool)
+	order := count
+	for _, name := range append(names, legacy...) {
+		slug := Slugify(name)
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO categories (name, slug, display_order) VALUES (?, ?, ?)",
+			name, slug, order,
+		)
+		if err != nil {
+			return err
+		}
+		order++
+	}
+
+	// Products are matched by slug, so they find their category whichever
+	// of the alike names it was created under
+	for _, name := range legacy {
+		_, err = tx.Exec(`
+			UPDATE products SET category_id = COALESCE(
+				(SELECT id FROM categories WHERE slug = ?),
+				(SELECT id FROM categories WHERE name = ? COLLATE NOCASE)
+			)
+			WHERE category_id IS NULL AND TRIM(category) = ?
+		`, Slugify(name), name, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify turns a category name into a URL-friendly identifier
+func Slugify(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// CATEGORY RELATED METHODS
+
+// CreateCategory creates a new category
+func (db *DB) CreateCategory(name, slug, iconURL string, displayOrder int) error {
+	_, err := db.Exec(
+		"INSERT INTO categories (name, slug, display_order, icon_url) VALUES (?, ?, ?, ?)",
+		name, slug, displayOrder, iconURL,
+	)
+	return err
+}
+
+// UpdateCategory updates an existing category
+func (db *DB) UpdateCategory(id int, name, slug, iconURL string, displayOrder int, active bool) error {
+	_, err := db.Exec(
+		"UPDATE categories SET name = ?, slug = ?, display_order = ?, icon_url = ?, active = ? WHERE id = ?",
+		name, slug, displayOrder, iconURL, active, id,
+	)
+	return err
+}
+
+// GetAllCategories retrieves all categories in display order
+func (db *DB) GetAllCategories() ([]models.Category, error) {
+	return db.queryCategories("SELECT id, name, slug, display_order, COALESCE(icon_url, ''), active, created_at FROM categories ORDER BY display_order, name")
+}
+
+// GetActiveCategories retrieves the categories shown on the menu in display order
+func (db *DB) GetActiveCategories() ([]models.Category, error) {
+	return db.queryCategories("SELECT id, name, slug, display_order, COALESCE(icon_url, ''), active, created_at FROM categories WHERE active = 1 ORDER BY display_order, name")
+}
+
+// queryCategories runs a category query and scans the results
+func (db *DB) queryCategories(query string, args ...interface{}) ([]models.Category, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var category models.Category
+		err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.DisplayOrder, &category.IconURL, &category.Active, &category.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
@@ -0,0 +1,55 @@
+package database
+
+import "testing"
+
+func TestMigrateProductCategories(t *testing.T) {
+	db := newTestDB(t)
+
+	// Products from before categories existed only have the free-text column
+	legacy := []string{"Hot Drinks", "Hot-Drinks", " hot drinks ", "drinks", "Soup"}
+	for _, category := range legacy {
+		_, err := db.Exec("INSERT INTO products (name, price, stock, category) VALUES (?, 1, 0, ?)", "Item "+category, category)
+		if err != nil {
+			t.Fatalf("insert product in %q: %v", category, err)
+		}
+	}
+
+	if err := db.migrateProductCategories(); err != nil {
+		t.Fatalf("migrateProductCategories: %v", err)
+	}
+
+	categoryOf := func(category string) string {
+		t.Helper()
+
+		var slug string
+		err := db.QueryRow(`
+			SELECT COALESCE(c.slug, '') FROM products p LEFT JOIN categories c ON p.category_id = c.id
+			WHERE p.category = ?
+		`, category).Scan(&slug)
+		if err != nil {
+			t.Fatalf("category of %q: %v", category, err)
+		}
+		return slug
+	}
+
+	want := map[string]string{
+		"Hot Drinks":   "hot-drinks",
+		"Hot-Drinks":   "hot-drinks",
+		" hot drinks ": "hot-drinks",
+		"drinks":       "drinks",
+		"Soup":         "soup",
+	}
+	for category, slug := range want {
+		if got := categoryOf(category); got != slug {
+			t.Errorf("product in %q has category %q, want %q", category, got, slug)
+		}
+	}
+
+	var hotDrinks int
+	if err := db.QueryRow("SELECT COUNT(*) FROM categories WHERE slug = 'hot-drinks'").Scan(&hotDrinks); err != nil {
+		t.Fatal(err)
+	}
+	if hotDrinks != 1 {
+		t.Errorf("got %d hot drinks categories, want 1", hotDrinks)
+	}
+}
@@ -11,11 +11,16 @@ import (
 
 type DB struct {
 	*sql.DB
+	pickupKey []byte // Key pickup codes are signed with, loaded by Initialize
 }
 
-// Initialize creates and initializes the database
-func Initialize() (*DB, error) {
-	db, err := sql.Open("sqlite", "./auth.db")
+// DefaultDSN is the SQLite database the server uses unless told otherwise.
+// Foreign keys are off by default in SQLite and must be enabled on every connection.
+const DefaultDSN = "file:./auth.db?_pragma=foreign_keys(1)"
+
+// Initialize opens the SQLite database at dsn and creates or migrates its tables
+func Initialize(dsn string) (*DB, error) {
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -24,7 +29,7 @@ func Initialize() (*DB, error) {
 		return nil, err
 	}
 
-	dbInstance := &DB{db}
+	dbInstance := &DB{DB: db}
 
 	// Create all tables
 	if err := dbInstance.createTables(); err != nil {
@@ -39,11 +44,87 @@ func Initialize() (*DB, error) {
 		return nil, err
 	}
 
+	if err := dbInstance.createCategoryTable(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createStockMovementTable(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createStockAlertTable(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createOrderTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createPurchasingTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createRecipeTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createBatchTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createDietaryTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createOptionTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createFavouriteTable(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createSearchTable(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createRefundTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createPOSTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createShiftTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createPrintTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createPickupTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createNotificationTables(); err != nil {
+		return nil, err
+	}
+
+	if err := dbInstance.createWebhookTables(); err != nil {
+		return nil, err
+	}
+
 	// Create default admin user if it doesn't exist
 	if err := dbInstance.createDefaultAdmin(); err != nil {
 		log.Printf("Warning: Could not create default admin: %v", err)
 	}
 
+	if err := dbInstance.createWalkInCustomer(); err != nil {
+		return nil, err
+	}
+
 	return dbInstance, nil
 }
 
@@ -79,9 +160,45 @@ func (db *DB) createTables() error {
 	}
 
 	_, err = db.Exec(productTable)
+	if err != nil {
+		return err
+	}
+
+	if err := db.addColumnIfMissing("products", "thumbnail_url", "TEXT"); err != nil {
+		return err
+	}
+
+	if err := db.addColumnIfMissing("products", "archived_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	// Stock at or below reorder_level raises a low-stock alert, 0 disables it
+	if err := db.addColumnIfMissing("products", "reorder_level", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	return db.addColumnIfMissing("products", "reorder_quantity", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// addColumnIfMissing adds a column to an existing table, so databases created
+// before the column was introduced pick it up on startup
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	exists, err := db.columnExists(table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
 	return err
 }
 
+// columnExists reports whether table has a column with the given name
+func (db *DB) columnExists(table, column string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	return count > 0, err
+}
+
 // createCartTables creates the cart-related tables
 func (db *DB) createCartTables() error {
 	// Create cart table
@@ -110,23 +227,14 @@ func (db *DB) createCartTables() error {
 	}
 
 	_, err = db.Exec(cartItemsTable)
-	return err
-}
-
-// createFeedbackTable creates the feedback table
-func (db *DB) createFeedbackTable() error {
-	feedbackTable := `
-    CREATE TABLE IF NOT EXISTS feedback (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        name TEXT NOT NULL,
-        email TEXT NOT NULL,
-        food_quality INTEGER NOT NULL CHECK(food_quality >= 1 AND food_quality <= 5),
-        service INTEGER NOT NULL CHECK(service >= 1 AND service <= 5),
-        comments TEXT,
-        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-    )`
+	if err != nil {
+		return err
+	}
 
-	_, err := db.Exec(feedbackTable)
+	// Products used to be hard deleted while foreign keys were not enforced,
+	// which left cart items pointing at nothing. Drop them so the now enforced
+	// constraint holds.
+	_, err = db.Exec("DELETE FROM cart_items WHERE product_id NOT IN (SELECT id FROM products)")
 	return err
 }
 
@@ -186,6 +294,20 @@ func (db *DB) GetUserByUsername(username string) (*models.User, error) {
 	return user, nil
 }
 
+// GetUserByID retrieves a user by their ID
+func (db *DB) GetUserByID(id int) (*models.User, error) {
+	user := &models.User{}
+	err := db.QueryRow(
+		"SELECT id, username, email, role, created_at FROM users WHERE id = ?",
+		id,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 // ValidatePassword validates a user's password
 func (db *DB) ValidatePassword(username, password string) (*models.User, error) {
 	user, err := db.GetUserByUsername(username)
@@ -224,18 +346,127 @@ func (db *DB) GetAllUsers() ([]models.User, error) {
 
 // PRODUCT RELATED METHODS
 
-// CreateProduct creates a new product in the database
-func (db *DB) CreateProduct(name, description, imageURL, category string, price float64, stock int) error {
-	_, err := db.Exec(
-		"INSERT INTO products (name, description, price, image_url, stock, category) VALUES (?, ?, ?, ?, ?, ?)",
-		name, description, price, imageURL, stock, category,
+// productColumns is the column list scanned by scanProduct
+const productColumns = `p.id, p.name, COALESCE(p.description, ''), p.price, COALESCE(p.image_url, ''),
+	COALESCE(p.thumbnail_url, ''), p.stock,
+	EXISTS(SELECT 1 FROM recipe_items r WHERE r.product_id = p.id), p.reorder_level, p.reorder_quantity, COALESCE(p.category_id, 0),
+	COALESCE(c.name, ''), p.archived_at, COALESCE(ratings.average, 0), COALESCE(ratings.count, 0),
+	COALESCE(ratings.reviews, 0),
+	COALESCE((SELECT GROUP_CONCAT(tag) FROM product_dietary_tags WHERE product_id = p.id), ''),
+	COALESCE((SELECT GROUP_CONCAT(allergen) FROM product_allergens WHERE product_id = p.id), ''),
+	COALESCE(p.calories, 0), COALESCE(p.protein_g, 0), COALESCE(p.carbs_g, 0), COALESCE(p.fat_g, 0),
+	EXISTS (SELECT 1 FROM product_variants WHERE product_id = p.id AND active = 1)
+	OR EXISTS (SELECT 1 FROM modifier_groups g JOIN modifiers m ON m.group_id = g.id WHERE g.product_id = p.id AND m.active = 1),
+	p.created_at`
+
+// productJoins joins the tables needed by productColumns. Ratings come from
+// the per-dish feedback customers leave on their orders and from reviews.
+const productJoins = `FROM products p
+	LEFT JOIN categories c ON p.category_id = c.id
+	LEFT JOIN (
+		SELECT product_id, AVG(food_quality) AS average, COUNT(*) AS count,
+		       SUM(order_id IS NULL AND COALESCE(comments, '') != '') AS reviews
+		FROM feedback
+		WHERE product_id IS NOT NULL AND hidden_at IS NULL
+		GROUP BY product_id
+	) ratings ON ratings.product_id = p.id`
+
+// scanProduct scans a row selected with productColumns
+func scanProduct(row rowScanner) (models.Product, error) {
+	var product models.Product
+	var archivedAt sql.NullTime
+	var dietaryTags, allergens string
+	err := row.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.ImageURL,
+		&product.ThumbnailURL, &product.Stock, &product.HasRecipe, &product.ReorderLevel, &product.ReorderQuantity, &product.CategoryID,
+		&product.Category, &archivedAt, &product.AvgRating, &product.RatingCount,
+		&product.ReviewCount, &dietaryTags, &allergens, &product.Nutrition.Calories, &product.Nutrition.ProteinGrams,
+		&product.Nutrition.CarbsGrams, &product.Nutrition.FatGrams, &product.HasOptions, &product.CreatedAt)
+	if archivedAt.Valid {
+		product.ArchivedAt = archivedAt.Time
+	}
+	// Sort the tags into display order
+	product.DietaryTags = models.NormalizeDietaryTags(splitList(dietaryTags))
+	product.Allergens = models.NormalizeAllergens(splitList(allergens))
+	return product, err
+}
+
+// CreateProduct creates a new product in the database and returns its ID.
+// The initial stock is recorded as a restock by actorID.
+func (db *DB) CreateProduct(product models.Product, actorID int) (int, error) {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`INSERT INTO products (name, description, price, image_url, thumbnail_url, stock, reorder_level, reorder_quantity, category_id)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		product.Name, product.Description, product.Price, product.ImageURL, product.ThumbnailURL,
+		product.ReorderLevel, product.ReorderQuantity, nullableID(product.CategoryID),
 	)
-	return err
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	product.ID = int(id)
+	if err := setProductDietary(tx, product); err != nil {
+		return 0, err
+	}
+
+	if err := changeStock(tx, int(id), product.Stock, models.MovementRestock, actorID, "Initial stock"); err != nil {
+		return 0, err
+	}
+
+	if err := changeShelfStock(tx, int(id), product.Stock, models.MovementRestock, actorID, "Initial stock"); err != nil {
+		return 0, err
+	}
+
+	if err := enqueueProductEvent(tx, int(id), "created"); err != nil {
+		return 0, err
+	}
+
+	// Commit transaction
+	return int(id), tx.Commit()
 }
 
-// GetAllProducts retrieves all products from the database
+// GetAllProducts retrieves all products that have not been archived
 func (db *DB) GetAllProducts() ([]models.Product, error) {
-	rows, err := db.Query("SELECT id, name, description, price, image_url, stock, category, created_at FROM products ORDER BY created_at DESC")
+	return db.queryProducts("SELECT " + productColumns + " " + productJoins + " WHERE p.archived_at IS NULL ORDER BY p.created_at DESC")
+}
+
+// GetArchivedProducts retrieves the archived products, most recently archived first
+func (db *DB) GetArchivedProducts() ([]models.Product, error) {
+	return db.queryProducts("SELECT " + productColumns + " " + productJoins + " WHERE p.archived_at IS NOT NULL ORDER BY p.archived_at DESC")
+}
+
+// productOrders maps the menu sort orders to their ORDER BY clauses
+var productOrders = map[string]string{
+	models.ProductSortNewest: "p.created_at DESC",
+	models.ProductSortRating: "COALESCE(ratings.average, 0) DESC, COALESCE(ratings.count, 0) DESC, p.created_at DESC",
+}
+
+// GetMenu retrieves the products on the menu matching a filter, sorted
+// newest first or by rating. Archived products are never included.
+func (db *DB) GetMenu(filter models.MenuFilter) ([]models.Product, error) {
+	order, ok := productOrders[filter.Sort]
+	if !ok {
+		order = productOrders[models.ProductSortNewest]
+	}
+
+	conditions, args := menuWhere(filter)
+	return db.queryProducts("SELECT "+productColumns+" "+productJoins+" WHERE p.archived_at IS NULL"+conditions+" ORDER BY "+order, args...)
+}
+
+// queryProducts runs a product query and scans the results
+func (db *DB) queryProducts(query string, args ...interface{}) ([]models.Product, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -243,76 +474,173 @@ func (db *DB) GetAllProducts() ([]models.Product, error) {
 
 	var products []models.Product
 	for rows.Next() {
-		var product models.Product
-		err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.ImageURL, &product.Stock, &product.Category, &product.CreatedAt)
+		product, err := scanProduct(rows)
 		if err != nil {
 			return nil, err
 		}
 		products = append(products, product)
 	}
 
-	return products, nil
+	return products, rows.Err()
 }
 
 // GetProductByID retrieves a product by its ID
 func (db *DB) GetProductByID(id int) (*models.Product, error) {
-	product := &models.Product{}
-	err := db.QueryRow(
-		"SELECT id, name, description, price, image_url, stock, category, created_at FROM products WHERE id = ?",
-		id,
-	).Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.ImageURL, &product.Stock, &product.Category, &product.CreatedAt)
-
+	product, err := scanProduct(db.QueryRow("SELECT "+productColumns+" "+productJoins+" WHERE p.id = ?", id))
 	if err != nil {
 		return nil, err
 	}
-	return product, nil
+	return &product, nil
 }
 
-// UpdateProduct updates an existing product
-func (db *DB) UpdateProduct(id int, name, description, imageURL, category string, price float64, stock int) error {
-	_, err := db.Exec(
-		"UPDATE products SET name = ?, description = ?, price = ?, image_url = ?, stock = ?, category = ? WHERE id = ?",
-		name, description, price, imageURL, stock, category, id,
+// UpdateProduct updates an existing product. A change to the stock is
+// recorded as a manual correction by actorID, except for products with a
+// recipe whose stock is left to follow their ingredients.
+func (db *DB) UpdateProduct(product models.Product, actorID int) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stock int
+	var hasRecipe bool
+	err = tx.QueryRow(
+		"SELECT stock, EXISTS(SELECT 1 FROM recipe_items WHERE product_id = ?) FROM products WHERE id = ?",
+		product.ID, product.ID,
+	).Scan(&stock, &hasRecipe)
+	if err != nil {
+		return err
+	}
+
+	// The stock of a product with a recipe follows its ingredients
+	if hasRecipe {
+		product.Stock = stock
+	}
+
+	_, err = tx.Exec(
+		`UPDATE products SET name = ?, description = ?, price = ?, image_url = ?, thumbnail_url = ?,
+		reorder_level = ?, reorder_quantity = ?, category_id = ? WHERE id = ?`,
+		product.Name, product.Description, product.Price, product.ImageURL, product.ThumbnailURL,
+		product.ReorderLevel, product.ReorderQuantity, nullableID(product.CategoryID), product.ID,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if err := setProductDietary(tx, product); err != nil {
+		return err
+	}
+
+	if err := changeStock(tx, product.ID, product.Stock-stock, models.MovementCorrection, actorID, "Edited product"); err != nil {
+		return err
+	}
+
+	if err := changeShelfStock(tx, product.ID, product.Stock-stock, models.MovementCorrection, actorID, "Edited product"); err != nil {
+		return err
+	}
+
+	if err := enqueueProductEvent(tx, product.ID, "updated"); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
 }
 
-// DeleteProduct deletes a product by its ID
-func (db *DB) DeleteProduct(id int) error {
-	_, err := db.Exec("DELETE FROM products WHERE id = ?", id)
-	return err
+// CountProductsUsingImage returns how many products reference url as their image or thumbnail
+func (db *DB) CountProductsUsingImage(url string) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM products WHERE image_url = ? OR thumbnail_url = ?", url, url).Scan(&count)
+	return count, err
 }
 
-// FEEDBACK RELATED METHODS
+// nullableID maps an unset (zero) foreign key to NULL
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
 
-// CreateFeedback creates a new feedback entry in the database
-func (db *DB) CreateFeedback(name, email, comments string, foodQuality, service int) error {
-	_, err := db.Exec(
-		"INSERT INTO feedback (name, email, food_quality, service, comments) VALUES (?, ?, ?, ?, ?)",
-		name, email, foodQuality, service, comments,
-	)
-	return err
+// ArchiveProduct hides a product from the menu while keeping it for order
+// history. Any units sitting in carts are returned to stock and the cart
+// items removed, since they can no longer be ordered.
+func (db *DB) ArchiveProduct(id, actorID int) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inCarts int
+	err = tx.QueryRow("SELECT COALESCE(SUM(quantity), 0) FROM cart_items WHERE product_id = ?", id).Scan(&inCarts)
+	if err != nil {
+		return err
+	}
+
+	// Archiving an archived product changes nothing and raises no event
+	result, err := tx.Exec("UPDATE products SET archived_at = CURRENT_TIMESTAMP WHERE id = ? AND archived_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return err
+	}
+
+	if err := changeStock(tx, id, inCarts, models.MovementCartRelease, actorID, "Product archived"); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE product_variants
+		SET stock = stock + (SELECT COALESCE(SUM(quantity), 0) FROM cart_items WHERE variant_id = product_variants.id)
+		WHERE product_id = ? AND stock IS NOT NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM cart_items WHERE product_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	// Products sharing ingredients with this one follow its availability
+	if err := syncRecipeStock(tx); err != nil {
+		return err
+	}
+
+	if err := enqueueProductEvent(tx, id, "archived"); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
 }
 
-// GetAllFeedback retrieves all feedback from the database
-func (db *DB) GetAllFeedback() ([]models.Feedback, error) {
-	rows, err := db.Query("SELECT id, name, email, food_quality, service, comments, created_at FROM feedback ORDER BY created_at DESC")
+// RestoreProduct puts an archived product back on the menu
+func (db *DB) RestoreProduct(id int) error {
+	// Begin transaction
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var feedbacks []models.Feedback
-	for rows.Next() {
-		var feedback models.Feedback
-		err := rows.Scan(&feedback.ID, &feedback.Name, &feedback.Email, &feedback.FoodQuality, &feedback.Service, &feedback.Comments, &feedback.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		feedbacks = append(feedbacks, feedback)
+	_, err = tx.Exec("UPDATE products SET archived_at = NULL WHERE id = ?", id)
+	if err != nil {
+		return err
 	}
 
-	return feedbacks, nil
+	if err := enqueueProductEvent(tx, id, "restored"); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
 }
 
 // CART RELATED METHODS
@@ -351,40 +679,16 @@ func (db *DB) GetUserCart(userID int) (*models.Cart, error) {
 		Items:  []models.CartItem{},
 	}
 
-	// Get cart items with product details
-	rows, err := db.Query(`
-		SELECT ci.id, ci.product_id, ci.quantity, p.name, p.price, p.image_url
-		FROM cart_items ci
-		JOIN products p ON ci.product_id = p.id
-		WHERE ci.cart_id = ?
-	`, cartID)
+	// Get cart items with product details, the same product with different
+	// options making separate lines
+	items, err := cartLines(db, cartID)
 	if err != nil {
 		return cart, nil // Return empty cart on error
 	}
-	defer rows.Close()
 
 	var totalPrice float64 = 0
-	for rows.Next() {
-		var item models.CartItem
-		var productName, imageURL string
-		var productPrice float64
-
-		err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &productName, &productPrice, &imageURL)
-		if err != nil {
-			continue
-		}
-
-		item.Product = models.Product{
-			ID:       item.ProductID,
-			Name:     productName,
-			Price:    productPrice,
-			ImageURL: imageURL,
-		}
-
-		// Calculate item total
-		item.ItemTotal = productPrice * float64(item.Quantity)
+	for _, item := range items {
 		totalPrice += item.ItemTotal
-
 		cart.Items = append(cart.Items, item)
 	}
 
@@ -392,25 +696,65 @@ func (db *DB) GetUserCart(userID int) (*models.Cart, error) {
 	return cart, nil
 }
 
-// AddToCart adds a product to the user's cart
-func (db *DB) AddToCart(userID, productID, quantity int) error {
-	// First, check if product has enough stock
-	var stock int
-	err := db.QueryRow("SELECT stock FROM products WHERE id = ?", productID).Scan(&stock)
+// AddToCart adds a product with the selected options to the user's cart.
+// Adding the same product with the same options again increases the quantity
+// of its line. It fails with ErrInvalidQuantity unless quantity is positive.
+func (db *DB) AddToCart(userID, productID, quantity int, selection models.OptionSelection) error {
+	if quantity <= 0 {
+		return models.ErrInvalidQuantity
+	}
+
+	// Begin transaction
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if stock < quantity {
+	// Take the units off the shelf if the product is still on the menu and
+	// has enough stock. Checking and taking in one statement keeps two carts
+	// adding at once from both getting the last units.
+	result, err := tx.Exec(
+		"UPDATE products SET stock = stock - ? WHERE id = ? AND archived_at IS NULL AND stock >= ?",
+		quantity, productID, quantity,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		var onMenu bool
+		err := tx.QueryRow("SELECT archived_at IS NULL FROM products WHERE id = ?", productID).Scan(&onMenu)
+		if err == sql.ErrNoRows || (err == nil && !onMenu) {
+			return models.ErrProductUnavailable
+		}
+		if err != nil {
+			return err
+		}
 		return models.ErrInsufficientStock
 	}
+	if _, err := recordMovement(tx, productID, -quantity, models.MovementCartReserve, userID, ""); err != nil {
+		return err
+	}
 
-	// Begin transaction
-	tx, err := db.Begin()
+	options, err := resolveOptions(tx, productID, selection)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+
+	// A variant with its own stock must have enough of it too
+	variantID := 0
+	if options.variant != nil {
+		variantID = options.variant.ID
+		if options.variant.TracksStock {
+			if err := takeVariantStock(tx, variantID, quantity); err != nil {
+				return err
+			}
+		}
+	}
 
 	// Get or create cart
 	var cartID int
@@ -433,33 +777,45 @@ func (db *DB) AddToCart(userID, productID, quantity int) error {
 		}
 	}
 
-	// Check if product already exists in cart
+	// Check if product already exists in cart with the same options
 	var existingItemID, existingQuantity int
-	err = tx.QueryRow("SELECT id, quantity FROM cart_items WHERE cart_id = ? AND product_id = ?", cartID, productID).Scan(&existingItemID, &existingQuantity)
+	err = tx.QueryRow(
+		"SELECT id, quantity FROM cart_items WHERE cart_id = ? AND product_id = ? AND options_key = ?",
+		cartID, productID, options.key,
+	).Scan(&existingItemID, &existingQuantity)
 	if err == nil {
-		// Product already in cart, update quantity
-		totalQuantity := existingQuantity + quantity
-		if totalQuantity > stock {
-			return models.ErrInsufficientStock
-		}
-
-		_, err = tx.Exec("UPDATE cart_items SET quantity = ? WHERE id = ?", totalQuantity, existingItemID)
+		// Product already in cart, update quantity. Its units are already
+		// off the shelf, so only the added quantity needs to be in stock.
+		_, err = tx.Exec("UPDATE cart_items SET quantity = ? WHERE id = ?", existingQuantity+quantity, existingItemID)
 		if err != nil {
 			return err
 		}
 	} else if err == sql.ErrNoRows {
 		// Product not in cart, add it
-		_, err = tx.Exec("INSERT INTO cart_items (cart_id, product_id, quantity) VALUES (?, ?, ?)", cartID, productID, quantity)
+		result, err := tx.Exec(
+			"INSERT INTO cart_items (cart_id, product_id, quantity, variant_id, options_key) VALUES (?, ?, ?, ?, ?)",
+			cartID, productID, quantity, nullableID(variantID), options.key,
+		)
 		if err != nil {
 			return err
 		}
+
+		cartItemID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, modifier := range options.modifiers {
+			_, err = tx.Exec("INSERT INTO cart_item_modifiers (cart_item_id, modifier_id) VALUES (?, ?)", cartItemID, modifier.ID)
+			if err != nil {
+				return err
+			}
+		}
 	} else {
 		return err
 	}
 
-	// Update product stock
-	_, err = tx.Exec("UPDATE products SET stock = stock - ? WHERE id = ?", quantity, productID)
-	if err != nil {
+	// Products sharing ingredients with this one follow its availability
+	if err := syncRecipeStock(tx); err != nil {
 		return err
 	}
 
@@ -467,8 +823,9 @@ func (db *DB) AddToCart(userID, productID, quantity int) error {
 	return tx.Commit()
 }
 
-// UpdateCartItemQuantity updates the quantity of an item in the cart
-func (db *DB) UpdateCartItemQuantity(cartItemID, newQuantity int) error {
+// UpdateCartItemQuantity updates the quantity of an item in a user's cart.
+// It fails with sql.ErrNoRows unless the item is in that user's cart.
+func (db *DB) UpdateCartItemQuantity(userID, cartItemID, newQuantity int) error {
 	// Begin transaction
 	tx, err := db.Begin()
 	if err != nil {
@@ -476,29 +833,39 @@ func (db *DB) UpdateCartItemQuantity(cartItemID, newQuantity int) error {
 	}
 	defer tx.Rollback()
 
-	// Get current quantity and product ID
-	var currentQuantity, productID int
-	err = tx.QueryRow("SELECT quantity, product_id FROM cart_items WHERE id = ?", cartItemID).Scan(&currentQuantity, &productID)
+	// Get current quantity, product ID and variant of the user's own line
+	var currentQuantity, productID, variantID int
+	err = tx.QueryRow(
+		"SELECT ci.quantity, ci.product_id, COALESCE(ci.variant_id, 0) FROM cart_items ci JOIN carts c ON ci.cart_id = c.id WHERE ci.id = ? AND c.user_id = ?",
+		cartItemID, userID,
+	).Scan(&currentQuantity, &productID, &variantID)
 	if err != nil {
 		return err
 	}
 
+	// A quantity below zero removes the line, returning only what it held
+	if newQuantity < 0 {
+		newQuantity = 0
+	}
+
 	// Calculate the difference in quantity
 	quantityChange := newQuantity - currentQuantity
 
 	// If decreasing quantity
 	if quantityChange < 0 {
 		// Return items to stock
-		_, err = tx.Exec("UPDATE products SET stock = stock + ? WHERE id = ?", -quantityChange, productID)
-		if err != nil {
+		if err := changeStock(tx, productID, -quantityChange, models.MovementCartRelease, userID, ""); err != nil {
+			return err
+		}
+		if err := changeVariantStock(tx, variantID, -quantityChange); err != nil {
 			return err
 		}
-		
+
 		// Update cart item quantity or remove if zero
 		if newQuantity <= 0 {
-			_, err = tx.Exec("DELETE FROM cart_items WHERE id = ?", cartItemID)
+			_, err = tx.Exec("DELETE FROM cart_items WHERE id = ? AND cart_id IN (SELECT id FROM carts WHERE user_id = ?)", cartItemID, userID)
 		} else {
-			_, err = tx.Exec("UPDATE cart_items SET quantity = ? WHERE id = ?", newQuantity, cartItemID)
+			_, err = tx.Exec("UPDATE cart_items SET quantity = ? WHERE id = ? AND cart_id IN (SELECT id FROM carts WHERE user_id = ?)", newQuantity, cartItemID, userID)
 		}
 		if err != nil {
 			return err
@@ -515,25 +882,45 @@ func (db *DB) UpdateCartItemQuantity(cartItemID, newQuantity int) error {
 			return models.ErrInsufficientStock
 		}
 
+		// A variant with its own stock must have enough of it too
+		if variantID != 0 {
+			var variantStock sql.NullInt64
+			err = tx.QueryRow("SELECT stock FROM product_variants WHERE id = ?", variantID).Scan(&variantStock)
+			if err != nil {
+				return err
+			}
+			if variantStock.Valid && variantStock.Int64 < int64(quantityChange) {
+				return models.ErrInsufficientStock
+			}
+		}
+
 		// Decrease stock
-		_, err = tx.Exec("UPDATE products SET stock = stock - ? WHERE id = ?", quantityChange, productID)
-		if err != nil {
+		if err := changeStock(tx, productID, -quantityChange, models.MovementCartReserve, userID, ""); err != nil {
+			return err
+		}
+		if err := changeVariantStock(tx, variantID, -quantityChange); err != nil {
 			return err
 		}
 
 		// Update cart item quantity
-		_, err = tx.Exec("UPDATE cart_items SET quantity = ? WHERE id = ?", newQuantity, cartItemID)
+		_, err = tx.Exec("UPDATE cart_items SET quantity = ? WHERE id = ? AND cart_id IN (SELECT id FROM carts WHERE user_id = ?)", newQuantity, cartItemID, userID)
 		if err != nil {
 			return err
 		}
 	}
 
+	// Products sharing ingredients with this one follow its availability
+	if err := syncRecipeStock(tx); err != nil {
+		return err
+	}
+
 	// Commit transaction
 	return tx.Commit()
 }
 
-// RemoveFromCart removes an item from the cart
-func (db *DB) RemoveFromCart(cartItemID int) error {
+// RemoveFromCart removes an item from a user's cart. It fails with
+// sql.ErrNoRows unless the item is in that user's cart.
+func (db *DB) RemoveFromCart(userID, cartItemID int) error {
 	// Begin transaction
 	tx, err := db.Begin()
 	if err != nil {
@@ -541,25 +928,35 @@ func (db *DB) RemoveFromCart(cartItemID int) error {
 	}
 	defer tx.Rollback()
 
-	// Get quantity and product ID before deleting
-	var quantity, productID int
-	err = tx.QueryRow("SELECT quantity, product_id FROM cart_items WHERE id = ?", cartItemID).Scan(&quantity, &productID)
+	// Get quantity, product ID and variant of the user's own line before deleting
+	var quantity, productID, variantID int
+	err = tx.QueryRow(
+		"SELECT ci.quantity, ci.product_id, COALESCE(ci.variant_id, 0) FROM cart_items ci JOIN carts c ON ci.cart_id = c.id WHERE ci.id = ? AND c.user_id = ?",
+		cartItemID, userID,
+	).Scan(&quantity, &productID, &variantID)
 	if err != nil {
 		return err
 	}
 
 	// Return items to stock
-	_, err = tx.Exec("UPDATE products SET stock = stock + ? WHERE id = ?", quantity, productID)
-	if err != nil {
+	if err := changeStock(tx, productID, quantity, models.MovementCartRelease, userID, ""); err != nil {
+		return err
+	}
+	if err := changeVariantStock(tx, variantID, quantity); err != nil {
 		return err
 	}
 
 	// Remove item from cart
-	_, err = tx.Exec("DELETE FROM cart_items WHERE id = ?", cartItemID)
+	_, err = tx.Exec("DELETE FROM cart_items WHERE id = ? AND cart_id IN (SELECT id FROM carts WHERE user_id = ?)", cartItemID, userID)
 	if err != nil {
 		return err
 	}
 
+	// Products sharing ingredients with this one follow its availability
+	if err := syncRecipeStock(tx); err != nil {
+		return err
+	}
+
 	// Commit transaction
 	return tx.Commit()
 }
@@ -584,23 +981,28 @@ func (db *DB) ClearCart(userID int) error {
 	defer tx.Rollback()
 
 	// Get all cart items to return stock
-	rows, err := tx.Query("SELECT product_id, quantity FROM cart_items WHERE cart_id = ?", cartID)
+	rows, err := tx.Query("SELECT product_id, COALESCE(variant_id, 0), quantity FROM cart_items WHERE cart_id = ?", cartID)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
 
-	// Return stock for each item
+	var held []heldStock
 	for rows.Next() {
-		var productID, quantity int
-		if err := rows.Scan(&productID, &quantity); err != nil {
+		var item heldStock
+		if err := rows.Scan(&item.productID, &item.variantID, &item.quantity); err != nil {
+			rows.Close()
 			return err
 		}
+		held = append(held, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-		_, err = tx.Exec("UPDATE products SET stock = stock + ? WHERE id = ?", quantity, productID)
-		if err != nil {
-			return err
-		}
+	// Return stock for each item
+	if err := returnStock(tx, held, models.MovementCartRelease, userID, ""); err != nil {
+		return err
 	}
 
 	// Delete all cart items
@@ -611,4 +1013,4 @@ func (db *DB) ClearCart(userID int) error {
 
 	// Commit transaction
 	return tx.Commit()
-}
\ No newline at end of file
+}
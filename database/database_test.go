@@ -0,0 +1,115 @@
+package database
+
+import (
+	"auth-website/models"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// testDBCount numbers the in-memory databases so every test gets its own
+var testDBCount int64
+
+// newTestDB returns a freshly initialized in-memory database, closed when the test ends
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	// A named shared-cache database is visible to every connection in the
+	// pool, where a plain :memory: database would be private to one
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared&_pragma=foreign_keys(1)", atomic.AddInt64(&testDBCount, 1))
+	db, err := Initialize(dsn)
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTestUser registers a user and returns their ID
+func createTestUser(t *testing.T, db *DB, username string) int {
+	t.Helper()
+
+	if err := db.CreateUser(username, username+"@example.com", "password"); err != nil {
+		t.Fatalf("CreateUser(%q): %v", username, err)
+	}
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		t.Fatalf("GetUserByUsername(%q): %v", username, err)
+	}
+	return user.ID
+}
+
+// createTestProduct adds a product with some stock and returns its ID
+func createTestProduct(t *testing.T, db *DB, name string, stock int) int {
+	t.Helper()
+
+	id, err := db.CreateProduct(models.Product{Name: name, Price: 10, Stock: stock}, 0)
+	if err != nil {
+		t.Fatalf("CreateProduct(%q): %v", name, err)
+	}
+	return id
+}
+
+// productStock returns a product's stock
+func productStock(t *testing.T, db *DB, productID int) int {
+	t.Helper()
+
+	var stock int
+	if err := db.QueryRow("SELECT stock FROM products WHERE id = ?", productID).Scan(&stock); err != nil {
+		t.Fatalf("product %d stock: %v", productID, err)
+	}
+	return stock
+}
+
+func TestInitializeIsRepeatable(t *testing.T) {
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared", atomic.AddInt64(&testDBCount, 1))
+	first, err := Initialize(dsn)
+	if err != nil {
+		t.Fatalf("first Initialize: %v", err)
+	}
+	defer first.Close()
+
+	// Running the migrations again over the same tables must change nothing
+	second, err := Initialize(dsn)
+	if err != nil {
+		t.Fatalf("second Initialize: %v", err)
+	}
+	defer second.Close()
+
+	var admins, walkIns int
+	err = second.QueryRow("SELECT COUNT(*) FROM users WHERE role = ?", models.RoleAdmin).Scan(&admins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = second.QueryRow("SELECT COUNT(*) FROM users WHERE role = ?", models.RoleWalkIn).Scan(&walkIns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admins != 1 || walkIns != 1 {
+		t.Errorf("got %d admins and %d walk-in accounts, want 1 of each", admins, walkIns)
+	}
+}
+
+func TestArchiveProductTwice(t *testing.T) {
+	db := newTestDB(t)
+	productID := createTestProduct(t, db, "Tea", 10)
+
+	if err := db.ArchiveProduct(productID, 0); err != nil {
+		t.Fatalf("ArchiveProduct: %v", err)
+	}
+	const archivedAt = "2020-01-01 00:00:00"
+	if _, err := db.Exec("UPDATE products SET archived_at = ? WHERE id = ?", archivedAt, productID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.ArchiveProduct(productID, 0); err != nil {
+		t.Fatalf("second ArchiveProduct: %v", err)
+	}
+	var got string
+	if err := db.QueryRow("SELECT strftime('%Y-%m-%d %H:%M:%S', archived_at) FROM products WHERE id = ?", productID).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != archivedAt {
+		t.Errorf("archived_at = %s, want it kept at %s", got, archivedAt)
+	}
+}
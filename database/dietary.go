@@ -0,0 +1,193 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"strings"
+)
+
+// createDietaryTables creates the product dietary tag and allergen tables and
+// the dietary preferences of users, and adds the nutrition columns to products
+func (db *DB) createDietaryTables() error {
+	// Create product dietary tags table
+	productTagsTable := `
+    CREATE TABLE IF NOT EXISTS product_dietary_tags (
+        product_id INTEGER NOT NULL,
+        tag TEXT NOT NULL,
+        PRIMARY KEY (product_id, tag),
+        FOREIGN KEY (product_id) REFERENCES products(id)
+    )`
+
+	// Create product allergens table
+	productAllergensTable := `
+    CREATE TABLE IF NOT EXISTS product_allergens (
+        product_id INTEGER NOT NULL,
+        allergen TEXT NOT NULL,
+        PRIMARY KEY (product_id, allergen),
+        FOREIGN KEY (product_id) REFERENCES products(id)
+    )`
+
+	// Create user diets table, the dietary tags a user needs every product to carry
+	userDietsTable := `
+    CREATE TABLE IF NOT EXISTS user_diets (
+        user_id INTEGER NOT NULL,
+        tag TEXT NOT NULL,
+        PRIMARY KEY (user_id, tag),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    )`
+
+	// Create user allergens table, the allergens a user avoids
+	userAllergensTable := `
+    CREATE TABLE IF NOT EXISTS user_allergens (
+        user_id INTEGER NOT NULL,
+        allergen TEXT NOT NULL,
+        PRIMARY KEY (user_id, allergen),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    )`
+
+	for _, table := range []string{productTagsTable, productAllergensTable, userDietsTable, userAllergensTable} {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+
+	// Nutrition per serving, NULL when unknown
+	nutritionColumns := []struct{ name, definition string }{
+		{"calories", "INTEGER"},
+		{"protein_g", "REAL"},
+		{"carbs_g", "REAL"},
+		{"fat_g", "REAL"},
+	}
+	for _, column := range nutritionColumns {
+		if err := db.addColumnIfMissing("products", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// Users choose whether products that do not suit them are hidden or only warned about
+	return db.addColumnIfMissing("users", "hide_incompatible", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// splitList splits a comma separated GROUP_CONCAT result
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// nullableAmount maps an unknown (zero) nutrition value to NULL
+func nullableAmount(amount float64) interface{} {
+	if amount == 0 {
+		return nil
+	}
+	return amount
+}
+
+// setProductDietary replaces a product's dietary tags, allergens and nutrition
+func setProductDietary(tx *sql.Tx, product models.Product) error {
+	_, err := tx.Exec(
+		"UPDATE products SET calories = ?, protein_g = ?, carbs_g = ?, fat_g = ? WHERE id = ?",
+		nullableID(product.Nutrition.Calories), nullableAmount(product.Nutrition.ProteinGrams),
+		nullableAmount(product.Nutrition.CarbsGrams), nullableAmount(product.Nutrition.FatGrams), product.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM product_dietary_tags WHERE product_id = ?", product.ID); err != nil {
+		return err
+	}
+	for _, tag := range product.DietaryTags {
+		if _, err := tx.Exec("INSERT INTO product_dietary_tags (product_id, tag) VALUES (?, ?)", product.ID, tag); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM product_allergens WHERE product_id = ?", product.ID); err != nil {
+		return err
+	}
+	for _, allergen := range product.Allergens {
+		if _, err := tx.Exec("INSERT INTO product_allergens (product_id, allergen) VALUES (?, ?)", product.ID, allergen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// menuWhere builds the conditions of a menu filter, to follow a WHERE clause
+// that already selects the products on the menu
+func menuWhere(filter models.MenuFilter) (string, []interface{}) {
+	var conditions string
+	var args []interface{}
+
+	if filter.Category != "" {
+		conditions += " AND c.slug = ?"
+		args = append(args, filter.Category)
+	}
+	for _, diet := range filter.Diets {
+		conditions += " AND EXISTS (SELECT 1 FROM product_dietary_tags t WHERE t.product_id = p.id AND t.tag = ?)"
+		args = append(args, diet)
+	}
+	for _, allergen := range filter.ExcludeAllergens {
+		conditions += " AND NOT EXISTS (SELECT 1 FROM product_allergens a WHERE a.product_id = p.id AND a.allergen = ?)"
+		args = append(args, allergen)
+	}
+	return conditions, args
+}
+
+// DIETARY PREFERENCE RELATED METHODS
+
+// GetDietaryPreferences retrieves a user's dietary preferences
+func (db *DB) GetDietaryPreferences(userID int) (models.DietaryPreferences, error) {
+	var prefs models.DietaryPreferences
+	var diets, allergens string
+	err := db.QueryRow(`
+		SELECT COALESCE((SELECT GROUP_CONCAT(tag) FROM user_diets WHERE user_id = u.id), ''),
+		       COALESCE((SELECT GROUP_CONCAT(allergen) FROM user_allergens WHERE user_id = u.id), ''),
+		       u.hide_incompatible
+		FROM users u WHERE u.id = ?
+	`, userID).Scan(&diets, &allergens, &prefs.HideIncompatible)
+	if err != nil {
+		return prefs, err
+	}
+
+	prefs.Diets = models.NormalizeDietaryTags(splitList(diets))
+	prefs.AvoidAllergens = models.NormalizeAllergens(splitList(allergens))
+	return prefs, nil
+}
+
+// SaveDietaryPreferences replaces a user's dietary preferences
+func (db *DB) SaveDietaryPreferences(userID int, prefs models.DietaryPreferences) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET hide_incompatible = ? WHERE id = ?", prefs.HideIncompatible, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_diets WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, tag := range prefs.Diets {
+		if _, err := tx.Exec("INSERT INTO user_diets (user_id, tag) VALUES (?, ?)", userID, tag); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_allergens WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, allergen := range prefs.AvoidAllergens {
+		if _, err := tx.Exec("INSERT INTO user_allergens (user_id, allergen) VALUES (?, ?)", userID, allergen); err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
@@ -0,0 +1,48 @@
+package database
+
+// createFavouriteTable creates the table of products users pinned as favourites
+func (db *DB) createFavouriteTable() error {
+	favouritesTable := `
+    CREATE TABLE IF NOT EXISTS favourites (
+        user_id INTEGER NOT NULL,
+        product_id INTEGER NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (user_id, product_id),
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        FOREIGN KEY (product_id) REFERENCES products(id)
+    )`
+
+	_, err := db.Exec(favouritesTable)
+	return err
+}
+
+// FAVOURITE RELATED METHODS
+
+// GetFavouriteIDs returns the IDs of the products a user pinned as favourites
+func (db *DB) GetFavouriteIDs(userID int) (map[int]bool, error) {
+	rows, err := db.Query("SELECT product_id FROM favourites WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	favourites := make(map[int]bool)
+	for rows.Next() {
+		var productID int
+		if err := rows.Scan(&productID); err != nil {
+			return nil, err
+		}
+		favourites[productID] = true
+	}
+	return favourites, rows.Err()
+}
+
+// SetFavourite pins a product to the top of a user's menu, or unpins it
+func (db *DB) SetFavourite(userID, productID int, favourite bool) error {
+	if !favourite {
+		_, err := db.Exec("DELETE FROM favourites WHERE user_id = ? AND product_id = ?", userID, productID)
+		return err
+	}
+	_, err := db.Exec("INSERT OR IGNORE INTO favourites (user_id, product_id) VALUES (?, ?)", userID, productID)
+	return err
+}
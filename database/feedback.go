@@ -0,0 +1,522 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// createFeedbackTable creates the feedback and feedback reply tables
+func (db *DB) createFeedbackTable() error {
+	feedbackTable := `
+    CREATE TABLE IF NOT EXISTS feedback (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL,
+        email TEXT NOT NULL,
+        food_quality INTEGER NOT NULL CHECK(food_quality >= 1 AND food_quality <= 5),
+        service INTEGER NOT NULL CHECK(service >= 1 AND service <= 5),
+        comments TEXT,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`
+
+	// Create feedback replies table
+	repliesTable := `
+    CREATE TABLE IF NOT EXISTS feedback_replies (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        feedback_id INTEGER NOT NULL,
+        admin_id INTEGER NOT NULL,
+        body TEXT NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (feedback_id) REFERENCES feedback(id),
+        FOREIGN KEY (admin_id) REFERENCES users(id)
+    )`
+
+	for _, table := range []string{feedbackTable, repliesTable} {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+
+	if err := db.addColumnIfMissing("feedback", "resolved_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	if err := db.addColumnIfMissing("feedback", "hidden_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	// Feedback is tied to the user who left it and, when rating an order, to
+	// the order. An order gets one row for the visit and one per rated dish,
+	// whose food_quality is the dish's rating.
+	if err := db.addColumnIfMissing("feedback", "user_id", "INTEGER REFERENCES users(id)"); err != nil {
+		return err
+	}
+
+	if err := db.addColumnIfMissing("feedback", "order_id", "INTEGER REFERENCES orders(id)"); err != nil {
+		return err
+	}
+
+	if err := db.addColumnIfMissing("feedback", "product_id", "INTEGER REFERENCES products(id)"); err != nil {
+		return err
+	}
+
+	// An order can only be rated once, and each of its dishes once
+	_, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_feedback_order
+		ON feedback(order_id, COALESCE(product_id, 0)) WHERE order_id IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+
+	// Product reviews are feedback rows with a product but no order, one per
+	// user and product. Like dish ratings their food_quality is the rating.
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_feedback_review
+		ON feedback(user_id, product_id) WHERE order_id IS NULL AND product_id IS NOT NULL`)
+	return err
+}
+
+// FEEDBACK RELATED METHODS
+
+// CreateFeedback records general feedback from a signed-in user, under the
+// name and email of their account. Each user can leave one such entry a day,
+// otherwise it fails with ErrFeedbackLimit.
+func (db *DB) CreateFeedback(userID int, comments string, foodQuality, service int) error {
+	var today int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM feedback
+		WHERE user_id = ? AND order_id IS NULL AND product_id IS NULL AND created_at >= datetime('now', '-1 day')
+	`,
+		userID,
+	).Scan(&today)
+	if err != nil {
+		return err
+	}
+
+	if today > 0 {
+		return models.ErrFeedbackLimit
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO feedback (name, email, food_quality, service, comments, user_id)
+		SELECT username, email, ?, ?, ?, id FROM users WHERE id = ?
+	`, foodQuality, service, comments, userID)
+	if err != nil {
+		return err
+	}
+
+	feedbackID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	return enqueueFeedbackEvent(db, feedbackID, "general")
+}
+
+// RateOrder records a user's rating of one of their collected orders and of
+// the dishes in it. productRatings maps product IDs to 1-5 ratings; products
+// that were not part of the order are ignored. It fails with
+// ErrOrderNotRateable unless the order is the user's and collected, and with
+// ErrAlreadyRated if it was rated before.
+func (db *DB) RateOrder(userID, orderID, foodQuality, service int, comments string, productRatings map[int]int) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	var status string
+	err = tx.QueryRow("SELECT user_id, status FROM orders WHERE id = ?", orderID).Scan(&ownerID, &status)
+	if err == sql.ErrNoRows {
+		return models.ErrOrderNotRateable
+	}
+	if err != nil {
+		return err
+	}
+
+	if ownerID != userID || status != models.OrderStatusCollected {
+		return models.ErrOrderNotRateable
+	}
+
+	var rated int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM feedback WHERE order_id = ?", orderID).Scan(&rated); err != nil {
+		return err
+	}
+	if rated > 0 {
+		return models.ErrAlreadyRated
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO feedback (name, email, food_quality, service, comments, user_id, order_id)
+		SELECT username, email, ?, ?, ?, id, ? FROM users WHERE id = ?
+	`, foodQuality, service, comments, orderID, userID)
+	if err != nil {
+		return err
+	}
+
+	feedbackID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := enqueueFeedbackEvent(tx, feedbackID, "order"); err != nil {
+		return err
+	}
+
+	// The dishes take the visit's service rating, which only the visit row counts
+	for productID, rating := range productRatings {
+		_, err = tx.Exec(`
+			INSERT INTO feedback (name, email, food_quality, service, user_id, order_id, product_id)
+			SELECT u.username, u.email, ?, ?, u.id, ?, ?
+			FROM users u
+			WHERE u.id = ? AND EXISTS (SELECT 1 FROM order_items WHERE order_id = ? AND product_id = ?)
+		`, rating, service, orderID, productID, userID, orderID, productID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetOrderFeedback retrieves the rating of an order followed by the ratings
+// of its dishes, or nothing if the order has not been rated
+func (db *DB) GetOrderFeedback(orderID int) ([]models.Feedback, error) {
+	rows, err := db.Query(
+		"SELECT "+feedbackColumns+" "+feedbackJoins+" WHERE f.order_id = ? ORDER BY f.product_id IS NOT NULL, f.id",
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feedbacks []models.Feedback
+	for rows.Next() {
+		feedback, err := scanFeedback(rows)
+		if err != nil {
+			return nil, err
+		}
+		feedbacks = append(feedbacks, feedback)
+	}
+
+	return feedbacks, rows.Err()
+}
+
+// feedbackColumns is the column list scanned by scanFeedback
+const feedbackColumns = `f.id, f.name, f.email, f.food_quality, f.service, COALESCE(f.comments, ''),
+	COALESCE(f.user_id, 0), COALESCE(f.order_id, 0), COALESCE(f.product_id, 0), COALESCE(p.name, ''),
+	f.resolved_at, f.hidden_at, f.created_at`
+
+// feedbackJoins joins the tables needed by feedbackColumns
+const feedbackJoins = `FROM feedback f
+	LEFT JOIN products p ON f.product_id = p.id`
+
+// scanFeedback scans a row selected with feedbackColumns
+func scanFeedback(row rowScanner) (models.Feedback, error) {
+	var feedback models.Feedback
+	var resolvedAt, hiddenAt sql.NullTime
+	err := row.Scan(&feedback.ID, &feedback.Name, &feedback.Email, &feedback.FoodQuality, &feedback.Service,
+		&feedback.Comments, &feedback.UserID, &feedback.OrderID, &feedback.ProductID, &feedback.ProductName,
+		&resolvedAt, &hiddenAt, &feedback.CreatedAt)
+	if resolvedAt.Valid {
+		feedback.ResolvedAt = resolvedAt.Time
+	}
+	if hiddenAt.Valid {
+		feedback.HiddenAt = hiddenAt.Time
+	}
+	return feedback, err
+}
+
+// feedbackWhere builds the WHERE clause and arguments of a feedback filter
+func feedbackWhere(filter models.FeedbackFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "f.created_at >= ?")
+		args = append(args, filter.From.UTC().Format(timeLayout))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "f.created_at < ?")
+		args = append(args, filter.To.UTC().Format(timeLayout))
+	}
+	if filter.FoodQuality > 0 {
+		conditions = append(conditions, "f.food_quality = ?")
+		args = append(args, filter.FoodQuality)
+	}
+	// Reviews and dish ratings copy a service value that rates nothing, so
+	// only feedback on a visit matches a service rating
+	if filter.Service > 0 {
+		conditions = append(conditions, "f.service = ? AND f.product_id IS NULL")
+		args = append(args, filter.Service)
+	}
+	switch filter.Kind {
+	case models.FeedbackKindGeneral:
+		conditions = append(conditions, "f.order_id IS NULL AND f.product_id IS NULL")
+	case models.FeedbackKindOrder:
+		conditions = append(conditions, "f.order_id IS NOT NULL")
+	case models.FeedbackKindReview:
+		conditions = append(conditions, "f.order_id IS NULL AND f.product_id IS NOT NULL")
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, "f.comments LIKE ? ESCAPE '\\'")
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.Search)
+		args = append(args, "%"+escaped+"%")
+	}
+
+	switch filter.Status {
+	case models.FeedbackHidden:
+		conditions = append(conditions, "f.hidden_at IS NOT NULL")
+	case models.FeedbackOpen:
+		conditions = append(conditions, "f.hidden_at IS NULL AND f.resolved_at IS NULL")
+	case models.FeedbackResolved:
+		conditions = append(conditions, "f.hidden_at IS NULL AND f.resolved_at IS NOT NULL")
+	default:
+		conditions = append(conditions, "f.hidden_at IS NULL")
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// GetFeedback retrieves one page of the feedback matching a filter, newest
+// first, with its replies, and the number of matching entries across all pages
+func (db *DB) GetFeedback(filter models.FeedbackFilter) ([]models.Feedback, int, error) {
+	where, args := feedbackWhere(filter)
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) "+feedbackJoins+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	if filter.PerPage <= 0 {
+		filter.PerPage = 20
+	}
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+
+	rows, err := db.Query(
+		"SELECT "+feedbackColumns+" "+feedbackJoins+where+" ORDER BY f.created_at DESC, f.id DESC LIMIT ? OFFSET ?",
+		append(args, filter.PerPage, (filter.Page-1)*filter.PerPage)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var feedbacks []models.Feedback
+	index := make(map[int]int)
+	for rows.Next() {
+		feedback, err := scanFeedback(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		index[feedback.ID] = len(feedbacks)
+		feedbacks = append(feedbacks, feedback)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	if len(feedbacks) == 0 {
+		return feedbacks, total, nil
+	}
+
+	// Attach the replies of the entries on this page
+	ids := make([]interface{}, 0, len(feedbacks))
+	for _, feedback := range feedbacks {
+		ids = append(ids, feedback.ID)
+	}
+	replyRows, err := db.Query(`
+		SELECT r.id, r.feedback_id, u.username, r.body, r.created_at
+		FROM feedback_replies r
+		JOIN users u ON r.admin_id = u.id
+		WHERE r.feedback_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY r.created_at, r.id
+	`, ids...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer replyRows.Close()
+
+	for replyRows.Next() {
+		var reply models.FeedbackReply
+		err := replyRows.Scan(&reply.ID, &reply.FeedbackID, &reply.AdminName, &reply.Body, &reply.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		i := index[reply.FeedbackID]
+		feedbacks[i].Replies = append(feedbacks[i].Replies, reply)
+	}
+
+	return feedbacks, total, replyRows.Err()
+}
+
+// GetFeedbackTrends averages the ratings of the feedback left between from
+// and to per day, week or month in local time, leaving out hidden feedback
+// and the per-dish ratings of orders
+func (db *DB) GetFeedbackTrends(from, to time.Time, groupBy string) ([]models.FeedbackTrend, error) {
+	rows, err := db.Query(`
+		SELECT `+periodExpression(groupBy, "f.created_at")+` AS period, COUNT(*), AVG(f.food_quality), AVG(f.service)
+		FROM feedback f
+		WHERE f.created_at >= ? AND f.created_at < ? AND f.hidden_at IS NULL AND f.product_id IS NULL
+		GROUP BY period
+		ORDER BY period
+	`, from.UTC().Format(timeLayout), to.UTC().Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trends []models.FeedbackTrend
+	for rows.Next() {
+		var trend models.FeedbackTrend
+		if err := rows.Scan(&trend.Period, &trend.Count, &trend.AvgFoodQuality, &trend.AvgService); err != nil {
+			return nil, err
+		}
+		trends = append(trends, trend)
+	}
+
+	return trends, rows.Err()
+}
+
+// SetFeedbackResolved marks feedback as resolved or reopens it
+func (db *DB) SetFeedbackResolved(id int, resolved bool) error {
+	query := "UPDATE feedback SET resolved_at = NULL WHERE id = ?"
+	if resolved {
+		query = "UPDATE feedback SET resolved_at = COALESCE(resolved_at, CURRENT_TIMESTAMP) WHERE id = ?"
+	}
+	_, err := db.Exec(query, id)
+	return err
+}
+
+// SetFeedbackHidden hides feedback as spam or shows it again
+func (db *DB) SetFeedbackHidden(id int, hidden bool) error {
+	query := "UPDATE feedback SET hidden_at = NULL WHERE id = ?"
+	if hidden {
+		query = "UPDATE feedback SET hidden_at = COALESCE(hidden_at, CURRENT_TIMESTAMP) WHERE id = ?"
+	}
+	_, err := db.Exec(query, id)
+	return err
+}
+
+// AddFeedbackReply stores an admin's reply to feedback
+func (db *DB) AddFeedbackReply(feedbackID, adminID int, body string) error {
+	_, err := db.Exec(
+		"INSERT INTO feedback_replies (feedback_id, admin_id, body) VALUES (?, ?, ?)",
+		feedbackID, adminID, body,
+	)
+	return err
+}
+
+// REVIEW RELATED METHODS
+
+// HasPurchased reports whether a user has collected an order containing a product
+func (db *DB) HasPurchased(userID, productID int) (bool, error) {
+	var purchased bool
+	err := db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM order_items oi
+			JOIN orders o ON oi.order_id = o.id
+			WHERE o.user_id = ? AND oi.product_id = ? AND o.status = ?
+		)
+	`, userID, productID, models.OrderStatusCollected).Scan(&purchased)
+	return purchased, err
+}
+
+// SaveProductReview creates or updates a user's review of a product. It
+// fails with ErrNotPurchased unless the user has collected the product.
+// Reviews hidden by an admin stay hidden when edited.
+func (db *DB) SaveProductReview(userID, productID, rating int, body string) error {
+	purchased, err := db.HasPurchased(userID, productID)
+	if err != nil {
+		return err
+	}
+	if !purchased {
+		return models.ErrNotPurchased
+	}
+
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The service column has no meaning for a review and takes the rating
+	result, err := tx.Exec(`
+		UPDATE feedback SET food_quality = ?, service = ?, comments = ?, created_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND product_id = ? AND order_id IS NULL
+	`, rating, rating, body, userID, productID)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		result, err := tx.Exec(`
+			INSERT INTO feedback (name, email, food_quality, service, comments, user_id, product_id)
+			SELECT username, email, ?, ?, ?, id, ? FROM users WHERE id = ?
+		`, rating, rating, body, productID, userID)
+		if err != nil {
+			return err
+		}
+
+		feedbackID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if err := enqueueFeedbackEvent(tx, feedbackID, "review"); err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetUserReview retrieves a user's review of a product, or nil if they have not reviewed it
+func (db *DB) GetUserReview(userID, productID int) (*models.Feedback, error) {
+	review, err := scanFeedback(db.QueryRow(
+		"SELECT "+feedbackColumns+" "+feedbackJoins+" WHERE f.user_id = ? AND f.product_id = ? AND f.order_id IS NULL",
+		userID, productID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// GetProductReviews retrieves the written reviews of a product that have not
+// been hidden, newest first
+func (db *DB) GetProductReviews(productID int) ([]models.Feedback, error) {
+	rows, err := db.Query(`
+		SELECT `+feedbackColumns+` `+feedbackJoins+`
+		WHERE f.product_id = ? AND f.order_id IS NULL AND f.hidden_at IS NULL AND COALESCE(f.comments, '') != ''
+		ORDER BY f.created_at DESC, f.id DESC
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []models.Feedback
+	for rows.Next() {
+		review, err := scanFeedback(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, rows.Err()
+}
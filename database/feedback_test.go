@@ -0,0 +1,42 @@
+package database
+
+import (
+	"auth-website/models"
+	"testing"
+)
+
+func TestFeedbackServiceFilterSkipsReviews(t *testing.T) {
+	db := newTestDB(t)
+	orderID, productID := placeTestOrder(t, db, 20, 1)
+	if err := db.UpdateOrderStatus(orderID, models.OrderStatusCollected); err != nil {
+		t.Fatalf("UpdateOrderStatus: %v", err)
+	}
+	var userID int
+	if err := db.QueryRow("SELECT user_id FROM orders WHERE id = ?", orderID).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateFeedback(userID, "Slow queue", 4, 2); err != nil {
+		t.Fatalf("CreateFeedback: %v", err)
+	}
+	if err := db.SaveProductReview(userID, productID, 5, "Lovely tea"); err != nil {
+		t.Fatalf("SaveProductReview: %v", err)
+	}
+
+	tests := []struct {
+		service int
+		want    int
+	}{
+		{2, 1},
+		{5, 0}, // The review's rating is not a service rating
+	}
+	for _, tt := range tests {
+		_, total, err := db.GetFeedback(models.FeedbackFilter{Service: tt.service})
+		if err != nil {
+			t.Fatalf("GetFeedback: %v", err)
+		}
+		if total != tt.want {
+			t.Errorf("service %d: got %d entries, want %d", tt.service, total, tt.want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+)
+
+// createStockMovementTable creates the inventory ledger
+func (db *DB) createStockMovementTable() error {
+	movementsTable := `
+    CREATE TABLE IF NOT EXISTS stock_movements (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        product_id INTEGER NOT NULL,
+        quantity_change INTEGER NOT NULL,
+        reason TEXT NOT NULL,
+        actor_id INTEGER,
+        note TEXT,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (product_id) REFERENCES products(id),
+        FOREIGN KEY (actor_id) REFERENCES users(id)
+    )`
+
+	if _, err := db.Exec(movementsTable); err != nil {
+		return err
+	}
+
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_stock_movements_product ON stock_movements(product_id, created_at)")
+	if err != nil {
+		return err
+	}
+
+	// Products that had stock before the ledger existed get an opening
+	// balance, so their ledger adds up to the stored stock
+	_, err = db.Exec(`
+		INSERT INTO stock_movements (product_id, quantity_change, reason)
+		SELECT id, stock, ? FROM products
+		WHERE stock != 0 AND id NOT IN (SELECT product_id FROM stock_movements)
+	`, models.MovementOpeningBalance)
+	return err
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// changeStock adjusts a product's stock and records why in the ledger. It
+// must be called inside the transaction that causes the change so the stock
+// and the ledger never disagree.
+func changeStock(tx execer, productID, change int, reason string, actorID int, note string) error {
+	_, err := recordStockChange(tx, productID, change, reason, actorID, note)
+	return err
+}
+
+// recordStockChange is changeStock returning the ID of the new movement, or
+// 0 when change is 0 and nothing was recorded
+func recordStockChange(tx execer, productID, change int, reason string, actorID int, note string) (int64, error) {
+	if change == 0 {
+		return 0, nil
+	}
+
+	_, err := tx.Exec("UPDATE products SET stock = stock + ? WHERE id = ?", change, productID)
+	if err != nil {
+		return 0, err
+	}
+	return recordMovement(tx, productID, change, reason, actorID, note)
+}
+
+// recordMovement adds a stock change that was already made to the ledger
+func recordMovement(tx execer, productID, change int, reason string, actorID int, note string) (int64, error) {
+	result, err := tx.Exec(
+		"INSERT INTO stock_movements (product_id, quantity_change, reason, actor_id, note) VALUES (?, ?, ?, ?, ?)",
+		productID, change, reason, nullableID(actorID), note,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// INVENTORY RELATED METHODS
+
+// AdjustStock records a manual stock change such as a restock, wastage or
+// correction. It fails with ErrInsufficientStock if stock would go negative
+// and with ErrRecipeStock for products whose stock follows their ingredients.
+func (db *DB) AdjustStock(productID, change int, reason string, actorID int, note string) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stock int
+	var hasRecipe bool
+	err = tx.QueryRow(
+		"SELECT stock, EXISTS(SELECT 1 FROM recipe_items WHERE product_id = ?) FROM products WHERE id = ?",
+		productID, productID,
+	).Scan(&stock, &hasRecipe)
+	if err != nil {
+		return err
+	}
+
+	if hasRecipe {
+		return models.ErrRecipeStock
+	}
+
+	if stock+change < 0 {
+		return models.ErrInsufficientStock
+	}
+
+	if err := changeStock(tx, productID, change, reason, actorID, note); err != nil {
+		return err
+	}
+
+	if err := changeShelfStock(tx, productID, change, reason, actorID, note); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetStockMovements retrieves a product's ledger, newest first
+func (db *DB) GetStockMovements(productID int) ([]models.StockMovement, error) {
+	rows, err := db.Query(`
+		SELECT m.id, m.product_id, m.quantity_change, m.reason, COALESCE(m.actor_id, 0),
+		       COALESCE(u.username, ''), COALESCE(m.note, ''), m.created_at
+		FROM stock_movements m
+		LEFT JOIN users u ON m.actor_id = u.id
+		WHERE m.product_id = ?
+		ORDER BY m.created_at DESC, m.id DESC
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []models.StockMovement
+	for rows.Next() {
+		var movement models.StockMovement
+		err := rows.Scan(&movement.ID, &movement.ProductID, &movement.Change, &movement.Reason, &movement.ActorID,
+			&movement.ActorName, &movement.Note, &movement.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, movement)
+	}
+
+	return movements, rows.Err()
+}
+
+// GetStockDrift recomputes every product's stock from its ledger and returns
+// the products where it differs from the stored stock
+func (db *DB) GetStockDrift() ([]models.StockDrift, error) {
+	rows, err := db.Query(`
+		SELECT p.id, p.name, p.stock, COALESCE(SUM(m.quantity_change), 0) AS ledger
+		FROM products p
+		LEFT JOIN stock_movements m ON m.product_id = p.id
+		GROUP BY p.id
+		HAVING p.stock != ledger
+		ORDER BY p.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drifts []models.StockDrift
+	for rows.Next() {
+		var drift models.StockDrift
+		if err := rows.Scan(&drift.ProductID, &drift.ProductName, &drift.Stock, &drift.LedgerStock); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, drift)
+	}
+
+	return drifts, rows.Err()
+}
+
+// createStockAlertTable creates the low-stock alerts table
+func (db *DB) createStockAlertTable() error {
+	alertsTable := `
+    CREATE TABLE IF NOT EXISTS stock_alerts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        product_id INTEGER NOT NULL,
+        stock INTEGER NOT NULL,
+        reorder_level INTEGER NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        resolved_at DATETIME,
+        FOREIGN KEY (product_id) REFERENCES products(id)
+    )`
+
+	_, err := db.Exec(alertsTable)
+	return err
+}
+
+// CheckLowStock raises an alert for every product on the menu whose stock is
+// at or below its reorder level and has no open alert yet, and resolves the
+// open alerts of products that have been restocked. It returns the newly
+// raised alerts so they can be sent out.
+func (db *DB) CheckLowStock() ([]models.StockAlert, error) {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Resolve alerts for products back above their level, or no longer sold
+	_, err = tx.Exec(`
+		UPDATE stock_alerts SET resolved_at = CURRENT_TIMESTAMP
+		WHERE resolved_at IS NULL AND product_id IN (
+			SELECT id FROM products
+			WHERE reorder_level = 0 OR stock > reorder_level OR archived_at IS NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, name, stock, reorder_level FROM products
+		WHERE archived_at IS NULL AND reorder_level > 0 AND stock <= reorder_level
+		  AND id NOT IN (SELECT product_id FROM stock_alerts WHERE resolved_at IS NULL)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var alerts []models.StockAlert
+	for rows.Next() {
+		var alert models.StockAlert
+		if err := rows.Scan(&alert.ProductID, &alert.ProductName, &alert.Stock, &alert.ReorderLevel); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, alert := range alerts {
+		result, err := tx.Exec(
+			"INSERT INTO stock_alerts (product_id, stock, reorder_level) VALUES (?, ?, ?)",
+			alert.ProductID, alert.Stock, alert.ReorderLevel,
+		)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		alerts[i].ID = int(id)
+
+		err = enqueueWebhookEvent(tx, models.HookStockLow, stockHookData{
+			AlertID:      int(id),
+			ProductID:    alert.ProductID,
+			ProductName:  alert.ProductName,
+			Stock:        alert.Stock,
+			ReorderLevel: alert.ReorderLevel,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// GetOpenStockAlerts retrieves the unresolved low-stock alerts, newest first
+func (db *DB) GetOpenStockAlerts() ([]models.StockAlert, error) {
+	rows, err := db.Query(`
+		SELECT a.id, a.product_id, p.name, a.stock, a.reorder_level, a.created_at
+		FROM stock_alerts a
+		JOIN products p ON a.product_id = p.id
+		WHERE a.resolved_at IS NULL
+		ORDER BY a.created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []models.StockAlert
+	for rows.Next() {
+		var alert models.StockAlert
+		err := rows.Scan(&alert.ID, &alert.ProductID, &alert.ProductName, &alert.Stock, &alert.ReorderLevel, &alert.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+// CountOpenStockAlerts returns the number of unresolved low-stock alerts
+func (db *DB) CountOpenStockAlerts() (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM stock_alerts WHERE resolved_at IS NULL").Scan(&count)
+	return count, err
+}
+
+// GetReorderReport lists the products on the menu at or below their reorder
+// level with a suggested quantity: the product's reorder quantity, or enough
+// to bring stock back to twice the reorder level when none is set
+func (db *DB) GetReorderReport() ([]models.ReorderLine, error) {
+	rows, err := db.Query(`
+		SELECT id, name, stock, reorder_level,
+		       CASE WHEN reorder_quantity > 0 THEN reorder_quantity ELSE 2 * reorder_level - stock END
+		FROM products
+		WHERE archived_at IS NULL AND reorder_level > 0 AND stock <= reorder_level
+		ORDER BY CAST(stock AS REAL) / reorder_level, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []models.ReorderLine
+	for rows.Next() {
+		var line models.ReorderLine
+		err := rows.Scan(&line.ProductID, &line.ProductName, &line.Stock, &line.ReorderLevel, &line.SuggestedQuantity)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
@@ -0,0 +1,431 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// createNotificationTables creates the inbox, preferences and outbox tables
+func (db *DB) createNotificationTables() error {
+	notificationsTable := `
+    CREATE TABLE IF NOT EXISTS notifications (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        event TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        body TEXT NOT NULL,
+        link TEXT NOT NULL DEFAULT '',
+        read_at DATETIME,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    )`
+
+	preferencesTable := `
+    CREATE TABLE IF NOT EXISTS notification_preferences (
+        user_id INTEGER NOT NULL,
+        event TEXT NOT NULL,
+        channel TEXT NOT NULL,
+        enabled BOOLEAN NOT NULL,
+        PRIMARY KEY (user_id, event, channel),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    )`
+
+	outboxTable := `
+    CREATE TABLE IF NOT EXISTS notification_outbox (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        channel TEXT NOT NULL,
+        recipient TEXT NOT NULL DEFAULT '',
+        event TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        body TEXT NOT NULL,
+        link TEXT NOT NULL DEFAULT '',
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        last_error TEXT NOT NULL DEFAULT '',
+        next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        sent_at DATETIME,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    )`
+
+	for _, table := range []string{notificationsTable, preferencesTable, outboxTable} {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_notification_outbox_due ON notification_outbox(status, next_attempt_at)",
+	}
+	for _, index := range indexes {
+		if _, err := db.Exec(index); err != nil {
+			return err
+		}
+	}
+
+	// Users can have notifications posted to a URL of their own, signed with a secret of their own
+	if err := db.addColumnIfMissing("users", "webhook_url", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	return db.addColumnIfMissing("users", "webhook_secret", "TEXT NOT NULL DEFAULT ''")
+}
+
+// NOTIFICATION RELATED METHODS
+
+// enqueueNotification writes a notification to the outbox once for each
+// channel the user wants the event through. Call it in the transaction that
+// makes the change, so the notification is only sent if the change sticks.
+func enqueueNotification(tx *sql.Tx, userID int, event, subject, body, link string) error {
+	var role, email, webhookURL string
+	err := tx.QueryRow("SELECT role, email, webhook_url FROM users WHERE id = ?", userID).Scan(&role, &email, &webhookURL)
+	if err != nil {
+		return err
+	}
+	// Nobody reads the walk-in account's notifications
+	if role == models.RoleWalkIn {
+		return nil
+	}
+
+	enabled, err := channelPreferences(tx, userID, event)
+	if err != nil {
+		return err
+	}
+
+	recipients := map[string]string{
+		models.ChannelInApp:   "",
+		models.ChannelEmail:   email,
+		models.ChannelWebhook: webhookURL,
+	}
+	for _, channel := range models.NotificationChannels {
+		recipient := recipients[channel]
+		if !enabled[channel] || (channel != models.ChannelInApp && recipient == "") {
+			continue
+		}
+		_, err := tx.Exec(`
+			INSERT INTO notification_outbox (user_id, channel, recipient, event, subject, body, link, status, next_attempt_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, channel, recipient, event, subject, body, link, models.OutboxPending, time.Now().UTC().Format(timeLayout))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// channelPreferences returns which channels a user wants an event through
+func channelPreferences(q querier, userID int, event string) (map[string]bool, error) {
+	enabled := make(map[string]bool)
+	for _, channel := range models.NotificationChannels {
+		enabled[channel] = models.DefaultNotificationPreference(event, channel)
+	}
+
+	rows, err := q.Query("SELECT channel, enabled FROM notification_preferences WHERE user_id = ? AND event = ?", userID, event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var channel string
+		var on bool
+		if err := rows.Scan(&channel, &on); err != nil {
+			return nil, err
+		}
+		enabled[channel] = on
+	}
+	return enabled, rows.Err()
+}
+
+// notifyOrderStatus tells the customer their order moved to a new status
+func notifyOrderStatus(tx *sql.Tx, orderID int, status string) error {
+	var userID int
+	if err := tx.QueryRow("SELECT user_id FROM orders WHERE id = ?", orderID).Scan(&userID); err != nil {
+		return err
+	}
+
+	event := models.EventOrderUpdate
+	var subject, body string
+	switch status {
+	case models.OrderStatusPreparing:
+		subject = fmt.Sprintf("Order #%d is being prepared", orderID)
+		body = "The kitchen has started on your order."
+	case models.OrderStatusReady:
+		event = models.EventOrderReady
+		subject = fmt.Sprintf("Order #%d is ready", orderID)
+		body = "Your order is ready for pickup. Show its pickup code at the counter."
+	case models.OrderStatusCollected:
+		subject = fmt.Sprintf("Order #%d collected", orderID)
+		body = "Enjoy your meal! You can rate the order from its page."
+	case models.OrderStatusCancelled:
+		subject = fmt.Sprintf("Order #%d cancelled", orderID)
+		body = "Your order was cancelled. Any refund is shown on the order page."
+	default:
+		return nil
+	}
+
+	return enqueueNotification(tx, userID, event, subject, body, "/order?id="+strconv.Itoa(orderID))
+}
+
+// notifyLowBalance warns a user when a payment takes their wallet below the
+// low balance threshold. It stays quiet while the balance stays low.
+func notifyLowBalance(tx *sql.Tx, userID int, before, after float64) error {
+	threshold, err := lowBalanceThreshold(tx)
+	if err != nil {
+		return err
+	}
+	if before < threshold || after >= threshold {
+		return nil
+	}
+
+	subject := "Your wallet balance is low"
+	body := fmt.Sprintf("Your wallet balance is down to Rs %.2f. Top up at the counter to keep paying from your wallet.", after)
+	return enqueueNotification(tx, userID, models.EventLowBalance, subject, body, "/my-orders")
+}
+
+// lowBalanceThreshold returns the wallet balance below which users are warned
+func lowBalanceThreshold(q querier) (float64, error) {
+	var value string
+	err := q.QueryRow("SELECT value FROM settings WHERE key = 'low_balance_threshold'").Scan(&value)
+	if err == sql.ErrNoRows {
+		return models.DefaultLowBalanceThreshold, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return models.DefaultLowBalanceThreshold, nil
+	}
+	return threshold, nil
+}
+
+// GetLowBalanceThreshold returns the wallet balance below which users are warned
+func (db *DB) GetLowBalanceThreshold() (float64, error) {
+	return lowBalanceThreshold(db)
+}
+
+// SetLowBalanceThreshold stores the wallet balance below which users are warned
+func (db *DB) SetLowBalanceThreshold(threshold float64) error {
+	return db.SetSetting("low_balance_threshold", strconv.FormatFloat(threshold, 'f', -1, 64))
+}
+
+// GetNotificationPreferences returns the channels a user wants each event through
+func (db *DB) GetNotificationPreferences(userID int) ([]models.EventPreferences, error) {
+	var prefs []models.EventPreferences
+	for _, event := range models.NotificationEvents {
+		enabled, err := channelPreferences(db, userID, event)
+		if err != nil {
+			return nil, err
+		}
+		prefs = append(prefs, models.EventPreferences{Event: event, Label: models.EventLabel(event), Channels: enabled})
+	}
+	return prefs, nil
+}
+
+// SetNotificationPreferences stores the channels a user wants each event
+// through and the URL their webhook notifications are posted to. Users get
+// a secret to verify the signature of their webhooks the first time they
+// set a URL. The URL is only checked to be http or https here; callers must
+// make sure it does not lead into the server's own network.
+func (db *DB) SetNotificationPreferences(userID int, enabled map[string]map[string]bool, webhookURL string) error {
+	if webhookURL != "" {
+		u, err := url.Parse(webhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return models.ErrInvalidWebhookURL
+		}
+	}
+
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, event := range models.NotificationEvents {
+		for _, channel := range models.NotificationChannels {
+			_, err := tx.Exec(`
+				INSERT INTO notification_preferences (user_id, event, channel, enabled) VALUES (?, ?, ?, ?)
+				ON CONFLICT (user_id, event, channel) DO UPDATE SET enabled = excluded.enabled
+			`, userID, event, channel, enabled[event][channel])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE users SET webhook_url = ? WHERE id = ?", webhookURL, userID); err != nil {
+		return err
+	}
+	if webhookURL != "" {
+		secret, err := randomToken("whsec_", 24)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE users SET webhook_secret = ? WHERE id = ? AND webhook_secret = ''", secret, userID); err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetUserWebhook returns the URL a user's webhook notifications are posted
+// to and the secret they are signed with
+func (db *DB) GetUserWebhook(userID int) (string, string, error) {
+	var webhookURL, secret string
+	err := db.QueryRow("SELECT webhook_url, webhook_secret FROM users WHERE id = ?", userID).Scan(&webhookURL, &secret)
+	return webhookURL, secret, err
+}
+
+// INBOX RELATED METHODS
+
+// AddNotification puts a notification in a user's in-app inbox
+func (db *DB) AddNotification(userID int, event, subject, body, link string) error {
+	_, err := db.Exec(
+		"INSERT INTO notifications (user_id, event, subject, body, link) VALUES (?, ?, ?, ?, ?)",
+		userID, event, subject, body, link,
+	)
+	return err
+}
+
+// GetNotifications returns a user's most recent in-app notifications, newest first
+func (db *DB) GetNotifications(userID, limit int) ([]models.Notification, error) {
+	rows, err := db.Query(`
+		SELECT id, user_id, event, subject, body, link, read_at, created_at
+		FROM notifications WHERE user_id = ?
+		ORDER BY id DESC LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+	for rows.Next() {
+		var n models.Notification
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Event, &n.Subject, &n.Body, &n.Link, &readAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		if readAt.Valid {
+			n.ReadAt = readAt.Time
+		}
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+// CountUnreadNotifications returns how many notifications a user has not seen
+func (db *DB) CountUnreadNotifications(userID int) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationsRead marks all of a user's notifications as seen
+func (db *DB) MarkNotificationsRead(userID int) error {
+	_, err := db.Exec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL", userID)
+	return err
+}
+
+// OUTBOX RELATED METHODS
+
+// outboxColumns is the column list scanned by scanOutboxMessage
+const outboxColumns = `o.id, o.user_id, u.username, o.channel, o.recipient, o.event, o.subject, o.body, o.link,
+	o.status, o.attempts, o.last_error, o.next_attempt_at, o.sent_at, o.created_at`
+
+// scanOutboxMessage scans a row selected with outboxColumns
+func scanOutboxMessage(row rowScanner) (models.OutboxMessage, error) {
+	var m models.OutboxMessage
+	var sentAt sql.NullTime
+	err := row.Scan(&m.ID, &m.UserID, &m.Username, &m.Channel, &m.Recipient, &m.Event, &m.Subject, &m.Body, &m.Link,
+		&m.Status, &m.Attempts, &m.LastError, &m.NextAttemptAt, &sentAt, &m.CreatedAt)
+	if sentAt.Valid {
+		m.SentAt = sentAt.Time
+	}
+	return m, err
+}
+
+// queryOutbox runs a query selecting outboxColumns
+func (db *DB) queryOutbox(query string, args ...interface{}) ([]models.OutboxMessage, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		m, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// GetDueOutboxMessages returns pending messages whose next attempt is due, oldest first
+func (db *DB) GetDueOutboxMessages(now time.Time, limit int) ([]models.OutboxMessage, error) {
+	return db.queryOutbox(
+		"SELECT "+outboxColumns+` FROM notification_outbox o JOIN users u ON o.user_id = u.id
+		WHERE o.status = ? AND o.next_attempt_at <= ? ORDER BY o.id LIMIT ?`,
+		models.OutboxPending, now.UTC().Format(timeLayout), limit,
+	)
+}
+
+// GetOutboxMessages returns the most recent outbox messages, optionally only those with a status
+func (db *DB) GetOutboxMessages(status string, limit int) ([]models.OutboxMessage, error) {
+	query := "SELECT " + outboxColumns + " FROM notification_outbox o JOIN users u ON o.user_id = u.id"
+	var args []interface{}
+	if status != "" {
+		query += " WHERE o.status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY o.id DESC LIMIT ?"
+	args = append(args, limit)
+	return db.queryOutbox(query, args...)
+}
+
+// MarkOutboxMessageSent records that a message was delivered
+func (db *DB) MarkOutboxMessageSent(id int) error {
+	_, err := db.Exec(
+		"UPDATE notification_outbox SET status = ?, attempts = attempts + 1, last_error = '', sent_at = CURRENT_TIMESTAMP WHERE id = ?",
+		models.OutboxSent, id,
+	)
+	return err
+}
+
+// MarkOutboxMessageFailed records a failed attempt at delivering a message.
+// It is retried at retryAt unless giveUp is set.
+func (db *DB) MarkOutboxMessageFailed(id int, errMsg string, retryAt time.Time, giveUp bool) error {
+	status := models.OutboxPending
+	if giveUp {
+		status = models.OutboxFailed
+	}
+	_, err := db.Exec(
+		"UPDATE notification_outbox SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		status, strings.TrimSpace(errMsg), retryAt.UTC().Format(timeLayout), id,
+	)
+	return err
+}
+
+// RetryOutboxMessage puts a failed message back in the outbox to be sent straight away
+func (db *DB) RetryOutboxMessage(id int) error {
+	_, err := db.Exec(
+		"UPDATE notification_outbox SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ? AND status = ?",
+		models.OutboxPending, time.Now().UTC().Format(timeLayout), id, models.OutboxFailed,
+	)
+	return err
+}
@@ -0,0 +1,469 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// createOptionTables creates the product variant and modifier tables and
+// records the options picked for cart and order lines
+func (db *DB) createOptionTables() error {
+	// Create product variants table. A NULL stock means the variant shares
+	// the product's stock.
+	variantsTable := `
+    CREATE TABLE IF NOT EXISTS product_variants (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        product_id INTEGER NOT NULL,
+        name TEXT NOT NULL,
+        price_delta REAL NOT NULL DEFAULT 0,
+        stock INTEGER CHECK(stock IS NULL OR stock >= 0),
+        active INTEGER NOT NULL DEFAULT 1,
+        display_order INTEGER NOT NULL DEFAULT 0,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (product_id, name),
+        FOREIGN KEY (product_id) REFERENCES products(id)
+    )`
+
+	// Create modifier groups table, max_select 0 meaning no limit
+	modifierGroupsTable := `
+    CREATE TABLE IF NOT EXISTS modifier_groups (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        product_id INTEGER NOT NULL,
+        name TEXT NOT NULL,
+        min_select INTEGER NOT NULL DEFAULT 0 CHECK(min_select >= 0),
+        max_select INTEGER NOT NULL DEFAULT 0 CHECK(max_select >= 0),
+        display_order INTEGER NOT NULL DEFAULT 0,
+        FOREIGN KEY (product_id) REFERENCES products(id)
+    )`
+
+	// Create modifiers table
+	modifiersTable := `
+    CREATE TABLE IF NOT EXISTS modifiers (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        group_id INTEGER NOT NULL,
+        name TEXT NOT NULL,
+        price REAL NOT NULL DEFAULT 0 CHECK(price >= 0),
+        active INTEGER NOT NULL DEFAULT 1,
+        FOREIGN KEY (group_id) REFERENCES modifier_groups(id)
+    )`
+
+	// Create cart item modifiers table
+	cartItemModifiersTable := `
+    CREATE TABLE IF NOT EXISTS cart_item_modifiers (
+        cart_item_id INTEGER NOT NULL,
+        modifier_id INTEGER NOT NULL,
+        PRIMARY KEY (cart_item_id, modifier_id),
+        FOREIGN KEY (cart_item_id) REFERENCES cart_items(id) ON DELETE CASCADE,
+        FOREIGN KEY (modifier_id) REFERENCES modifiers(id)
+    )`
+
+	// Create order item modifiers table, keeping the name and price ordered
+	orderItemModifiersTable := `
+    CREATE TABLE IF NOT EXISTS order_item_modifiers (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        order_item_id INTEGER NOT NULL,
+        modifier_id INTEGER NOT NULL,
+        name TEXT NOT NULL,
+        price REAL NOT NULL,
+        FOREIGN KEY (order_item_id) REFERENCES order_items(id),
+        FOREIGN KEY (modifier_id) REFERENCES modifiers(id)
+    )`
+
+	tables := []string{variantsTable, modifierGroupsTable, modifiersTable, cartItemModifiersTable, orderItemModifiersTable}
+	for _, table := range tables {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+
+	// Cart lines of the same product with different options are kept apart
+	// by their options key
+	cartColumns := []struct{ name, definition string }{
+		{"variant_id", "INTEGER REFERENCES product_variants(id)"},
+		{"options_key", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, column := range cartColumns {
+		if err := db.addColumnIfMissing("cart_items", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// Order lines keep the variant name they were ordered with
+	orderColumns := []struct{ name, definition string }{
+		{"variant_id", "INTEGER REFERENCES product_variants(id)"},
+		{"variant_name", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, column := range orderColumns {
+		if err := db.addColumnIfMissing("order_items", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// nullableStock maps a variant without its own stock to NULL
+func nullableStock(stock int, tracksStock bool) interface{} {
+	if !tracksStock {
+		return nil
+	}
+	return stock
+}
+
+// VARIANT AND MODIFIER RELATED METHODS
+
+// GetProductOptions retrieves the variants and modifier groups of a product.
+// With activeOnly set inactive variants and modifiers, and groups left
+// without modifiers, are skipped.
+func (db *DB) GetProductOptions(productID int, activeOnly bool) (models.ProductOptions, error) {
+	return getProductOptions(db, productID, activeOnly)
+}
+
+// getProductOptions is GetProductOptions for use inside a transaction
+func getProductOptions(q querier, productID int, activeOnly bool) (models.ProductOptions, error) {
+	var options models.ProductOptions
+
+	rows, err := q.Query(`
+		SELECT id, product_id, name, price_delta, COALESCE(stock, 0), stock IS NOT NULL, active, display_order, created_at
+		FROM product_variants
+		WHERE product_id = ? AND (active = 1 OR ? = 0)
+		ORDER BY display_order, id
+	`, productID, activeOnly)
+	if err != nil {
+		return options, err
+	}
+	for rows.Next() {
+		var variant models.ProductVariant
+		err := rows.Scan(&variant.ID, &variant.ProductID, &variant.Name, &variant.PriceDelta, &variant.Stock,
+			&variant.TracksStock, &variant.Active, &variant.DisplayOrder, &variant.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return options, err
+		}
+		options.Variants = append(options.Variants, variant)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return options, err
+	}
+
+	rows, err = q.Query(`
+		SELECT g.id, g.product_id, g.name, g.min_select, g.max_select, g.display_order,
+		       COALESCE(m.id, 0), COALESCE(m.name, ''), COALESCE(m.price, 0), COALESCE(m.active, 0)
+		FROM modifier_groups g
+		LEFT JOIN modifiers m ON m.group_id = g.id AND (m.active = 1 OR ? = 0)
+		WHERE g.product_id = ?
+		ORDER BY g.display_order, g.id, m.id
+	`, activeOnly, productID)
+	if err != nil {
+		return options, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var group models.ModifierGroup
+		var modifier models.Modifier
+		err := rows.Scan(&group.ID, &group.ProductID, &group.Name, &group.MinSelect, &group.MaxSelect, &group.DisplayOrder,
+			&modifier.ID, &modifier.Name, &modifier.Price, &modifier.Active)
+		if err != nil {
+			return options, err
+		}
+
+		// Rows arrive grouped, a new group starts whenever the ID changes
+		if n := len(options.Groups); n == 0 || options.Groups[n-1].ID != group.ID {
+			options.Groups = append(options.Groups, group)
+		}
+		if modifier.ID != 0 {
+			modifier.GroupID = group.ID
+			last := &options.Groups[len(options.Groups)-1]
+			last.Modifiers = append(last.Modifiers, modifier)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return options, err
+	}
+
+	if activeOnly {
+		groups := options.Groups[:0]
+		for _, group := range options.Groups {
+			if len(group.Modifiers) > 0 {
+				groups = append(groups, group)
+			}
+		}
+		options.Groups = groups
+	}
+	return options, nil
+}
+
+// CreateVariant adds a variant to a product
+func (db *DB) CreateVariant(productID int, name string, priceDelta float64, stock int, tracksStock bool, displayOrder int) error {
+	_, err := db.Exec(
+		"INSERT INTO product_variants (product_id, name, price_delta, stock, display_order) VALUES (?, ?, ?, ?, ?)",
+		productID, name, priceDelta, nullableStock(stock, tracksStock), displayOrder,
+	)
+	return err
+}
+
+// UpdateVariant saves changes to a variant
+func (db *DB) UpdateVariant(id int, name string, priceDelta float64, stock int, tracksStock bool, displayOrder int, active bool) error {
+	_, err := db.Exec(
+		"UPDATE product_variants SET name = ?, price_delta = ?, stock = ?, display_order = ?, active = ? WHERE id = ?",
+		name, priceDelta, nullableStock(stock, tracksStock), displayOrder, active, id,
+	)
+	return err
+}
+
+// CreateModifierGroup adds a modifier group to a product
+func (db *DB) CreateModifierGroup(productID int, name string, minSelect, maxSelect, displayOrder int) error {
+	_, err := db.Exec(
+		"INSERT INTO modifier_groups (product_id, name, min_select, max_select, display_order) VALUES (?, ?, ?, ?, ?)",
+		productID, name, minSelect, maxSelect, displayOrder,
+	)
+	return err
+}
+
+// UpdateModifierGroup saves changes to a modifier group
+func (db *DB) UpdateModifierGroup(id int, name string, minSelect, maxSelect, displayOrder int) error {
+	_, err := db.Exec(
+		"UPDATE modifier_groups SET name = ?, min_select = ?, max_select = ?, display_order = ? WHERE id = ?",
+		name, minSelect, maxSelect, displayOrder, id,
+	)
+	return err
+}
+
+// CreateModifier adds a modifier to a group
+func (db *DB) CreateModifier(groupID int, name string, price float64) error {
+	_, err := db.Exec("INSERT INTO modifiers (group_id, name, price) VALUES (?, ?, ?)", groupID, name, price)
+	return err
+}
+
+// UpdateModifier saves changes to a modifier
+func (db *DB) UpdateModifier(id int, name string, price float64, active bool) error {
+	_, err := db.Exec("UPDATE modifiers SET name = ?, price = ?, active = ? WHERE id = ?", name, price, active, id)
+	return err
+}
+
+// GetModifierGroupProduct returns the ID of the product a modifier group belongs to
+func (db *DB) GetModifierGroupProduct(groupID int) (int, error) {
+	var productID int
+	err := db.QueryRow("SELECT product_id FROM modifier_groups WHERE id = ?", groupID).Scan(&productID)
+	return productID, err
+}
+
+// resolvedOptions is an option selection checked against a product
+type resolvedOptions struct {
+	variant   *models.ProductVariant
+	modifiers []models.SelectedModifier
+	key       string // Identifies the selection, equal for equal selections
+}
+
+// resolveOptions checks a selection against the active options of a
+// product: a variant must be picked when the product has any, and every
+// modifier group must have between its minimum and maximum picked
+func resolveOptions(q querier, productID int, selection models.OptionSelection) (resolvedOptions, error) {
+	var resolved resolvedOptions
+
+	options, err := getProductOptions(q, productID, true)
+	if err != nil {
+		return resolved, err
+	}
+
+	if selection.VariantID != 0 || len(options.Variants) > 0 {
+		for i := range options.Variants {
+			if options.Variants[i].ID == selection.VariantID {
+				resolved.variant = &options.Variants[i]
+			}
+		}
+		if resolved.variant == nil {
+			return resolved, models.ErrInvalidOptions
+		}
+	}
+
+	picked := make(map[int]bool)
+	for _, id := range selection.ModifierIDs {
+		picked[id] = true
+	}
+	var ids []string
+	for _, group := range options.Groups {
+		count := 0
+		for _, modifier := range group.Modifiers {
+			if !picked[modifier.ID] {
+				continue
+			}
+			count++
+			delete(picked, modifier.ID)
+			resolved.modifiers = append(resolved.modifiers, models.SelectedModifier{
+				ID:    modifier.ID,
+				Name:  modifier.Name,
+				Price: modifier.Price,
+			})
+			ids = append(ids, strconv.Itoa(modifier.ID))
+		}
+		if !group.Allows(count) {
+			return resolved, models.ErrInvalidOptions
+		}
+	}
+	// Anything left over is not an active modifier of the product
+	if len(picked) > 0 {
+		return resolved, models.ErrInvalidOptions
+	}
+
+	sort.Strings(ids)
+	if resolved.variant != nil {
+		resolved.key = "v" + strconv.Itoa(resolved.variant.ID)
+	}
+	if len(ids) > 0 {
+		resolved.key += "m" + strings.Join(ids, ",")
+	}
+	return resolved, nil
+}
+
+// changeVariantStock adjusts the stock of a variant that tracks its own. It
+// is a no-op for variants sharing the product's stock and for lines without
+// a variant.
+func changeVariantStock(tx execer, variantID, change int) error {
+	if variantID == 0 || change == 0 {
+		return nil
+	}
+	_, err := tx.Exec("UPDATE product_variants SET stock = stock + ? WHERE id = ? AND stock IS NOT NULL", change, variantID)
+	return err
+}
+
+// takeVariantStock takes quantity units from a variant that tracks its own
+// stock, failing with ErrInsufficientStock if it has fewer. Checking and
+// taking in one statement keeps concurrent carts from both getting the last
+// units.
+func takeVariantStock(tx execer, variantID, quantity int) error {
+	result, err := tx.Exec(
+		"UPDATE product_variants SET stock = stock - ? WHERE id = ? AND stock IS NOT NULL AND stock >= ?",
+		quantity, variantID, quantity,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.ErrInsufficientStock
+	}
+	return nil
+}
+
+// cartLines retrieves the lines of a cart for products still on the menu,
+// with the price of each line's variant and modifiers
+func cartLines(q querier, cartID int) ([]models.CartItem, error) {
+	rows, err := q.Query(`
+		SELECT ci.id, ci.product_id, ci.quantity, p.name, p.price, COALESCE(p.image_url, ''), COALESCE(p.thumbnail_url, ''),
+		       COALESCE(ci.variant_id, 0), COALESCE(v.name, ''), COALESCE(v.price_delta, 0)
+		FROM cart_items ci
+		JOIN products p ON ci.product_id = p.id
+		LEFT JOIN product_variants v ON ci.variant_id = v.id
+		WHERE ci.cart_id = ? AND p.archived_at IS NULL
+		ORDER BY ci.id
+	`, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []models.CartItem
+	index := make(map[int]int)
+	for rows.Next() {
+		var item models.CartItem
+		var priceDelta float64
+		err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &item.Product.Name, &item.Product.Price,
+			&item.Product.ImageURL, &item.Product.ThumbnailURL, &item.VariantID, &item.VariantName, &priceDelta)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		item.Product.ID = item.ProductID
+		item.UnitPrice = item.Product.Price + priceDelta
+		index[item.ID] = len(items)
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(`
+		SELECT cim.cart_item_id, m.id, m.name, m.price
+		FROM cart_item_modifiers cim
+		JOIN modifiers m ON cim.modifier_id = m.id
+		JOIN cart_items ci ON cim.cart_item_id = ci.id
+		WHERE ci.cart_id = ?
+		ORDER BY m.group_id, m.id
+	`, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cartItemID int
+		var modifier models.SelectedModifier
+		if err := rows.Scan(&cartItemID, &modifier.ID, &modifier.Name, &modifier.Price); err != nil {
+			return nil, err
+		}
+		i, ok := index[cartItemID]
+		if !ok {
+			continue
+		}
+		items[i].Modifiers = append(items[i].Modifiers, modifier)
+		items[i].UnitPrice += modifier.Price
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		items[i].ItemTotal = items[i].UnitPrice * float64(items[i].Quantity)
+	}
+	return items, nil
+}
+
+// attachOrderItemModifiers loads the modifiers ordered with each order line
+func (db *DB) attachOrderItemModifiers(items []models.OrderItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int)
+	for i, item := range items {
+		index[item.ID] = i
+	}
+
+	rows, err := db.Query(`
+		SELECT oim.order_item_id, oim.modifier_id, oim.name, oim.price
+		FROM order_item_modifiers oim
+		JOIN order_items oi ON oim.order_item_id = oi.id
+		WHERE oi.order_id = ?
+		ORDER BY oim.id
+	`, items[0].OrderID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderItemID int
+		var modifier models.SelectedModifier
+		if err := rows.Scan(&orderItemID, &modifier.ID, &modifier.Name, &modifier.Price); err != nil {
+			return err
+		}
+		if i, ok := index[orderItemID]; ok {
+			items[i].Modifiers = append(items[i].Modifiers, modifier)
+		}
+	}
+	return rows.Err()
+}
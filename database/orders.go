@@ -0,0 +1,722 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayout matches the format SQLite uses for CURRENT_TIMESTAMP
+const timeLayout = "2006-01-02 15:04:05"
+
+// Default number of minutes before pickup that a scheduled order is shown to the kitchen
+const DefaultKitchenLeadMinutes = 30
+
+// createOrderTables creates the orders, order items, pickup slots and settings tables
+func (db *DB) createOrderTables() error {
+	// Create pickup slots table
+	pickupSlotsTable := `
+    CREATE TABLE IF NOT EXISTS pickup_slots (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        label TEXT NOT NULL,
+        start_time TEXT NOT NULL,
+        end_time TEXT NOT NULL,
+        capacity INTEGER NOT NULL CHECK(capacity >= 0),
+        active INTEGER NOT NULL DEFAULT 1,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`
+
+	// Create orders table
+	ordersTable := `
+    CREATE TABLE IF NOT EXISTS orders (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        total_price REAL NOT NULL DEFAULT 0,
+        pickup_slot_id INTEGER,
+        pickup_at DATETIME,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        FOREIGN KEY (pickup_slot_id) REFERENCES pickup_slots(id)
+    )`
+
+	// Create order items table
+	orderItemsTable := `
+    CREATE TABLE IF NOT EXISTS order_items (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        order_id INTEGER NOT NULL,
+        product_id INTEGER NOT NULL,
+        product_name TEXT NOT NULL,
+        quantity INTEGER NOT NULL,
+        unit_price REAL NOT NULL,
+        FOREIGN KEY (order_id) REFERENCES orders(id),
+        FOREIGN KEY (product_id) REFERENCES products(id)
+    )`
+
+	// Create settings table for values admins can change at runtime
+	settingsTable := `
+    CREATE TABLE IF NOT EXISTS settings (
+        key TEXT PRIMARY KEY,
+        value TEXT NOT NULL
+    )`
+
+	for _, table := range []string{pickupSlotsTable, ordersTable, orderItemsTable, settingsTable} {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+
+	// Orders remember when the stock they used was taken off the shelves so
+	// it only happens once. The column was first added as ingredients_used_at.
+	oldColumn, err := db.columnExists("orders", "ingredients_used_at")
+	if err != nil {
+		return err
+	}
+	if oldColumn {
+		if _, err := db.Exec("ALTER TABLE orders RENAME COLUMN ingredients_used_at TO fulfilled_at"); err != nil {
+			return err
+		}
+	}
+	return db.addColumnIfMissing("orders", "fulfilled_at", "DATETIME")
+}
+
+// SETTINGS RELATED METHODS
+
+// GetSetting returns the value stored for key, or def if it has not been set
+func (db *DB) GetSetting(key, def string) (string, error) {
+	var value string
+	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return def, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// SetSetting stores value under key, replacing any previous value
+func (db *DB) SetSetting(key, value string) error {
+	_, err := db.Exec(
+		"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value",
+		key, value,
+	)
+	return err
+}
+
+// GetKitchenLeadTime returns how long before pickup scheduled orders are shown to the kitchen
+func (db *DB) GetKitchenLeadTime() (time.Duration, error) {
+	value, err := db.GetSetting("kitchen_lead_minutes", strconv.Itoa(DefaultKitchenLeadMinutes))
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.Atoi(value)
+	if err != nil {
+		minutes = DefaultKitchenLeadMinutes
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// SetKitchenLeadTime stores the kitchen lead time in whole minutes
+func (db *DB) SetKitchenLeadTime(minutes int) error {
+	return db.SetSetting("kitchen_lead_minutes", strconv.Itoa(minutes))
+}
+
+// PICKUP SLOT RELATED METHODS
+
+// CreatePickupSlot creates a new daily pickup slot
+func (db *DB) CreatePickupSlot(label, startTime, endTime string, capacity int) error {
+	_, err := db.Exec(
+		"INSERT INTO pickup_slots (label, start_time, end_time, capacity) VALUES (?, ?, ?, ?)",
+		label, startTime, endTime, capacity,
+	)
+	return err
+}
+
+// UpdatePickupSlot updates an existing pickup slot
+func (db *DB) UpdatePickupSlot(id int, label, startTime, endTime string, capacity int, active bool) error {
+	_, err := db.Exec(
+		"UPDATE pickup_slots SET label = ?, start_time = ?, end_time = ?, capacity = ?, active = ? WHERE id = ?",
+		label, startTime, endTime, capacity, active, id,
+	)
+	return err
+}
+
+// SetPickupSlotActive enables or disables a pickup slot
+func (db *DB) SetPickupSlotActive(id int, active bool) error {
+	_, err := db.Exec("UPDATE pickup_slots SET active = ? WHERE id = ?", active, id)
+	return err
+}
+
+// GetPickupSlots retrieves all pickup slots with the number of orders booked on the given day
+func (db *DB) GetPickupSlots(day time.Time) ([]models.PickupSlot, error) {
+	from, to := dayBounds(day)
+	rows, err := db.Query(`
+		SELECT s.id, s.label, s.start_time, s.end_time, s.capacity, s.active, s.created_at,
+		       (SELECT COUNT(*) FROM orders o
+		        WHERE o.pickup_slot_id = s.id AND o.status != ? AND o.pickup_at >= ? AND o.pickup_at < ?)
+		FROM pickup_slots s
+		ORDER BY s.start_time
+	`, models.OrderStatusCancelled, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var slots []models.PickupSlot
+	for rows.Next() {
+		var slot models.PickupSlot
+		err := rows.Scan(&slot.ID, &slot.Label, &slot.StartTime, &slot.EndTime, &slot.Capacity, &slot.Active, &slot.CreatedAt, &slot.Booked)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, slot)
+	}
+
+	return slots, rows.Err()
+}
+
+// GetAvailablePickupSlots retrieves the active slots that can still be booked for today
+func (db *DB) GetAvailablePickupSlots(now time.Time) ([]models.PickupSlot, error) {
+	slots, err := db.GetPickupSlots(now)
+	if err != nil {
+		return nil, err
+	}
+
+	var available []models.PickupSlot
+	for _, slot := range slots {
+		pickupAt, err := slotTime(now, slot.StartTime)
+		if err != nil || !slot.Active || !pickupAt.After(now) {
+			continue
+		}
+		available = append(available, slot)
+	}
+	return available, nil
+}
+
+// dayBounds returns the UTC timestamps delimiting the local calendar day containing t
+func dayBounds(t time.Time) (string, string) {
+	local := t.Local()
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 1)
+	return start.UTC().Format(timeLayout), end.UTC().Format(timeLayout)
+}
+
+// slotTime returns the moment on the same local day as day at which a slot starting at hhmm begins
+func slotTime(day time.Time, hhmm string) (time.Time, error) {
+	clock, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, err
+	}
+	local := day.Local()
+	return time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local), nil
+}
+
+// ORDER RELATED METHODS
+
+// checkout describes how a cart is turned into an order
+type checkout struct {
+	cartUserID    int // Owner of the cart the order is made from
+	customerID    int // User the order is for
+	cashierID     int // Staff member who took a counter order, 0 for online orders
+	shiftID       int // Cashier shift a counter order is taken in
+	slotID        int
+	paymentMethod string
+	tendered      float64 // Cash handed over for a counter order
+}
+
+// PlaceOrder turns the user's cart into an order. The stock was already
+// reserved when the items were added to the cart, so it is not touched here.
+// A slotID of 0 places an order for immediate preparation; otherwise the
+// order is held as scheduled for today's occurrence of the slot. Orders paid
+// from the wallet are debited from it straight away.
+func (db *DB) PlaceOrder(userID, slotID int, paymentMethod string, now time.Time) (int, error) {
+	return db.placeOrder(checkout{
+		cartUserID:    userID,
+		customerID:    userID,
+		slotID:        slotID,
+		paymentMethod: paymentMethod,
+	}, now)
+}
+
+// placeOrder turns a cart into an order as described by c
+func (db *DB) placeOrder(c checkout, now time.Time) (int, error) {
+	userID, slotID := c.customerID, c.slotID
+
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var cartID int
+	err = tx.QueryRow("SELECT id FROM carts WHERE user_id = ?", c.cartUserID).Scan(&cartID)
+	if err == sql.ErrNoRows {
+		return 0, models.ErrEmptyCart
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Collect cart items with current prices
+	lines, err := cartLines(tx, cartID)
+	if err != nil {
+		return 0, err
+	}
+	var items []models.OrderItem
+	var total float64
+	for _, line := range lines {
+		items = append(items, models.OrderItem{
+			ProductID:   line.ProductID,
+			ProductName: line.Product.Name,
+			VariantID:   line.VariantID,
+			VariantName: line.VariantName,
+			Modifiers:   line.Modifiers,
+			Quantity:    line.Quantity,
+			UnitPrice:   line.UnitPrice,
+		})
+		total += line.ItemTotal
+	}
+	if len(items) == 0 {
+		return 0, models.ErrEmptyCart
+	}
+
+	switch c.paymentMethod {
+	case models.PaymentWallet:
+		balance, err := walletBalance(tx, userID)
+		if err != nil {
+			return 0, err
+		}
+		if balance < total {
+			return 0, models.ErrInsufficientBalance
+		}
+	case models.PaymentCash:
+		if c.tendered < total {
+			return 0, models.ErrInsufficientTender
+		}
+	}
+
+	var orderID int64
+	if slotID == 0 {
+		result, err := tx.Exec(
+			"INSERT INTO orders (user_id, status, total_price, payment_method, cashier_id, tendered, shift_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			userID, models.OrderStatusPending, total, c.paymentMethod, nullableID(c.cashierID), c.tendered, nullableID(c.shiftID),
+		)
+		if err != nil {
+			return 0, err
+		}
+		orderID, err = result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		var startTime string
+		var capacity int
+		var active bool
+		err = tx.QueryRow("SELECT start_time, capacity, active FROM pickup_slots WHERE id = ?", slotID).Scan(&startTime, &capacity, &active)
+		if err == sql.ErrNoRows {
+			return 0, models.ErrSlotUnavailable
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		pickupAt, err := slotTime(now, startTime)
+		if err != nil || !active || !pickupAt.After(now) {
+			return 0, models.ErrSlotUnavailable
+		}
+
+		// Insert only while the slot still has room, so two concurrent
+		// checkouts cannot both take the last place
+		from, to := dayBounds(now)
+		result, err := tx.Exec(`
+			INSERT INTO orders (user_id, status, total_price, payment_method, pickup_slot_id, pickup_at)
+			SELECT ?, ?, ?, ?, ?, ?
+			WHERE (SELECT COUNT(*) FROM orders
+			       WHERE pickup_slot_id = ? AND status != ? AND pickup_at >= ? AND pickup_at < ?) < ?
+		`, userID, models.OrderStatusScheduled, total, c.paymentMethod, slotID, pickupAt.UTC().Format(timeLayout),
+			slotID, models.OrderStatusCancelled, from, to, capacity)
+		if err != nil {
+			return 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if affected == 0 {
+			return 0, models.ErrSlotFull
+		}
+		orderID, err = result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, item := range items {
+		result, err := tx.Exec(
+			"INSERT INTO order_items (order_id, product_id, product_name, quantity, unit_price, variant_id, variant_name) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			orderID, item.ProductID, item.ProductName, item.Quantity, item.UnitPrice, nullableID(item.VariantID), item.VariantName,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		orderItemID, err := result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		for _, modifier := range item.Modifiers {
+			_, err = tx.Exec(
+				"INSERT INTO order_item_modifiers (order_item_id, modifier_id, name, price) VALUES (?, ?, ?, ?)",
+				orderItemID, modifier.ID, modifier.Name, modifier.Price,
+			)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// The units reserved by the cart are now sold. Stock does not change, but
+	// the ledger shows the reservation turning into a sale.
+	note := "Order #" + strconv.FormatInt(orderID, 10)
+	for _, item := range items {
+		if err := changeStock(tx, item.ProductID, item.Quantity, models.MovementCartRelease, c.cartUserID, note); err != nil {
+			return 0, err
+		}
+		if err := changeStock(tx, item.ProductID, -item.Quantity, models.MovementSale, c.cartUserID, note); err != nil {
+			return 0, err
+		}
+	}
+
+	switch c.paymentMethod {
+	case models.PaymentWallet:
+		balance, err := walletBalance(tx, userID)
+		if err != nil {
+			return 0, err
+		}
+		if err := addWalletTransaction(tx, userID, -total, models.WalletPayment, int(orderID), c.cartUserID, note); err != nil {
+			return 0, err
+		}
+		if err := notifyLowBalance(tx, userID, balance, balance-total); err != nil {
+			return 0, err
+		}
+	case models.PaymentCash:
+		// The drawer keeps the total, the rest of the cash tendered is handed back
+		if err := addCashMovement(tx, c.shiftID, total, models.CashSale, int(orderID), c.cashierID, note); err != nil {
+			return 0, err
+		}
+	}
+
+	// Empty the cart without returning stock, it now belongs to the order
+	_, err = tx.Exec("DELETE FROM cart_items WHERE cart_id = ?", cartID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := enqueueOrderEvent(tx, models.HookOrderPlaced, int(orderID)); err != nil {
+		return 0, err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(orderID), nil
+}
+
+// orderColumns is the column list scanned by scanOrder
+const orderColumns = `o.id, o.user_id, u.username, o.status, o.total_price,
+	COALESCE(o.pickup_slot_id, 0), COALESCE(s.label, ''), o.pickup_at, o.payment_method,
+	(SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE order_id = o.id),
+	o.cancelled_at, o.cancel_reason, COALESCE(o.cashier_id, 0), COALESCE(cashier.username, ''), o.tendered,
+	COALESCE(o.shift_id, 0), o.collected_at, COALESCE(collector.username, ''), o.created_at`
+
+// orderJoins joins the tables needed by orderColumns
+const orderJoins = `FROM orders o
+	JOIN users u ON o.user_id = u.id
+	LEFT JOIN pickup_slots s ON o.pickup_slot_id = s.id
+	LEFT JOIN users cashier ON o.cashier_id = cashier.id
+	LEFT JOIN users collector ON o.collected_by = collector.id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOrder scans a row selected with orderColumns
+func scanOrder(row rowScanner) (models.Order, error) {
+	var order models.Order
+	var pickupAt, cancelledAt, collectedAt sql.NullTime
+	err := row.Scan(&order.ID, &order.UserID, &order.Username, &order.Status, &order.TotalPrice,
+		&order.PickupSlotID, &order.PickupSlotLabel, &pickupAt, &order.PaymentMethod,
+		&order.RefundedTotal, &cancelledAt, &order.CancelReason, &order.CashierID, &order.CashierName,
+		&order.Tendered, &order.ShiftID, &collectedAt, &order.CollectedByName, &order.CreatedAt)
+	if pickupAt.Valid {
+		order.PickupAt = pickupAt.Time
+	}
+	if cancelledAt.Valid {
+		order.CancelledAt = cancelledAt.Time
+	}
+	if collectedAt.Valid {
+		order.CollectedAt = collectedAt.Time
+	}
+	return order, err
+}
+
+// GetOrderByID retrieves an order and its items
+func (db *DB) GetOrderByID(id int) (*models.Order, error) {
+	order, err := scanOrder(db.QueryRow("SELECT "+orderColumns+" "+orderJoins+" WHERE o.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	order.Items, err = db.getOrderItems(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// getOrderItems retrieves the items of an order
+func (db *DB) getOrderItems(orderID int) ([]models.OrderItem, error) {
+	rows, err := db.Query(
+		`SELECT i.id, i.order_id, i.product_id, i.product_name, i.quantity, i.unit_price, COALESCE(i.variant_id, 0), i.variant_name,
+			(SELECT COALESCE(SUM(quantity), 0) FROM refunds WHERE order_item_id = i.id)
+		FROM order_items i WHERE i.order_id = ? ORDER BY i.id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []models.OrderItem
+	for rows.Next() {
+		var item models.OrderItem
+		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.ProductName, &item.Quantity, &item.UnitPrice,
+			&item.VariantID, &item.VariantName, &item.Refunded)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		item.ItemTotal = item.UnitPrice * float64(item.Quantity)
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := db.attachOrderItemModifiers(items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ReleaseScheduledOrders moves scheduled orders whose pickup time is within
+// leadTime of now into the kitchen queue
+func (db *DB) ReleaseScheduledOrders(now time.Time, leadTime time.Duration) error {
+	_, err := db.Exec(
+		"UPDATE orders SET status = ? WHERE status = ? AND pickup_at <= ?",
+		models.OrderStatusPending, models.OrderStatusScheduled, now.Add(leadTime).UTC().Format(timeLayout),
+	)
+	return err
+}
+
+// GetKitchenOrders retrieves the orders the kitchen still has to prepare or
+// hand over, after releasing scheduled orders that are due
+func (db *DB) GetKitchenOrders(now time.Time, leadTime time.Duration) ([]models.Order, error) {
+	if err := db.ReleaseScheduledOrders(now, leadTime); err != nil {
+		return nil, err
+	}
+
+	return db.queryOrders(
+		"SELECT "+orderColumns+" "+orderJoins+` WHERE o.status IN (?, ?, ?)
+		ORDER BY COALESCE(o.pickup_at, o.created_at)`,
+		models.OrderStatusPending, models.OrderStatusPreparing, models.OrderStatusReady,
+	)
+}
+
+// GetUserOrders retrieves a user's most recent orders with their items, newest first
+func (db *DB) GetUserOrders(userID, limit int) ([]models.Order, error) {
+	return db.queryOrders(
+		"SELECT "+orderColumns+" "+orderJoins+" WHERE o.user_id = ? ORDER BY o.created_at DESC, o.id DESC LIMIT ?",
+		userID, limit,
+	)
+}
+
+// queryOrders runs a query selecting orderColumns and loads the items of each order
+func (db *DB) queryOrders(query string, args ...interface{}) ([]models.Order, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		orders[i].Items, err = db.getOrderItems(orders[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+// Reorder adds the lines of a past order to the user's cart again with the
+// same options. Each line is added on its own, so lines that are out of
+// stock or no longer offered are reported without stopping the others.
+func (db *DB) Reorder(userID int, order *models.Order) ([]models.ReorderedItem, error) {
+	var lines []models.ReorderedItem
+	for _, item := range order.Items {
+		line := models.ReorderedItem{Item: item, Outcome: models.ReorderAdded}
+
+		selection := models.OptionSelection{VariantID: item.VariantID}
+		for _, modifier := range item.Modifiers {
+			selection.ModifierIDs = append(selection.ModifierIDs, modifier.ID)
+		}
+
+		err := db.AddToCart(userID, item.ProductID, item.Quantity, selection)
+		switch err {
+		case nil:
+			line.UnitPrice, err = db.currentUnitPrice(item.ProductID, selection)
+			if err != nil {
+				return nil, err
+			}
+		case models.ErrInsufficientStock:
+			line.Outcome = models.ReorderOutOfStock
+		case models.ErrProductUnavailable, models.ErrInvalidOptions:
+			line.Outcome = models.ReorderUnavailable
+		default:
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// currentUnitPrice returns what one unit of a product with the selected options costs now
+func (db *DB) currentUnitPrice(productID int, selection models.OptionSelection) (float64, error) {
+	var price float64
+	if err := db.QueryRow("SELECT price FROM products WHERE id = ?", productID).Scan(&price); err != nil {
+		return 0, err
+	}
+
+	options, err := resolveOptions(db, productID, selection)
+	if err != nil {
+		return 0, err
+	}
+	if options.variant != nil {
+		price += options.variant.PriceDelta
+	}
+	for _, modifier := range options.modifiers {
+		price += modifier.Price
+	}
+	return price, nil
+}
+
+// orderStatusSources lists the statuses an order can be moved to each
+// kitchen status from. Orders only move forward; scheduled and cancelled
+// orders are never moved by the kitchen.
+var orderStatusSources = map[string][]string{
+	models.OrderStatusPreparing: {models.OrderStatusPending},
+	models.OrderStatusReady:     {models.OrderStatusPending, models.OrderStatusPreparing},
+	models.OrderStatusCollected: {models.OrderStatusPending, models.OrderStatusPreparing, models.OrderStatusReady},
+}
+
+// UpdateOrderStatus moves an order forward in the kitchen workflow and
+// notifies the customer. Once an order is ready or collected the stock it
+// used is taken off the shelves. Setting the status an order already has is
+// a no-op; any other move that is not forward fails with
+// ErrInvalidStatusChange, and an unknown order with sql.ErrNoRows.
+func (db *DB) UpdateOrderStatus(id int, status string) error {
+	sources, ok := orderStatusSources[status]
+	if !ok {
+		return models.ErrInvalidStatusChange
+	}
+
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The status check in the update stops a move from a status that changed meanwhile
+	args := []interface{}{status, id}
+	for _, source := range sources {
+		args = append(args, source)
+	}
+	result, err := tx.Exec(
+		"UPDATE orders SET status = ? WHERE id = ? AND status IN (?"+strings.Repeat(", ?", len(sources)-1)+")",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	if changed, err := result.RowsAffected(); err != nil {
+		return err
+	} else if changed == 0 {
+		var current string
+		if err := tx.QueryRow("SELECT status FROM orders WHERE id = ?", id).Scan(&current); err != nil {
+			return err
+		}
+		if current == status {
+			return nil
+		}
+		return models.ErrInvalidStatusChange
+	}
+
+	if err := notifyOrderStatus(tx, id, status); err != nil {
+		return err
+	}
+	if status == models.OrderStatusReady {
+		if err := enqueueOrderEvent(tx, models.HookOrderReady, id); err != nil {
+			return err
+		}
+	}
+
+	if status == models.OrderStatusReady || status == models.OrderStatusCollected {
+		if err := fulfilOrder(tx, id); err != nil {
+			return err
+		}
+	}
+
+	if err := syncRecipeStock(tx); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// fulfilOrder takes the stock an order used off the shelves: the ingredients
+// of its recipe products and units of its other products from their batches.
+// It is a no-op for an order that was already fulfilled.
+func fulfilOrder(tx *sql.Tx, orderID int) error {
+	result, err := tx.Exec("UPDATE orders SET fulfilled_at = CURRENT_TIMESTAMP WHERE id = ? AND fulfilled_at IS NULL", orderID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return err
+	}
+
+	if err := consumeOrderIngredients(tx, orderID); err != nil {
+		return err
+	}
+	return consumeOrderBatches(tx, orderID)
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+// placeTestOrder puts quantity units of a new product with the given stock
+// in a new user's cart and orders them, returning the order and product IDs
+func placeTestOrder(t *testing.T, db *DB, stock, quantity int) (orderID, productID int) {
+	t.Helper()
+
+	userID := createTestUser(t, db, "alice")
+	productID = createTestProduct(t, db, "Tea", stock)
+	if err := db.AddToCart(userID, productID, quantity, models.OptionSelection{}); err != nil {
+		t.Fatalf("AddToCart: %v", err)
+	}
+	orderID, err := db.PlaceOrder(userID, 0, models.PaymentCard, time.Now())
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	return orderID, productID
+}
+
+// adminID returns the ID of the default admin
+func adminID(t *testing.T, db *DB) int {
+	t.Helper()
+
+	admin, err := db.GetUserByUsername("admin")
+	if err != nil {
+		t.Fatalf("GetUserByUsername(admin): %v", err)
+	}
+	return admin.ID
+}
+
+// orderStatus returns an order's status
+func orderStatus(t *testing.T, db *DB, orderID int) string {
+	t.Helper()
+
+	var status string
+	if err := db.QueryRow("SELECT status FROM orders WHERE id = ?", orderID).Scan(&status); err != nil {
+		t.Fatalf("order %d status: %v", orderID, err)
+	}
+	return status
+}
+
+// batchStock returns the units left in a product's batches
+func batchStock(t *testing.T, db *DB, productID int) int {
+	t.Helper()
+
+	var remaining int
+	err := db.QueryRow("SELECT COALESCE(SUM(quantity_remaining), 0) FROM stock_batches WHERE product_id = ?", productID).Scan(&remaining)
+	if err != nil {
+		t.Fatalf("product %d batches: %v", productID, err)
+	}
+	return remaining
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     []string // Moves made before the one tested
+		cancel     bool     // Cancel the order before the move
+		status     string
+		wantErr    error
+		wantStatus string
+	}{
+		{"pending to preparing", nil, false, models.OrderStatusPreparing, nil, models.OrderStatusPreparing},
+		{"pending to ready", nil, false, models.OrderStatusReady, nil, models.OrderStatusReady},
+		{"preparing to ready", []string{models.OrderStatusPreparing}, false, models.OrderStatusReady, nil, models.OrderStatusReady},
+		{"ready to collected", []string{models.OrderStatusReady}, false, models.OrderStatusCollected, nil, models.OrderStatusCollected},
+		{"ready again", []string{models.OrderStatusReady}, false, models.OrderStatusReady, nil, models.OrderStatusReady},
+		{"ready back to preparing", []string{models.OrderStatusReady}, false, models.OrderStatusPreparing, models.ErrInvalidStatusChange, models.OrderStatusReady},
+		{"collected back to ready", []string{models.OrderStatusCollected}, false, models.OrderStatusReady, models.ErrInvalidStatusChange, models.OrderStatusCollected},
+		{"cancelled to ready", nil, true, models.OrderStatusReady, models.ErrInvalidStatusChange, models.OrderStatusCancelled},
+		{"cancelled to collected", nil, true, models.OrderStatusCollected, models.ErrInvalidStatusChange, models.OrderStatusCancelled},
+		{"back to pending", []string{models.OrderStatusPreparing}, false, models.OrderStatusPending, models.ErrInvalidStatusChange, models.OrderStatusPreparing},
+		{"unknown status", nil, false, "lost", models.ErrInvalidStatusChange, models.OrderStatusPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			orderID, _ := placeTestOrder(t, db, 20, 3)
+
+			for _, status := range tt.before {
+				if err := db.UpdateOrderStatus(orderID, status); err != nil {
+					t.Fatalf("UpdateOrderStatus(%q): %v", status, err)
+				}
+			}
+			if tt.cancel {
+				if err := db.CancelOrder(orderID, adminID(t, db), true, "test", ""); err != nil {
+					t.Fatalf("CancelOrder: %v", err)
+				}
+			}
+
+			if err := db.UpdateOrderStatus(orderID, tt.status); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got := orderStatus(t, db, orderID); got != tt.wantStatus {
+				t.Errorf("status = %q, want %q", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderStatusMissingOrder(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.UpdateOrderStatus(1, models.OrderStatusReady); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("got error %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestCancelledOrderKeepsBatchesInStep(t *testing.T) {
+	db := newTestDB(t)
+	orderID, productID := placeTestOrder(t, db, 20, 3)
+
+	if err := db.CancelOrder(orderID, adminID(t, db), true, "test", ""); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if err := db.UpdateOrderStatus(orderID, models.OrderStatusReady); !errors.Is(err, models.ErrInvalidStatusChange) {
+		t.Fatalf("UpdateOrderStatus on a cancelled order: got error %v, want %v", err, models.ErrInvalidStatusChange)
+	}
+
+	// The cancellation put the units back, and nothing may take them again
+	if got := productStock(t, db, productID); got != 20 {
+		t.Errorf("stock = %d, want 20", got)
+	}
+	if got := batchStock(t, db, productID); got != 20 {
+		t.Errorf("batches hold %d, want 20", got)
+	}
+}
+
+func TestRefundedMissingUnitsKeepBatchesInStep(t *testing.T) {
+	tests := []struct {
+		name      string
+		then      func(db *DB, orderID int) error
+		wantStock int
+	}{
+		{
+			name: "cancelled",
+			then: func(db *DB, orderID int) error {
+				return db.CancelOrder(orderID, adminID(t, db), true, "test", "")
+			},
+			wantStock: 19, // 20, less the missing unit
+		},
+		{
+			name: "fulfilled",
+			then: func(db *DB, orderID int) error {
+				return db.UpdateOrderStatus(orderID, models.OrderStatusReady)
+			},
+			wantStock: 17, // 20, less the 3 units ordered
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			orderID, productID := placeTestOrder(t, db, 20, 3)
+
+			var itemID int
+			if err := db.QueryRow("SELECT id FROM order_items WHERE order_id = ?", orderID).Scan(&itemID); err != nil {
+				t.Fatalf("order item: %v", err)
+			}
+			if err := db.RefundOrderItem(orderID, itemID, 1, adminID(t, db), "", "missing"); err != nil {
+				t.Fatalf("RefundOrderItem: %v", err)
+			}
+			if err := tt.then(db, orderID); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+
+			if got := productStock(t, db, productID); got != tt.wantStock {
+				t.Errorf("stock = %d, want %d", got, tt.wantStock)
+			}
+			if got := batchStock(t, db, productID); got != tt.wantStock {
+				t.Errorf("batches hold %d, want %d", got, tt.wantStock)
+			}
+		})
+	}
+}
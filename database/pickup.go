@@ -0,0 +1,172 @@
+package database
+
+import (
+	"auth-website/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// pickupCodePrefix starts every pickup code, so stray scans are easy to tell apart
+const pickupCodePrefix = "ORDER"
+
+// pickupEncoding writes nonces and signatures in characters that survive
+// scanners typing them in either case
+var pickupEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// createPickupTables adds the pickup verification columns to orders
+func (db *DB) createPickupTables() error {
+	columns := []struct{ name, definition string }{
+		{"pickup_nonce", "TEXT NOT NULL DEFAULT ''"},
+		{"collected_at", "DATETIME"},
+		{"collected_by", "INTEGER REFERENCES users(id)"},
+	}
+	for _, column := range columns {
+		if err := db.addColumnIfMissing("orders", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// The key never changes once created, so it is read once here rather
+	// than for every code shown or scanned
+	key, err := db.loadPickupSecret()
+	if err != nil {
+		return err
+	}
+	db.pickupKey = key
+	return nil
+}
+
+// PICKUP VERIFICATION RELATED METHODS
+
+// loadPickupSecret returns the key pickup codes are signed with, creating it
+// on a new database
+func (db *DB) loadPickupSecret() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	// Keeps the existing secret if another request created it first
+	if _, err := db.Exec("INSERT OR IGNORE INTO settings (key, value) VALUES ('pickup_secret', ?)", hex.EncodeToString(key)); err != nil {
+		return nil, err
+	}
+
+	value, err := db.GetSetting("pickup_secret", "")
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(value)
+}
+
+// signPickup returns the signature of an order's pickup code
+func signPickup(secret []byte, orderID int, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.Itoa(orderID) + "." + nonce))
+	return pickupEncoding.EncodeToString(mac.Sum(nil)[:10])
+}
+
+// GetPickupCode returns the signed code that identifies an order at the
+// pickup counter, giving the order its random nonce if it has none yet
+func (db *DB) GetPickupCode(orderID int) (string, error) {
+	random := make([]byte, 5)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	_, err := db.Exec("UPDATE orders SET pickup_nonce = ? WHERE id = ? AND pickup_nonce = ''", pickupEncoding.EncodeToString(random), orderID)
+	if err != nil {
+		return "", err
+	}
+
+	var nonce string
+	if err := db.QueryRow("SELECT pickup_nonce FROM orders WHERE id = ?", orderID).Scan(&nonce); err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{pickupCodePrefix, strconv.Itoa(orderID), nonce, signPickup(db.pickupKey, orderID, nonce)}, "-"), nil
+}
+
+// VerifyPickupCode returns the order a pickup code was issued for. It fails
+// with ErrInvalidPickupCode if the code is malformed, its signature does not
+// match or it was issued for another copy of the order.
+func (db *DB) VerifyPickupCode(code string) (*models.Order, error) {
+	parts := strings.Split(strings.ToUpper(strings.TrimSpace(code)), "-")
+	if len(parts) != 4 || parts[0] != pickupCodePrefix {
+		return nil, models.ErrInvalidPickupCode
+	}
+	orderID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, models.ErrInvalidPickupCode
+	}
+	nonce, signature := parts[2], parts[3]
+
+	if !hmac.Equal([]byte(signature), []byte(signPickup(db.pickupKey, orderID, nonce))) {
+		return nil, models.ErrInvalidPickupCode
+	}
+
+	var stored string
+	if err := db.QueryRow("SELECT pickup_nonce FROM orders WHERE id = ?", orderID).Scan(&stored); err != nil || stored != nonce {
+		return nil, models.ErrInvalidPickupCode
+	}
+
+	return db.GetOrderByID(orderID)
+}
+
+// CollectOrder marks the order behind a pickup code as handed over by a
+// staff member. A code can only be used once: it fails with
+// ErrAlreadyCollected for an order that was collected before and with
+// ErrOrderNotCollectable for cancelled or scheduled orders.
+func (db *DB) CollectOrder(code string, staffID int) (*models.Order, error) {
+	order, err := db.VerifyPickupCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The status check in the update stops two scans collecting the order twice
+	result, err := tx.Exec(`
+		UPDATE orders SET status = ?, collected_at = CURRENT_TIMESTAMP, collected_by = ?
+		WHERE id = ? AND status IN (?, ?, ?)
+	`, models.OrderStatusCollected, staffID, order.ID,
+		models.OrderStatusPending, models.OrderStatusPreparing, models.OrderStatusReady)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		var status string
+		if err := tx.QueryRow("SELECT status FROM orders WHERE id = ?", order.ID).Scan(&status); err != nil {
+			return nil, err
+		}
+		if status == models.OrderStatusCollected {
+			return nil, models.ErrAlreadyCollected
+		}
+		return nil, models.ErrOrderNotCollectable
+	}
+
+	if err := fulfilOrder(tx, order.ID); err != nil {
+		return nil, err
+	}
+	if err := notifyOrderStatus(tx, order.ID, models.OrderStatusCollected); err != nil {
+		return nil, err
+	}
+	if err := syncRecipeStock(tx); err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return db.GetOrderByID(order.ID)
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"auth-website/models"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPickupCodeSurvivesRestart(t *testing.T) {
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared&_pragma=foreign_keys(1)", atomic.AddInt64(&testDBCount, 1))
+	db, err := Initialize(dsn)
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	defer db.Close()
+	orderID, _ := placeTestOrder(t, db, 20, 1)
+
+	code, err := db.GetPickupCode(orderID)
+	if err != nil {
+		t.Fatalf("GetPickupCode: %v", err)
+	}
+
+	// A restarted server loads the same key, so codes already shown still scan
+	restarted, err := Initialize(dsn)
+	if err != nil {
+		t.Fatalf("second Initialize: %v", err)
+	}
+	defer restarted.Close()
+
+	order, err := restarted.VerifyPickupCode(code)
+	if err != nil {
+		t.Fatalf("VerifyPickupCode: %v", err)
+	}
+	if order.ID != orderID {
+		t.Errorf("code verified as order %d, want %d", order.ID, orderID)
+	}
+
+	tampered := code[:len(code)-1] + "A"
+	if code[len(code)-1] == 'A' {
+		tampered = code[:len(code)-1] + "B"
+	}
+	if _, err := restarted.VerifyPickupCode(tampered); !errors.Is(err, models.ErrInvalidPickupCode) {
+		t.Errorf("tampered code: got error %v, want %v", err, models.ErrInvalidPickupCode)
+	}
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"auth-website/models"
+	"time"
+)
+
+// createPOSTables adds the counter order columns to orders
+func (db *DB) createPOSTables() error {
+	if err := db.addColumnIfMissing("orders", "cashier_id", "INTEGER REFERENCES users(id)"); err != nil {
+		return err
+	}
+	return db.addColumnIfMissing("orders", "tendered", "REAL NOT NULL DEFAULT 0")
+}
+
+// createWalkInCustomer creates the account anonymous counter orders are
+// placed for if it doesn't exist
+func (db *DB) createWalkInCustomer() error {
+	// The password is not a bcrypt hash, so nobody can log in as walk-in
+	_, err := db.Exec(`
+		INSERT INTO users (username, email, password, role)
+		SELECT ?, ?, '!', ?
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE role = ?)
+	`, models.WalkInUsername, models.WalkInUsername+"@localhost", models.RoleWalkIn, models.RoleWalkIn)
+	return err
+}
+
+// POINT OF SALE RELATED METHODS
+
+// PlaceCounterOrder turns the cashier's cart into an order for a customer,
+// or for the walk-in account when customerID is 0, and attributes it to the
+// cashier's open shift. Cash payments must cover the total; the change is
+// worked out from the amount tendered.
+func (db *DB) PlaceCounterOrder(cashierID, customerID int, paymentMethod string, tendered float64) (int, error) {
+	shiftID, err := openShiftID(db, cashierID)
+	if err != nil {
+		return 0, err
+	}
+	if shiftID == 0 {
+		return 0, models.ErrNoOpenShift
+	}
+
+	if customerID == 0 {
+		if err := db.QueryRow("SELECT id FROM users WHERE role = ?", models.RoleWalkIn).Scan(&customerID); err != nil {
+			return 0, err
+		}
+	}
+
+	return db.placeOrder(checkout{
+		cartUserID:    cashierID,
+		customerID:    customerID,
+		cashierID:     cashierID,
+		shiftID:       shiftID,
+		paymentMethod: paymentMethod,
+		tendered:      tendered,
+	}, time.Now())
+}
+
+// FindCustomers returns customers whose username or email contains query
+func (db *DB) FindCustomers(query string, limit int) ([]models.User, error) {
+	pattern := "%" + query + "%"
+	rows, err := db.Query(`
+		SELECT id, username, email, role, created_at FROM users
+		WHERE role != ? AND (username LIKE ? OR email LIKE ?)
+		ORDER BY username
+		LIMIT ?
+	`, models.RoleWalkIn, pattern, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// SetUserRole changes the role of a user. The walk-in account keeps its role.
+func (db *DB) SetUserRole(userID int, role string) error {
+	_, err := db.Exec("UPDATE users SET role = ? WHERE id = ? AND role != ?", role, userID, models.RoleWalkIn)
+	return err
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// createPrintTables creates the print queue table
+func (db *DB) createPrintTables() error {
+	printJobsTable := `
+    CREATE TABLE IF NOT EXISTS print_jobs (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        order_id INTEGER NOT NULL,
+        data BLOB NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        last_error TEXT NOT NULL DEFAULT '',
+        next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        printed_at DATETIME,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (order_id) REFERENCES orders(id)
+    )`
+
+	if _, err := db.Exec(printJobsTable); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_print_jobs_due ON print_jobs(status, next_attempt_at)")
+	return err
+}
+
+// PRINT QUEUE RELATED METHODS
+
+// EnqueuePrintJob adds rendered receipt data for an order to the print queue
+func (db *DB) EnqueuePrintJob(orderID int, data []byte) (int, error) {
+	result, err := db.Exec(
+		"INSERT INTO print_jobs (order_id, data, status, next_attempt_at) VALUES (?, ?, ?, ?)",
+		orderID, data, models.PrintPending, time.Now().UTC().Format(timeLayout),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// printJobColumns is the column list scanned by scanPrintJob, without the data
+const printJobColumns = "id, order_id, status, attempts, last_error, next_attempt_at, printed_at, created_at"
+
+// scanPrintJob scans a row selected with printJobColumns, followed by any extra destinations
+func scanPrintJob(row rowScanner, extra ...interface{}) (models.PrintJob, error) {
+	var job models.PrintJob
+	var printedAt sql.NullTime
+	dest := append([]interface{}{&job.ID, &job.OrderID, &job.Status, &job.Attempts, &job.LastError,
+		&job.NextAttemptAt, &printedAt, &job.CreatedAt}, extra...)
+	err := row.Scan(dest...)
+	if printedAt.Valid {
+		job.PrintedAt = printedAt.Time
+	}
+	return job, err
+}
+
+// GetDuePrintJobs returns pending jobs whose next attempt is due, with their data, oldest first
+func (db *DB) GetDuePrintJobs(now time.Time, limit int) ([]models.PrintJob, error) {
+	rows, err := db.Query(
+		"SELECT "+printJobColumns+", data FROM print_jobs WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT ?",
+		models.PrintPending, now.UTC().Format(timeLayout), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.PrintJob
+	for rows.Next() {
+		var data []byte
+		job, err := scanPrintJob(rows, &data)
+		if err != nil {
+			return nil, err
+		}
+		job.Data = data
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// GetPrintJobs returns the most recent print jobs without their data
+func (db *DB) GetPrintJobs(limit int) ([]models.PrintJob, error) {
+	rows, err := db.Query("SELECT "+printJobColumns+" FROM print_jobs ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.PrintJob
+	for rows.Next() {
+		job, err := scanPrintJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// MarkPrintJobPrinted records that a job reached the printer
+func (db *DB) MarkPrintJobPrinted(id int) error {
+	_, err := db.Exec(
+		"UPDATE print_jobs SET status = ?, attempts = attempts + 1, last_error = '', printed_at = CURRENT_TIMESTAMP WHERE id = ?",
+		models.PrintPrinted, id,
+	)
+	return err
+}
+
+// MarkPrintJobFailed records a failed attempt at a job. It is retried at
+// retryAt unless giveUp is set.
+func (db *DB) MarkPrintJobFailed(id int, errMsg string, retryAt time.Time, giveUp bool) error {
+	status := models.PrintPending
+	if giveUp {
+		status = models.PrintFailed
+	}
+	_, err := db.Exec(
+		"UPDATE print_jobs SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		status, errMsg, retryAt.UTC().Format(timeLayout), id,
+	)
+	return err
+}
+
+// RetryPrintJob puts a job back in the queue to be printed straight away
+func (db *DB) RetryPrintJob(id int) error {
+	_, err := db.Exec(
+		"UPDATE print_jobs SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ?",
+		models.PrintPending, time.Now().UTC().Format(timeLayout), id,
+	)
+	return err
+}
+
+// GetOrderToken returns the number called out when an order is ready: its
+// position among the orders placed on the same local day
+func (db *DB) GetOrderToken(order *models.Order) (int, error) {
+	from, _ := dayBounds(order.CreatedAt)
+	var token int
+	err := db.QueryRow("SELECT COUNT(*) FROM orders WHERE created_at >= ? AND id <= ?", from, order.ID).Scan(&token)
+	return token, err
+}
+
+// GetTaxRate returns the tax rate in percent included in menu prices
+func (db *DB) GetTaxRate() (float64, error) {
+	value, err := db.GetSetting(models.SettingTaxRatePercent, "0")
+	if err != nil {
+		return 0, err
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 {
+		return 0, nil
+	}
+	return rate, nil
+}
+
+// SetReceiptSettings stores the shop name printed on receipts and the tax rate included in prices
+func (db *DB) SetReceiptSettings(header string, taxRate float64) error {
+	if err := db.SetSetting(models.SettingReceiptHeader, header); err != nil {
+		return err
+	}
+	return db.SetSetting(models.SettingTaxRatePercent, strconv.FormatFloat(taxRate, 'f', -1, 64))
+}
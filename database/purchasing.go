@@ -0,0 +1,515 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// createPurchasingTables creates the supplier and purchase order tables
+func (db *DB) createPurchasingTables() error {
+	// Create suppliers table
+	suppliersTable := `
+    CREATE TABLE IF NOT EXISTS suppliers (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT UNIQUE NOT NULL,
+        contact_name TEXT,
+        phone TEXT,
+        email TEXT,
+        lead_time_days INTEGER NOT NULL DEFAULT 0,
+        notes TEXT,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`
+
+	// Create table of the products each supplier provides
+	supplierProductsTable := `
+    CREATE TABLE IF NOT EXISTS supplier_products (
+        supplier_id INTEGER NOT NULL,
+        product_id INTEGER NOT NULL,
+        unit_cost REAL NOT NULL DEFAULT 0,
+        PRIMARY KEY (supplier_id, product_id),
+        FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+        FOREIGN KEY (product_id) REFERENCES products(id)
+    )`
+
+	// Create purchase orders table
+	purchaseOrdersTable := `
+    CREATE TABLE IF NOT EXISTS purchase_orders (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        supplier_id INTEGER NOT NULL,
+        status TEXT NOT NULL DEFAULT 'draft',
+        notes TEXT,
+        created_by INTEGER,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        sent_at DATETIME,
+        FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+        FOREIGN KEY (created_by) REFERENCES users(id)
+    )`
+
+	// Create purchase order lines table
+	purchaseOrderLinesTable := `
+    CREATE TABLE IF NOT EXISTS purchase_order_lines (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        purchase_order_id INTEGER NOT NULL,
+        product_id INTEGER NOT NULL,
+        quantity_ordered INTEGER NOT NULL CHECK(quantity_ordered > 0),
+        quantity_received INTEGER NOT NULL DEFAULT 0,
+        unit_cost REAL NOT NULL DEFAULT 0,
+        FOREIGN KEY (purchase_order_id) REFERENCES purchase_orders(id),
+        FOREIGN KEY (product_id) REFERENCES products(id)
+    )`
+
+	// Create goods receipts table, linking each delivery to its stock movement
+	goodsReceiptsTable := `
+    CREATE TABLE IF NOT EXISTS goods_receipts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        purchase_order_line_id INTEGER NOT NULL,
+        quantity INTEGER NOT NULL CHECK(quantity > 0),
+        unit_cost REAL NOT NULL,
+        stock_movement_id INTEGER NOT NULL,
+        received_by INTEGER,
+        received_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (purchase_order_line_id) REFERENCES purchase_order_lines(id),
+        FOREIGN KEY (stock_movement_id) REFERENCES stock_movements(id),
+        FOREIGN KEY (received_by) REFERENCES users(id)
+    )`
+
+	for _, table := range []string{suppliersTable, supplierProductsTable, purchaseOrdersTable, purchaseOrderLinesTable, goodsReceiptsTable} {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SUPPLIER RELATED METHODS
+
+// CreateSupplier creates a new supplier
+func (db *DB) CreateSupplier(supplier models.Supplier) error {
+	_, err := db.Exec(
+		"INSERT INTO suppliers (name, contact_name, phone, email, lead_time_days, notes) VALUES (?, ?, ?, ?, ?, ?)",
+		supplier.Name, supplier.ContactName, supplier.Phone, supplier.Email, supplier.LeadTimeDays, supplier.Notes,
+	)
+	return err
+}
+
+// UpdateSupplier updates an existing supplier
+func (db *DB) UpdateSupplier(supplier models.Supplier) error {
+	_, err := db.Exec(
+		"UPDATE suppliers SET name = ?, contact_name = ?, phone = ?, email = ?, lead_time_days = ?, notes = ? WHERE id = ?",
+		supplier.Name, supplier.ContactName, supplier.Phone, supplier.Email, supplier.LeadTimeDays, supplier.Notes, supplier.ID,
+	)
+	return err
+}
+
+// supplierColumns is the column list scanned by scanSupplier
+const supplierColumns = `id, name, COALESCE(contact_name, ''), COALESCE(phone, ''), COALESCE(email, ''),
+	lead_time_days, COALESCE(notes, ''), created_at`
+
+// scanSupplier scans a row selected with supplierColumns
+func scanSupplier(row rowScanner) (models.Supplier, error) {
+	var supplier models.Supplier
+	err := row.Scan(&supplier.ID, &supplier.Name, &supplier.ContactName, &supplier.Phone, &supplier.Email,
+		&supplier.LeadTimeDays, &supplier.Notes, &supplier.CreatedAt)
+	return supplier, err
+}
+
+// GetAllSuppliers retrieves all suppliers with the items they supply
+func (db *DB) GetAllSuppliers() ([]models.Supplier, error) {
+	rows, err := db.Query("SELECT " + supplierColumns + " FROM suppliers ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	var suppliers []models.Supplier
+	for rows.Next() {
+		supplier, err := scanSupplier(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		suppliers = append(suppliers, supplier)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range suppliers {
+		suppliers[i].Items, err = db.GetSupplierItems(suppliers[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return suppliers, nil
+}
+
+// GetSupplierByID retrieves a supplier with the items it supplies
+func (db *DB) GetSupplierByID(id int) (*models.Supplier, error) {
+	supplier, err := scanSupplier(db.QueryRow("SELECT "+supplierColumns+" FROM suppliers WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	supplier.Items, err = db.GetSupplierItems(id)
+	if err != nil {
+		return nil, err
+	}
+	return &supplier, nil
+}
+
+// GetSupplierItems retrieves the products a supplier provides
+func (db *DB) GetSupplierItems(supplierID int) ([]models.SupplierItem, error) {
+	rows, err := db.Query(`
+		SELECT sp.supplier_id, sp.product_id, p.name, sp.unit_cost
+		FROM supplier_products sp
+		JOIN products p ON sp.product_id = p.id
+		WHERE sp.supplier_id = ?
+		ORDER BY p.name
+	`, supplierID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.SupplierItem
+	for rows.Next() {
+		var item models.SupplierItem
+		if err := rows.Scan(&item.SupplierID, &item.ProductID, &item.ProductName, &item.UnitCost); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// SetSupplierItem records that a supplier provides a product at unitCost
+func (db *DB) SetSupplierItem(supplierID, productID int, unitCost float64) error {
+	_, err := db.Exec(`
+		INSERT INTO supplier_products (supplier_id, product_id, unit_cost) VALUES (?, ?, ?)
+		ON CONFLICT(supplier_id, product_id) DO UPDATE SET unit_cost = excluded.unit_cost
+	`, supplierID, productID, unitCost)
+	return err
+}
+
+// RemoveSupplierItem records that a supplier no longer provides a product
+func (db *DB) RemoveSupplierItem(supplierID, productID int) error {
+	_, err := db.Exec("DELETE FROM supplier_products WHERE supplier_id = ? AND product_id = ?", supplierID, productID)
+	return err
+}
+
+// PURCHASE ORDER RELATED METHODS
+
+// CreatePurchaseOrder creates a draft purchase order and returns its ID
+func (db *DB) CreatePurchaseOrder(supplierID int, notes string, createdBy int) (int, error) {
+	result, err := db.Exec(
+		"INSERT INTO purchase_orders (supplier_id, status, notes, created_by) VALUES (?, ?, ?, ?)",
+		supplierID, models.PurchaseOrderDraft, notes, nullableID(createdBy),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// purchaseOrderColumns is the column list scanned by scanPurchaseOrder
+const purchaseOrderColumns = `po.id, po.supplier_id, s.name, s.lead_time_days, po.status, COALESCE(po.notes, ''),
+	COALESCE(po.created_by, 0), po.created_at, po.sent_at,
+	(SELECT COALESCE(SUM(l.quantity_ordered * l.unit_cost), 0) FROM purchase_order_lines l WHERE l.purchase_order_id = po.id)`
+
+// purchaseOrderJoins joins the tables needed by purchaseOrderColumns
+const purchaseOrderJoins = `FROM purchase_orders po
+	JOIN suppliers s ON po.supplier_id = s.id`
+
+// scanPurchaseOrder scans a row selected with purchaseOrderColumns
+func scanPurchaseOrder(row rowScanner) (models.PurchaseOrder, error) {
+	var po models.PurchaseOrder
+	var leadTimeDays int
+	var sentAt sql.NullTime
+	err := row.Scan(&po.ID, &po.SupplierID, &po.SupplierName, &leadTimeDays, &po.Status, &po.Notes,
+		&po.CreatedBy, &po.CreatedAt, &sentAt, &po.TotalCost)
+	if sentAt.Valid {
+		po.SentAt = sentAt.Time
+		po.ExpectedAt = sentAt.Time.AddDate(0, 0, leadTimeDays)
+	}
+	return po, err
+}
+
+// GetAllPurchaseOrders retrieves all purchase orders, newest first
+func (db *DB) GetAllPurchaseOrders() ([]models.PurchaseOrder, error) {
+	rows, err := db.Query("SELECT " + purchaseOrderColumns + " " + purchaseOrderJoins + " ORDER BY po.created_at DESC, po.id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.PurchaseOrder
+	for rows.Next() {
+		po, err := scanPurchaseOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, po)
+	}
+
+	return orders, rows.Err()
+}
+
+// GetPurchaseOrderByID retrieves a purchase order with its lines
+func (db *DB) GetPurchaseOrderByID(id int) (*models.PurchaseOrder, error) {
+	po, err := scanPurchaseOrder(db.QueryRow("SELECT "+purchaseOrderColumns+" "+purchaseOrderJoins+" WHERE po.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT l.id, l.purchase_order_id, l.product_id, p.name, l.quantity_ordered, l.quantity_received, l.unit_cost
+		FROM purchase_order_lines l
+		JOIN products p ON l.product_id = p.id
+		WHERE l.purchase_order_id = ?
+		ORDER BY l.id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line models.PurchaseOrderLine
+		err := rows.Scan(&line.ID, &line.PurchaseOrderID, &line.ProductID, &line.ProductName,
+			&line.QuantityOrdered, &line.QuantityReceived, &line.UnitCost)
+		if err != nil {
+			return nil, err
+		}
+		po.Lines = append(po.Lines, line)
+	}
+
+	return &po, rows.Err()
+}
+
+// AddPurchaseOrderLine adds a product to a draft purchase order. A zero
+// unitCost uses the supplier's recorded cost for the product.
+func (db *DB) AddPurchaseOrderLine(poID, productID, quantity int, unitCost float64) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var supplierID int
+	err = tx.QueryRow("SELECT status, supplier_id FROM purchase_orders WHERE id = ?", poID).Scan(&status, &supplierID)
+	if err != nil {
+		return err
+	}
+	if status != models.PurchaseOrderDraft {
+		return models.ErrInvalidPurchaseOrder
+	}
+
+	// Products made to a recipe are restocked through their ingredients
+	var hasRecipe bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM recipe_items WHERE product_id = ?)", productID).Scan(&hasRecipe)
+	if err != nil {
+		return err
+	}
+	if hasRecipe {
+		return models.ErrRecipeStock
+	}
+
+	if unitCost == 0 {
+		err = tx.QueryRow(
+			"SELECT unit_cost FROM supplier_products WHERE supplier_id = ? AND product_id = ?",
+			supplierID, productID,
+		).Scan(&unitCost)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO purchase_order_lines (purchase_order_id, product_id, quantity_ordered, unit_cost) VALUES (?, ?, ?, ?)",
+		poID, productID, quantity, unitCost,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// RemovePurchaseOrderLine removes a line from a draft purchase order
+func (db *DB) RemovePurchaseOrderLine(poID, lineID int) error {
+	result, err := db.Exec(`
+		DELETE FROM purchase_order_lines
+		WHERE id = ? AND purchase_order_id = ?
+		  AND (SELECT status FROM purchase_orders WHERE id = ?) = ?
+	`, lineID, poID, poID, models.PurchaseOrderDraft)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.ErrInvalidPurchaseOrder
+	}
+	return nil
+}
+
+// SendPurchaseOrder marks a draft purchase order with at least one line as sent
+func (db *DB) SendPurchaseOrder(poID int) error {
+	result, err := db.Exec(`
+		UPDATE purchase_orders SET status = ?, sent_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?
+		  AND EXISTS (SELECT 1 FROM purchase_order_lines WHERE purchase_order_id = ?)
+	`, models.PurchaseOrderSent, poID, models.PurchaseOrderDraft, poID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.ErrInvalidPurchaseOrder
+	}
+	return nil
+}
+
+// ReceiveGoods books a delivery against a sent purchase order. received maps
+// purchase order line IDs to the quantity delivered and expiries maps them to
+// the expiry date of the delivered units, if they have one. Each delivered
+// line increments stock through a restock movement, records a goods receipt
+// with the line's cost and puts the units on the shelf as a batch, then the
+// order's status is updated.
+func (db *DB) ReceiveGoods(poID int, received map[int]int, expiries map[int]time.Time, actorID int) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status, supplierName string
+	err = tx.QueryRow(`
+		SELECT po.status, s.name FROM purchase_orders po
+		JOIN suppliers s ON po.supplier_id = s.id
+		WHERE po.id = ?
+	`, poID).Scan(&status, &supplierName)
+	if err != nil {
+		return err
+	}
+	if status != models.PurchaseOrderSent && status != models.PurchaseOrderPartiallyReceived {
+		return models.ErrInvalidPurchaseOrder
+	}
+
+	note := fmt.Sprintf("PO #%d from %s", poID, supplierName)
+	for lineID, quantity := range received {
+		if quantity == 0 {
+			continue
+		}
+
+		var productID, ordered, alreadyReceived int
+		var unitCost float64
+		err = tx.QueryRow(
+			"SELECT product_id, quantity_ordered, quantity_received, unit_cost FROM purchase_order_lines WHERE id = ? AND purchase_order_id = ?",
+			lineID, poID,
+		).Scan(&productID, &ordered, &alreadyReceived, &unitCost)
+		if err != nil {
+			return err
+		}
+		if quantity < 0 || alreadyReceived+quantity > ordered {
+			return models.ErrOverReceipt
+		}
+
+		movementID, err := recordStockChange(tx, productID, quantity, models.MovementRestock, actorID, note)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE purchase_order_lines SET quantity_received = quantity_received + ? WHERE id = ?", quantity, lineID)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(
+			"INSERT INTO goods_receipts (purchase_order_line_id, quantity, unit_cost, stock_movement_id, received_by) VALUES (?, ?, ?, ?, ?)",
+			lineID, quantity, unitCost, movementID, nullableID(actorID),
+		)
+		if err != nil {
+			return err
+		}
+
+		receiptID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		if err := addBatch(tx, productID, quantity, unitCost, expiries[lineID], receiptID, note); err != nil {
+			return err
+		}
+	}
+
+	// The order is complete once every line has been delivered in full
+	var outstanding, receivedTotal int
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(quantity_ordered - quantity_received), 0), COALESCE(SUM(quantity_received), 0)
+		FROM purchase_order_lines WHERE purchase_order_id = ?
+	`, poID).Scan(&outstanding, &receivedTotal)
+	if err != nil {
+		return err
+	}
+
+	status = models.PurchaseOrderSent
+	if outstanding == 0 {
+		status = models.PurchaseOrderReceived
+	} else if receivedTotal > 0 {
+		status = models.PurchaseOrderPartiallyReceived
+	}
+	_, err = tx.Exec("UPDATE purchase_orders SET status = ? WHERE id = ?", status, poID)
+	if err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetGoodsReceipts retrieves the deliveries booked against a purchase order
+func (db *DB) GetGoodsReceipts(poID int) ([]models.GoodsReceipt, error) {
+	rows, err := db.Query(`
+		SELECT g.id, g.purchase_order_line_id, p.name, g.quantity, g.unit_cost, COALESCE(u.username, ''), g.received_at
+		FROM goods_receipts g
+		JOIN purchase_order_lines l ON g.purchase_order_line_id = l.id
+		JOIN products p ON l.product_id = p.id
+		LEFT JOIN users u ON g.received_by = u.id
+		WHERE l.purchase_order_id = ?
+		ORDER BY g.received_at DESC, g.id DESC
+	`, poID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var receipts []models.GoodsReceipt
+	for rows.Next() {
+		var receipt models.GoodsReceipt
+		err := rows.Scan(&receipt.ID, &receipt.PurchaseOrderLineID, &receipt.ProductName, &receipt.Quantity,
+			&receipt.UnitCost, &receipt.ReceivedBy, &receipt.ReceivedAt)
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, rows.Err()
+}
@@ -0,0 +1,349 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"fmt"
+)
+
+// createRecipeTables creates the ingredient, recipe and ingredient ledger tables
+func (db *DB) createRecipeTables() error {
+	// Create ingredients table
+	ingredientsTable := `
+    CREATE TABLE IF NOT EXISTS ingredients (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT UNIQUE NOT NULL,
+        unit TEXT NOT NULL,
+        stock REAL NOT NULL DEFAULT 0,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`
+
+	// Create recipe items table, the bill of materials for one unit of a product
+	recipeItemsTable := `
+    CREATE TABLE IF NOT EXISTS recipe_items (
+        product_id INTEGER NOT NULL,
+        ingredient_id INTEGER NOT NULL,
+        quantity REAL NOT NULL CHECK(quantity > 0),
+        PRIMARY KEY (product_id, ingredient_id),
+        FOREIGN KEY (product_id) REFERENCES products(id),
+        FOREIGN KEY (ingredient_id) REFERENCES ingredients(id)
+    )`
+
+	// Create ingredient ledger table
+	ingredientMovementsTable := `
+    CREATE TABLE IF NOT EXISTS ingredient_movements (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        ingredient_id INTEGER NOT NULL,
+        quantity_change REAL NOT NULL,
+        reason TEXT NOT NULL,
+        actor_id INTEGER,
+        note TEXT,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (ingredient_id) REFERENCES ingredients(id),
+        FOREIGN KEY (actor_id) REFERENCES users(id)
+    )`
+
+	for _, table := range []string{ingredientsTable, recipeItemsTable, ingredientMovementsTable} {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// committedIngredients sums the ingredients needed by units held in carts and
+// by orders the kitchen has not finished, per ingredient
+const committedIngredients = `
+	SELECT r.ingredient_id, SUM(r.quantity * held.quantity) AS amount
+	FROM recipe_items r
+	JOIN (
+		SELECT product_id, quantity FROM cart_items
+		UNION ALL
+		SELECT oi.product_id, oi.quantity FROM order_items oi
+		JOIN orders o ON oi.order_id = o.id
+		WHERE o.fulfilled_at IS NULL AND o.status IN ('scheduled', 'pending', 'preparing')
+	) held ON held.product_id = r.product_id
+	GROUP BY r.ingredient_id`
+
+// syncRecipeStock sets the stock of every product with a recipe to the number
+// of units its limiting ingredient still allows, recording each change in the
+// ledger. It must run in any transaction that changes ingredient stock,
+// recipes or what is held in carts and orders, since products sharing an
+// ingredient affect each other.
+func syncRecipeStock(tx *sql.Tx) error {
+	rows, err := tx.Query(`
+		WITH committed AS (` + committedIngredients + `)
+		SELECT r.product_id, p.stock,
+		       MIN(CAST(MAX(i.stock - COALESCE(c.amount, 0), 0) / r.quantity + 1e-9 AS INTEGER))
+		FROM recipe_items r
+		JOIN products p ON r.product_id = p.id
+		JOIN ingredients i ON r.ingredient_id = i.id
+		LEFT JOIN committed c ON c.ingredient_id = r.ingredient_id
+		GROUP BY r.product_id, p.stock
+	`)
+	if err != nil {
+		return err
+	}
+
+	type stockChange struct{ productID, change int }
+	var changes []stockChange
+	for rows.Next() {
+		var productID, stock, portions int
+		if err := rows.Scan(&productID, &stock, &portions); err != nil {
+			rows.Close()
+			return err
+		}
+		if portions != stock {
+			changes = append(changes, stockChange{productID, portions - stock})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		if err := changeStock(tx, c.productID, c.change, models.MovementAvailability, 0, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changeIngredientStock adjusts an ingredient's stock and records why in the
+// ingredient ledger
+func changeIngredientStock(tx execer, ingredientID int, change float64, reason string, actorID int, note string) error {
+	if change == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec("UPDATE ingredients SET stock = stock + ? WHERE id = ?", change, ingredientID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO ingredient_movements (ingredient_id, quantity_change, reason, actor_id, note) VALUES (?, ?, ?, ?, ?)",
+		ingredientID, change, reason, nullableID(actorID), note,
+	)
+	return err
+}
+
+// consumeOrderIngredients takes the ingredients of an order's recipe products
+// out of stock
+func consumeOrderIngredients(tx *sql.Tx, orderID int) error {
+	rows, err := tx.Query(`
+		SELECT r.ingredient_id, SUM(r.quantity * oi.quantity)
+		FROM order_items oi
+		JOIN recipe_items r ON r.product_id = oi.product_id
+		WHERE oi.order_id = ?
+		GROUP BY r.ingredient_id
+	`, orderID)
+	if err != nil {
+		return err
+	}
+
+	used := make(map[int]float64)
+	for rows.Next() {
+		var ingredientID int
+		var amount float64
+		if err := rows.Scan(&ingredientID, &amount); err != nil {
+			rows.Close()
+			return err
+		}
+		used[ingredientID] = amount
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	note := fmt.Sprintf("Order #%d", orderID)
+	for ingredientID, amount := range used {
+		if err := changeIngredientStock(tx, ingredientID, -amount, models.MovementConsumption, 0, note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// INGREDIENT RELATED METHODS
+
+// CreateIngredient creates a new ingredient with no stock
+func (db *DB) CreateIngredient(name, unit string) error {
+	_, err := db.Exec("INSERT INTO ingredients (name, unit) VALUES (?, ?)", name, unit)
+	return err
+}
+
+// GetAllIngredients retrieves all ingredients with what carts and orders have committed
+func (db *DB) GetAllIngredients() ([]models.Ingredient, error) {
+	rows, err := db.Query(`
+		WITH committed AS (` + committedIngredients + `)
+		SELECT i.id, i.name, i.unit, i.stock, COALESCE(c.amount, 0), i.created_at
+		FROM ingredients i
+		LEFT JOIN committed c ON c.ingredient_id = i.id
+		ORDER BY i.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ingredients []models.Ingredient
+	for rows.Next() {
+		var ingredient models.Ingredient
+		err := rows.Scan(&ingredient.ID, &ingredient.Name, &ingredient.Unit, &ingredient.Stock,
+			&ingredient.Committed, &ingredient.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, ingredient)
+	}
+
+	return ingredients, rows.Err()
+}
+
+// AdjustIngredientStock records a restock, wastage or correction of an
+// ingredient and updates the products that use it. It fails with
+// ErrInsufficientStock if stock would go negative.
+func (db *DB) AdjustIngredientStock(ingredientID int, change float64, reason string, actorID int, note string) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stock float64
+	err = tx.QueryRow("SELECT stock FROM ingredients WHERE id = ?", ingredientID).Scan(&stock)
+	if err != nil {
+		return err
+	}
+
+	if stock+change < 0 {
+		return models.ErrInsufficientStock
+	}
+
+	if err := changeIngredientStock(tx, ingredientID, change, reason, actorID, note); err != nil {
+		return err
+	}
+
+	if err := syncRecipeStock(tx); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetIngredientMovements retrieves the most recent entries of the ingredient ledger
+func (db *DB) GetIngredientMovements(limit int) ([]models.IngredientMovement, error) {
+	rows, err := db.Query(`
+		SELECT m.id, m.ingredient_id, i.name, m.quantity_change, m.reason,
+		       COALESCE(u.username, ''), COALESCE(m.note, ''), m.created_at
+		FROM ingredient_movements m
+		JOIN ingredients i ON m.ingredient_id = i.id
+		LEFT JOIN users u ON m.actor_id = u.id
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []models.IngredientMovement
+	for rows.Next() {
+		var movement models.IngredientMovement
+		err := rows.Scan(&movement.ID, &movement.IngredientID, &movement.IngredientName, &movement.Change,
+			&movement.Reason, &movement.ActorName, &movement.Note, &movement.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, movement)
+	}
+
+	return movements, rows.Err()
+}
+
+// RECIPE RELATED METHODS
+
+// GetRecipe retrieves the ingredients that go into one unit of a product
+func (db *DB) GetRecipe(productID int) ([]models.RecipeItem, error) {
+	rows, err := db.Query(`
+		WITH committed AS (`+committedIngredients+`)
+		SELECT r.product_id, r.ingredient_id, i.name, i.unit, r.quantity,
+		       MAX(i.stock - COALESCE(c.amount, 0), 0)
+		FROM recipe_items r
+		JOIN ingredients i ON r.ingredient_id = i.id
+		LEFT JOIN committed c ON c.ingredient_id = r.ingredient_id
+		WHERE r.product_id = ?
+		ORDER BY i.name
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.RecipeItem
+	for rows.Next() {
+		var item models.RecipeItem
+		err := rows.Scan(&item.ProductID, &item.IngredientID, &item.IngredientName, &item.Unit,
+			&item.Quantity, &item.Available)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// SetRecipeItem sets how much of an ingredient goes into one unit of a
+// product and updates the product's stock to match
+func (db *DB) SetRecipeItem(productID, ingredientID int, quantity float64) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO recipe_items (product_id, ingredient_id, quantity) VALUES (?, ?, ?)
+		ON CONFLICT(product_id, ingredient_id) DO UPDATE SET quantity = excluded.quantity
+	`, productID, ingredientID, quantity)
+	if err != nil {
+		return err
+	}
+
+	if err := syncRecipeStock(tx); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// RemoveRecipeItem takes an ingredient out of a product's recipe. A product
+// whose last ingredient is removed keeps its stock and is managed by hand again.
+func (db *DB) RemoveRecipeItem(productID, ingredientID int) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM recipe_items WHERE product_id = ? AND ingredient_id = ?", productID, ingredientID)
+	if err != nil {
+		return err
+	}
+
+	if err := syncRecipeStock(tx); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
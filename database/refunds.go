@@ -0,0 +1,411 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"strconv"
+)
+
+// createRefundTables creates the refunds and wallet tables and adds the
+// payment and cancellation columns to orders
+func (db *DB) createRefundTables() error {
+	// Create refunds table
+	refundsTable := `
+    CREATE TABLE IF NOT EXISTS refunds (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        order_id INTEGER NOT NULL,
+        order_item_id INTEGER,
+        quantity INTEGER NOT NULL DEFAULT 0,
+        amount REAL NOT NULL CHECK(amount > 0),
+        method TEXT NOT NULL,
+        reason TEXT NOT NULL DEFAULT '',
+        actor_id INTEGER NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (order_id) REFERENCES orders(id),
+        FOREIGN KEY (order_item_id) REFERENCES order_items(id),
+        FOREIGN KEY (actor_id) REFERENCES users(id)
+    )`
+
+	// Create wallet ledger table
+	walletTable := `
+    CREATE TABLE IF NOT EXISTS wallet_transactions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        amount REAL NOT NULL,
+        reason TEXT NOT NULL,
+        order_id INTEGER,
+        actor_id INTEGER,
+        note TEXT NOT NULL DEFAULT '',
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        FOREIGN KEY (order_id) REFERENCES orders(id),
+        FOREIGN KEY (actor_id) REFERENCES users(id)
+    )`
+
+	for _, table := range []string{refundsTable, walletTable} {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_wallet_transactions_user ON wallet_transactions(user_id)"); err != nil {
+		return err
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_refunds_order ON refunds(order_id)"); err != nil {
+		return err
+	}
+
+	// Orders placed before payment methods were recorded were paid by card
+	columns := []struct{ name, definition string }{
+		{"payment_method", "TEXT NOT NULL DEFAULT '" + models.PaymentCard + "'"},
+		{"cancelled_at", "DATETIME"},
+		{"cancel_reason", "TEXT NOT NULL DEFAULT ''"},
+		{"cancelled_by", "INTEGER REFERENCES users(id)"},
+	}
+	for _, column := range columns {
+		if err := db.addColumnIfMissing("orders", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// heldStock is a number of units of a product, and optionally one of its
+// variants, that is being held back from sale by a cart or an order
+type heldStock struct{ productID, variantID, quantity int }
+
+// returnStock puts held units back on sale
+func returnStock(tx *sql.Tx, held []heldStock, reason string, actorID int, note string) error {
+	for _, item := range held {
+		if item.quantity <= 0 {
+			continue
+		}
+		if err := changeStock(tx, item.productID, item.quantity, reason, actorID, note); err != nil {
+			return err
+		}
+		if err := changeVariantStock(tx, item.variantID, item.quantity); err != nil {
+			return err
+		}
+	}
+
+	// Products sharing ingredients with these follow their availability
+	return syncRecipeStock(tx)
+}
+
+// WALLET RELATED METHODS
+
+// walletBalance sums a user's wallet ledger
+func walletBalance(q querier, userID int) (float64, error) {
+	var balance float64
+	err := q.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM wallet_transactions WHERE user_id = ?", userID).Scan(&balance)
+	return balance, err
+}
+
+// addWalletTransaction records a change to a user's wallet balance
+func addWalletTransaction(tx execer, userID int, amount float64, reason string, orderID, actorID int, note string) error {
+	_, err := tx.Exec(
+		"INSERT INTO wallet_transactions (user_id, amount, reason, order_id, actor_id, note) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, amount, reason, nullableID(orderID), nullableID(actorID), note,
+	)
+	return err
+}
+
+// GetWalletBalance returns the balance of a user's wallet
+func (db *DB) GetWalletBalance(userID int) (float64, error) {
+	return walletBalance(db, userID)
+}
+
+// TopUpWallet adds money paid in by a user to their wallet
+func (db *DB) TopUpWallet(userID int, amount float64, actorID int, note string) error {
+	return addWalletTransaction(db, userID, amount, models.WalletTopUp, 0, actorID, note)
+}
+
+// GetWallets returns the wallet balance of every user, largest first
+func (db *DB) GetWallets() ([]models.Wallet, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.email, COALESCE(SUM(w.amount), 0) AS balance
+		FROM users u
+		LEFT JOIN wallet_transactions w ON w.user_id = u.id
+		WHERE u.role != ?
+		GROUP BY u.id
+		ORDER BY balance DESC, u.username
+	`, models.RoleWalkIn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wallets []models.Wallet
+	for rows.Next() {
+		var wallet models.Wallet
+		if err := rows.Scan(&wallet.UserID, &wallet.Username, &wallet.Email, &wallet.Balance); err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	return wallets, rows.Err()
+}
+
+// GetWalletTransactions returns a user's most recent wallet transactions
+func (db *DB) GetWalletTransactions(userID, limit int) ([]models.WalletTransaction, error) {
+	rows, err := db.Query(`
+		SELECT id, user_id, amount, reason, COALESCE(order_id, 0), COALESCE(actor_id, 0), note, created_at
+		FROM wallet_transactions
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []models.WalletTransaction
+	for rows.Next() {
+		var t models.WalletTransaction
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Amount, &t.Reason, &t.OrderID, &t.ActorID, &t.Note, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+
+	return transactions, rows.Err()
+}
+
+// REFUND RELATED METHODS
+
+// refundableOrder is what cancelling or refunding needs to know about an order
+type refundableOrder struct {
+	userID        int
+	status        string
+	total         float64
+	paymentMethod string
+	fulfilled     bool
+	refunded      float64
+}
+
+// getRefundableOrder loads an order for cancelling or refunding it
+func getRefundableOrder(tx *sql.Tx, orderID int) (refundableOrder, error) {
+	var order refundableOrder
+	var fulfilledAt sql.NullTime
+	err := tx.QueryRow(`
+		SELECT o.user_id, o.status, o.total_price, o.payment_method, o.fulfilled_at,
+			(SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE order_id = o.id)
+		FROM orders o WHERE o.id = ?
+	`, orderID).Scan(&order.userID, &order.status, &order.total, &order.paymentMethod, &fulfilledAt, &order.refunded)
+	order.fulfilled = fulfilledAt.Valid
+	return order, err
+}
+
+// issueRefund records a refund of an order. Refunds to the wallet are
+// credited straight away and cash is taken out of the refunding staff
+// member's drawer; other methods are paid back by staff.
+func issueRefund(tx *sql.Tx, order refundableOrder, orderID, orderItemID, quantity int, amount float64, method, reason string, actorID int) error {
+	if method == "" {
+		method = order.paymentMethod
+	}
+	if method != order.paymentMethod && method != models.PaymentWallet {
+		return models.ErrInvalidRefund
+	}
+	// Allow for rounding in the sum of earlier refunds
+	if amount <= 0 || amount > order.total-order.refunded+0.005 {
+		return models.ErrInvalidRefund
+	}
+
+	// Refunds are attributed to the shift of the staff member giving them.
+	// Cash can only be handed back from the drawer of an open shift.
+	shiftID, err := openShiftID(tx, actorID)
+	if err != nil {
+		return err
+	}
+	if method == models.PaymentCash && shiftID == 0 {
+		return models.ErrNoOpenShift
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO refunds (order_id, order_item_id, quantity, amount, method, reason, actor_id, shift_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		orderID, nullableID(orderItemID), quantity, amount, method, reason, actorID, nullableID(shiftID),
+	)
+	if err != nil {
+		return err
+	}
+
+	note := "Order #" + strconv.Itoa(orderID)
+	switch method {
+	case models.PaymentWallet:
+		return addWalletTransaction(tx, order.userID, amount, models.WalletRefund, orderID, actorID, note)
+	case models.PaymentCash:
+		return addCashMovement(tx, shiftID, -amount, models.CashRefund, orderID, actorID, note)
+	}
+	return nil
+}
+
+// CancelOrder cancels an order, puts the units it held back on sale unless
+// they were already prepared, and refunds whatever was not refunded yet.
+// Customers can only cancel orders the kitchen has not started on; staff
+// can cancel any order that is not cancelled already. An empty
+// refundMethod refunds to the order's payment method.
+func (db *DB) CancelOrder(orderID, actorID int, byStaff bool, reason, refundMethod string) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	order, err := getRefundableOrder(tx, orderID)
+	if err != nil {
+		return err
+	}
+
+	switch order.status {
+	case models.OrderStatusCancelled:
+		return models.ErrOrderNotCancellable
+	case models.OrderStatusScheduled, models.OrderStatusPending:
+	default:
+		if !byStaff {
+			return models.ErrOrderNotCancellable
+		}
+	}
+
+	// Only cancel the order once, even if two requests race
+	result, err := tx.Exec(
+		"UPDATE orders SET status = ?, cancelled_at = CURRENT_TIMESTAMP, cancel_reason = ?, cancelled_by = ? WHERE id = ? AND status = ?",
+		models.OrderStatusCancelled, reason, actorID, orderID, order.status,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err == nil {
+			err = models.ErrOrderNotCancellable
+		}
+		return err
+	}
+
+	// Units already taken off the shelves for the order were prepared and
+	// cannot be sold again. Units refunded as missing never existed.
+	if !order.fulfilled {
+		rows, err := tx.Query(`
+			SELECT i.product_id, COALESCE(i.variant_id, 0),
+				i.quantity - (SELECT COALESCE(SUM(quantity), 0) FROM refunds WHERE order_item_id = i.id)
+			FROM order_items i WHERE i.order_id = ?
+		`, orderID)
+		if err != nil {
+			return err
+		}
+
+		var held []heldStock
+		for rows.Next() {
+			var item heldStock
+			if err := rows.Scan(&item.productID, &item.variantID, &item.quantity); err != nil {
+				rows.Close()
+				return err
+			}
+			held = append(held, item)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if err := returnStock(tx, held, models.MovementCancellation, actorID, "Order #"+strconv.Itoa(orderID)); err != nil {
+			return err
+		}
+	}
+
+	if remaining := order.total - order.refunded; remaining > 0.005 {
+		if err := issueRefund(tx, order, orderID, 0, 0, remaining, refundMethod, reason, actorID); err != nil {
+			return err
+		}
+	}
+
+	// Customers know when they cancelled an order themselves
+	if byStaff {
+		if err := notifyOrderStatus(tx, orderID, models.OrderStatusCancelled); err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// RefundOrderItem refunds units of an order line that were missing from
+// the order. The units are not put back on sale, and if the order was not
+// fulfilled yet they are written off its product's batches.
+func (db *DB) RefundOrderItem(orderID, orderItemID, quantity, actorID int, method, reason string) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	order, err := getRefundableOrder(tx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.status == models.OrderStatusCancelled {
+		return models.ErrInvalidRefund
+	}
+
+	var productID, ordered, refunded int
+	var unitPrice float64
+	err = tx.QueryRow(`
+		SELECT i.product_id, i.quantity, i.unit_price,
+			(SELECT COALESCE(SUM(quantity), 0) FROM refunds WHERE order_item_id = i.id)
+		FROM order_items i WHERE i.id = ? AND i.order_id = ?
+	`, orderItemID, orderID).Scan(&productID, &ordered, &unitPrice, &refunded)
+	if err != nil {
+		return err
+	}
+	if quantity <= 0 || quantity > ordered-refunded {
+		return models.ErrInvalidRefund
+	}
+
+	if err := issueRefund(tx, order, orderID, orderItemID, quantity, unitPrice*float64(quantity), method, reason, actorID); err != nil {
+		return err
+	}
+
+	// Fulfilled orders already took their units out of the batches
+	if !order.fulfilled {
+		if err := writeOffMissing(tx, productID, quantity, actorID, "Missing from order #"+strconv.Itoa(orderID)); err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetOrderRefunds returns the refunds of an order, oldest first
+func (db *DB) GetOrderRefunds(orderID int) ([]models.Refund, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.order_id, COALESCE(r.order_item_id, 0), COALESCE(i.product_name, ''), r.quantity,
+			r.amount, r.method, r.reason, r.actor_id, COALESCE(u.username, ''), r.created_at
+		FROM refunds r
+		LEFT JOIN order_items i ON r.order_item_id = i.id
+		LEFT JOIN users u ON r.actor_id = u.id
+		WHERE r.order_id = ?
+		ORDER BY r.created_at, r.id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []models.Refund
+	for rows.Next() {
+		var r models.Refund
+		err := rows.Scan(&r.ID, &r.OrderID, &r.OrderItemID, &r.ProductName, &r.Quantity,
+			&r.Amount, &r.Method, &r.Reason, &r.ActorID, &r.ActorName, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, r)
+	}
+
+	return refunds, rows.Err()
+}
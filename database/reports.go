@@ -0,0 +1,216 @@
+package database
+
+import (
+	"auth-website/models"
+	"fmt"
+	"time"
+)
+
+// salesFilter restricts report queries to the orders placed in a date range
+// that were not cancelled. It takes the range start, the range end and the
+// cancelled status as arguments.
+const salesFilter = `o.created_at >= ? AND o.created_at < ? AND o.status != ?`
+
+// salesArgs returns the arguments of salesFilter
+func salesArgs(from, to time.Time) []interface{} {
+	return []interface{}{from.UTC().Format(timeLayout), to.UTC().Format(timeLayout), models.OrderStatusCancelled}
+}
+
+// periodExpressions maps a report grouping to the SQL expression of the
+// period a timestamp falls in, in local time. Weeks are labelled by the date
+// of their Monday, so a week spanning the new year stays one period.
+var periodExpressions = map[string]string{
+	models.GroupByDay:   "date(%s, 'localtime')",
+	models.GroupByWeek:  "date(%s, 'localtime', '-6 days', 'weekday 1')",
+	models.GroupByMonth: "strftime('%%Y-%%m', %s, 'localtime')",
+}
+
+// periodExpression returns the expression grouping column by groupBy. An
+// unknown grouping falls back to days.
+func periodExpression(groupBy, column string) string {
+	expr, ok := periodExpressions[groupBy]
+	if !ok {
+		expr = periodExpressions[models.GroupByDay]
+	}
+	return fmt.Sprintf(expr, column)
+}
+
+// REPORT RELATED METHODS
+
+// GetSalesSummary totals the orders placed between from and to
+func (db *DB) GetSalesSummary(from, to time.Time) (models.SalesSummary, error) {
+	var summary models.SalesSummary
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(items.units), 0), COALESCE(SUM(o.total_price), 0)
+		FROM orders o
+		JOIN (SELECT order_id, SUM(quantity) AS units FROM order_items GROUP BY order_id) items ON items.order_id = o.id
+		WHERE `+salesFilter, salesArgs(from, to)...).Scan(&summary.Orders, &summary.Units, &summary.Revenue)
+	if err != nil {
+		return summary, err
+	}
+
+	// Cancelled orders are already left out, so this is what was refunded
+	// for missing items
+	err = db.QueryRow(`
+		SELECT COALESCE(SUM(r.amount), 0)
+		FROM refunds r
+		JOIN orders o ON r.order_id = o.id
+		WHERE `+salesFilter, salesArgs(from, to)...).Scan(&summary.Refunded)
+	if err != nil {
+		return summary, err
+	}
+
+	if summary.Orders > 0 {
+		summary.AverageOrderValue = summary.Revenue / float64(summary.Orders)
+	}
+	return summary, nil
+}
+
+// GetSalesByPeriod totals the orders placed between from and to per day,
+// week or month in local time. An unknown grouping falls back to days.
+func (db *DB) GetSalesByPeriod(from, to time.Time, groupBy string) ([]models.SalesPeriod, error) {
+	rows, err := db.Query(`
+		SELECT `+periodExpression(groupBy, "o.created_at")+` AS period, COUNT(*), SUM(items.units), SUM(o.total_price)
+		FROM orders o
+		JOIN (SELECT order_id, SUM(quantity) AS units FROM order_items GROUP BY order_id) items ON items.order_id = o.id
+		WHERE `+salesFilter+`
+		GROUP BY period
+		ORDER BY period
+	`, salesArgs(from, to)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var periods []models.SalesPeriod
+	for rows.Next() {
+		var period models.SalesPeriod
+		if err := rows.Scan(&period.Period, &period.Orders, &period.Units, &period.Revenue); err != nil {
+			return nil, err
+		}
+		periods = append(periods, period)
+	}
+
+	return periods, rows.Err()
+}
+
+// GetSalesByProduct totals the units sold and revenue of each product
+// between from and to, highest revenue first
+func (db *DB) GetSalesByProduct(from, to time.Time) ([]models.ProductSales, error) {
+	rows, err := db.Query(`
+		SELECT oi.product_id, MAX(oi.product_name), COALESCE(c.name, ''),
+		       SUM(oi.quantity), SUM(oi.quantity * oi.unit_price) AS revenue
+		FROM order_items oi
+		JOIN orders o ON oi.order_id = o.id
+		LEFT JOIN products p ON oi.product_id = p.id
+		LEFT JOIN categories c ON p.category_id = c.id
+		WHERE `+salesFilter+`
+		GROUP BY oi.product_id, c.name
+		ORDER BY revenue DESC, SUM(oi.quantity) DESC
+	`, salesArgs(from, to)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []models.ProductSales
+	for rows.Next() {
+		var product models.ProductSales
+		err := rows.Scan(&product.ProductID, &product.ProductName, &product.Category, &product.Units, &product.Revenue)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	return products, rows.Err()
+}
+
+// GetTopSellers returns the limit products that sold the most units between from and to
+func (db *DB) GetTopSellers(from, to time.Time, limit int) ([]models.ProductSales, error) {
+	rows, err := db.Query(`
+		SELECT oi.product_id, MAX(oi.product_name), COALESCE(c.name, ''),
+		       SUM(oi.quantity) AS units, SUM(oi.quantity * oi.unit_price)
+		FROM order_items oi
+		JOIN orders o ON oi.order_id = o.id
+		LEFT JOIN products p ON oi.product_id = p.id
+		LEFT JOIN categories c ON p.category_id = c.id
+		WHERE `+salesFilter+`
+		GROUP BY oi.product_id, c.name
+		ORDER BY units DESC, MAX(oi.product_name)
+		LIMIT ?
+	`, append(salesArgs(from, to), limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []models.ProductSales
+	for rows.Next() {
+		var product models.ProductSales
+		err := rows.Scan(&product.ProductID, &product.ProductName, &product.Category, &product.Units, &product.Revenue)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	return products, rows.Err()
+}
+
+// GetSalesByCategory totals the units sold and revenue of each category
+// between from and to, highest revenue first
+func (db *DB) GetSalesByCategory(from, to time.Time) ([]models.CategorySales, error) {
+	rows, err := db.Query(`
+		SELECT COALESCE(c.name, 'Uncategorized') AS category, SUM(oi.quantity), SUM(oi.quantity * oi.unit_price) AS revenue
+		FROM order_items oi
+		JOIN orders o ON oi.order_id = o.id
+		LEFT JOIN products p ON oi.product_id = p.id
+		LEFT JOIN categories c ON p.category_id = c.id
+		WHERE `+salesFilter+`
+		GROUP BY category
+		ORDER BY revenue DESC
+	`, salesArgs(from, to)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.CategorySales
+	for rows.Next() {
+		var category models.CategorySales
+		if err := rows.Scan(&category.Category, &category.Units, &category.Revenue); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// GetSalesByHour totals the orders placed between from and to per hour of
+// the day in local time, for finding peak hours
+func (db *DB) GetSalesByHour(from, to time.Time) ([]models.HourlySales, error) {
+	rows, err := db.Query(`
+		SELECT CAST(strftime('%H', o.created_at, 'localtime') AS INTEGER) AS hour, COUNT(*), SUM(o.total_price)
+		FROM orders o
+		WHERE `+salesFilter+`
+		GROUP BY hour
+		ORDER BY hour
+	`, salesArgs(from, to)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hours []models.HourlySales
+	for rows.Next() {
+		var hour models.HourlySales
+		if err := rows.Scan(&hour.Hour, &hour.Orders, &hour.Revenue); err != nil {
+			return nil, err
+		}
+		hours = append(hours, hour)
+	}
+
+	return hours, rows.Err()
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"auth-website/models"
+	"testing"
+	"time"
+)
+
+func TestGetSalesByWeek(t *testing.T) {
+	db := newTestDB(t)
+	userID := createTestUser(t, db, "alice")
+	productID := createTestProduct(t, db, "Tea", 20)
+
+	// Noon UTC stays on the same weekday in any time zone the tests run in
+	placedAt := []string{
+		"2025-12-31 12:00:00", // Wednesday
+		"2026-01-02 12:00:00", // Friday of the same week, in the new year
+		"2026-01-06 12:00:00", // Tuesday of the next week
+	}
+	for _, at := range placedAt {
+		if err := db.AddToCart(userID, productID, 1, models.OptionSelection{}); err != nil {
+			t.Fatalf("AddToCart: %v", err)
+		}
+		orderID, err := db.PlaceOrder(userID, 0, models.PaymentCard, time.Now())
+		if err != nil {
+			t.Fatalf("PlaceOrder: %v", err)
+		}
+		if _, err := db.Exec("UPDATE orders SET created_at = ? WHERE id = ?", at, orderID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	from := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	periods, err := db.GetSalesByPeriod(from, to, models.GroupByWeek)
+	if err != nil {
+		t.Fatalf("GetSalesByPeriod: %v", err)
+	}
+
+	want := []struct {
+		period string
+		orders int
+	}{
+		{"2025-12-29", 2},
+		{"2026-01-05", 1},
+	}
+	if len(periods) != len(want) {
+		t.Fatalf("got periods %+v, want %+v", periods, want)
+	}
+	for i, w := range want {
+		if periods[i].Period != w.period || periods[i].Orders != w.orders {
+			t.Errorf("period %d = %s with %d orders, want %s with %d", i, periods[i].Period, periods[i].Orders, w.period, w.orders)
+		}
+	}
+}
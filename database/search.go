@@ -0,0 +1,103 @@
+package database
+
+import (
+	"auth-website/models"
+	"strings"
+	"unicode"
+)
+
+// createSearchTable creates the full-text index of the menu and the triggers
+// that keep it in step with products and their categories. The index rowid is
+// the product ID.
+func (db *DB) createSearchTable() error {
+	statements := []string{`
+    CREATE VIRTUAL TABLE IF NOT EXISTS products_fts USING fts5(
+        name,
+        description,
+        category,
+        tokenize = 'unicode61 remove_diacritics 2',
+        prefix = '2 3'
+    )`, `
+    CREATE TRIGGER IF NOT EXISTS products_fts_insert AFTER INSERT ON products BEGIN
+        INSERT INTO products_fts (rowid, name, description, category)
+        VALUES (new.id, new.name, COALESCE(new.description, ''),
+                COALESCE((SELECT name FROM categories WHERE id = new.category_id), ''));
+    END`, `
+    CREATE TRIGGER IF NOT EXISTS products_fts_update AFTER UPDATE OF name, description, category_id ON products BEGIN
+        DELETE FROM products_fts WHERE rowid = old.id;
+        INSERT INTO products_fts (rowid, name, description, category)
+        VALUES (new.id, new.name, COALESCE(new.description, ''),
+                COALESCE((SELECT name FROM categories WHERE id = new.category_id), ''));
+    END`, `
+    CREATE TRIGGER IF NOT EXISTS products_fts_delete AFTER DELETE ON products BEGIN
+        DELETE FROM products_fts WHERE rowid = old.id;
+    END`, `
+    CREATE TRIGGER IF NOT EXISTS categories_fts_update AFTER UPDATE OF name ON categories BEGIN
+        UPDATE products_fts SET category = new.name
+        WHERE rowid IN (SELECT id FROM products WHERE category_id = new.id);
+    END`,
+	}
+
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	// Index the products that existed before the search table did
+	var indexed, products int
+	if err := db.QueryRow("SELECT (SELECT COUNT(*) FROM products_fts), (SELECT COUNT(*) FROM products)").Scan(&indexed, &products); err != nil {
+		return err
+	}
+	if indexed == products {
+		return nil
+	}
+
+	if _, err := db.Exec("DELETE FROM products_fts"); err != nil {
+		return err
+	}
+	_, err := db.Exec(`
+		INSERT INTO products_fts (rowid, name, description, category)
+		SELECT p.id, p.name, COALESCE(p.description, ''), COALESCE(c.name, '')
+		FROM products p
+		LEFT JOIN categories c ON p.category_id = c.id
+	`)
+	return err
+}
+
+// searchQuery turns what a user typed into an FTS5 query that matches every
+// word as a prefix, so results narrow as they type. It returns an empty
+// string if nothing searchable was typed.
+func searchQuery(input string) string {
+	words := strings.FieldsFunc(input, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// SEARCH RELATED METHODS
+
+// SearchProducts finds the products on the menu matching a search and a menu
+// filter, best matches first whatever the filter's sort order. Matches in the
+// name rank above the category, which ranks above the description.
+func (db *DB) SearchProducts(input string, filter models.MenuFilter, limit int) ([]models.Product, error) {
+	match := searchQuery(input)
+	if match == "" {
+		return nil, nil
+	}
+
+	conditions, filterArgs := menuWhere(filter)
+	args := append([]interface{}{match}, filterArgs...)
+	args = append(args, limit)
+
+	return db.queryProducts("SELECT "+productColumns+" "+productJoins+`
+		JOIN products_fts ON products_fts.rowid = p.id
+		WHERE products_fts MATCH ? AND p.archived_at IS NULL`+conditions+`
+		ORDER BY bm25(products_fts, 10.0, 1.0, 5.0), p.name
+		LIMIT ?`, args...)
+}
@@ -0,0 +1,355 @@
+package database
+
+import (
+	"auth-website/models"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// createShiftTables creates the shifts and cash movements tables and
+// attributes orders and refunds to shifts
+func (db *DB) createShiftTables() error {
+	// Create shifts table
+	shiftsTable := `
+    CREATE TABLE IF NOT EXISTS shifts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        cashier_id INTEGER NOT NULL,
+        opening_float REAL NOT NULL CHECK(opening_float >= 0),
+        opened_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        closed_at DATETIME,
+        expected_cash REAL NOT NULL DEFAULT 0,
+        counted_cash REAL NOT NULL DEFAULT 0,
+        note TEXT NOT NULL DEFAULT '',
+        FOREIGN KEY (cashier_id) REFERENCES users(id)
+    )`
+
+	// Create cash movements table
+	cashMovementsTable := `
+    CREATE TABLE IF NOT EXISTS cash_movements (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        shift_id INTEGER NOT NULL,
+        amount REAL NOT NULL,
+        reason TEXT NOT NULL,
+        order_id INTEGER,
+        actor_id INTEGER NOT NULL,
+        note TEXT NOT NULL DEFAULT '',
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (shift_id) REFERENCES shifts(id),
+        FOREIGN KEY (order_id) REFERENCES orders(id),
+        FOREIGN KEY (actor_id) REFERENCES users(id)
+    )`
+
+	for _, table := range []string{shiftsTable, cashMovementsTable} {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+
+	// A cashier has at most one open shift
+	if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_shifts_open ON shifts(cashier_id) WHERE closed_at IS NULL"); err != nil {
+		return err
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_cash_movements_shift ON cash_movements(shift_id)"); err != nil {
+		return err
+	}
+
+	if err := db.addColumnIfMissing("orders", "shift_id", "INTEGER REFERENCES shifts(id)"); err != nil {
+		return err
+	}
+	return db.addColumnIfMissing("refunds", "shift_id", "INTEGER REFERENCES shifts(id)")
+}
+
+// openShiftID returns the ID of the staff member's open shift, or 0 if they
+// have none
+func openShiftID(q querier, userID int) (int, error) {
+	var id int
+	err := q.QueryRow("SELECT id FROM shifts WHERE cashier_id = ? AND closed_at IS NULL", userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// addCashMovement records cash going in or out of a shift's drawer
+func addCashMovement(tx execer, shiftID int, amount float64, reason string, orderID, actorID int, note string) error {
+	_, err := tx.Exec(
+		"INSERT INTO cash_movements (shift_id, amount, reason, order_id, actor_id, note) VALUES (?, ?, ?, ?, ?, ?)",
+		shiftID, amount, reason, nullableID(orderID), actorID, note,
+	)
+	return err
+}
+
+// SHIFT RELATED METHODS
+
+// OpenShift starts a shift for a cashier with a float of cash in the drawer
+func (db *DB) OpenShift(cashierID int, openingFloat float64) (int, error) {
+	result, err := db.Exec(`
+		INSERT INTO shifts (cashier_id, opening_float)
+		SELECT ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM shifts WHERE cashier_id = ? AND closed_at IS NULL)
+	`, cashierID, openingFloat, cashierID)
+	if err != nil {
+		return 0, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err == nil {
+			err = models.ErrShiftAlreadyOpen
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// GetOpenShift returns the cashier's open shift, or nil if they have none
+func (db *DB) GetOpenShift(cashierID int) (*models.Shift, error) {
+	id, err := openShiftID(db, cashierID)
+	if err != nil || id == 0 {
+		return nil, err
+	}
+	return db.GetShift(id)
+}
+
+// shiftColumns is the column list scanned by scanShift
+const shiftColumns = `s.id, s.cashier_id, u.username, s.opening_float, s.opened_at, s.closed_at,
+	s.expected_cash, s.counted_cash, s.note
+	FROM shifts s JOIN users u ON s.cashier_id = u.id`
+
+// scanShift scans a row selected with shiftColumns
+func scanShift(row rowScanner) (models.Shift, error) {
+	var shift models.Shift
+	var closedAt sql.NullTime
+	err := row.Scan(&shift.ID, &shift.CashierID, &shift.CashierName, &shift.OpeningFloat, &shift.OpenedAt, &closedAt,
+		&shift.ExpectedCash, &shift.CountedCash, &shift.Note)
+	if closedAt.Valid {
+		shift.ClosedAt = closedAt.Time
+	}
+	return shift, err
+}
+
+// GetShift retrieves a shift
+func (db *DB) GetShift(id int) (*models.Shift, error) {
+	shift, err := scanShift(db.QueryRow("SELECT "+shiftColumns+" WHERE s.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	return &shift, nil
+}
+
+// GetShifts returns the most recently opened shifts
+func (db *DB) GetShifts(limit int) ([]models.Shift, error) {
+	return db.queryShifts("SELECT "+shiftColumns+" ORDER BY s.opened_at DESC, s.id DESC LIMIT ?", limit)
+}
+
+// queryShifts runs a query selecting shiftColumns
+func (db *DB) queryShifts(query string, args ...interface{}) ([]models.Shift, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shifts []models.Shift
+	for rows.Next() {
+		shift, err := scanShift(rows)
+		if err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, shift)
+	}
+
+	return shifts, rows.Err()
+}
+
+// GetShiftMovements returns the cash movements of a shift, oldest first
+func (db *DB) GetShiftMovements(shiftID int) ([]models.CashMovement, error) {
+	rows, err := db.Query(`
+		SELECT m.id, m.shift_id, m.amount, m.reason, COALESCE(m.order_id, 0), m.actor_id, u.username, m.note, m.created_at
+		FROM cash_movements m
+		JOIN users u ON m.actor_id = u.id
+		WHERE m.shift_id = ?
+		ORDER BY m.created_at, m.id
+	`, shiftID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []models.CashMovement
+	for rows.Next() {
+		var m models.CashMovement
+		err := rows.Scan(&m.ID, &m.ShiftID, &m.Amount, &m.Reason, &m.OrderID, &m.ActorID, &m.ActorName, &m.Note, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+
+	return movements, rows.Err()
+}
+
+// RecordCashMovement records cash paid into or out of an open shift's drawer
+// other than for orders. amount is negative for cash paid out.
+func (db *DB) RecordCashMovement(shiftID, actorID int, amount float64, note string) error {
+	reason := models.CashPaidIn
+	if amount < 0 {
+		reason = models.CashPaidOut
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO cash_movements (shift_id, amount, reason, actor_id, note)
+		SELECT ?, ?, ?, ?, ?
+		WHERE EXISTS (SELECT 1 FROM shifts WHERE id = ? AND closed_at IS NULL)
+	`, shiftID, amount, reason, actorID, note, shiftID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err == nil {
+			err = models.ErrShiftClosed
+		}
+		return err
+	}
+	return nil
+}
+
+// CloseShift closes a shift with the cash counted in its drawer and records
+// how much there should have been
+func (db *DB) CloseShift(shiftID int, countedCash float64, note string) error {
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var expected float64
+	err = tx.QueryRow(`
+		SELECT s.opening_float + (SELECT COALESCE(SUM(amount), 0) FROM cash_movements WHERE shift_id = s.id)
+		FROM shifts s WHERE s.id = ?
+	`, shiftID).Scan(&expected)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		"UPDATE shifts SET closed_at = CURRENT_TIMESTAMP, expected_cash = ?, counted_cash = ?, note = ? WHERE id = ? AND closed_at IS NULL",
+		expected, countedCash, note, shiftID,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err == nil {
+			err = models.ErrShiftClosed
+		}
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// Z REPORT RELATED METHODS
+
+// GetShiftZReport closes out a single shift
+func (db *DB) GetShiftZReport(shiftID int) (models.ZReport, error) {
+	shift, err := db.GetShift(shiftID)
+	if err != nil {
+		return models.ZReport{}, err
+	}
+	return db.zReport([]models.Shift{*shift})
+}
+
+// GetDayZReport closes out the shifts opened on the local calendar day containing day
+func (db *DB) GetDayZReport(day time.Time) (models.ZReport, error) {
+	from, to := dayBounds(day)
+	shifts, err := db.queryShifts("SELECT "+shiftColumns+" WHERE s.opened_at >= ? AND s.opened_at < ? ORDER BY s.opened_at, s.id", from, to)
+	if err != nil {
+		return models.ZReport{}, err
+	}
+	return db.zReport(shifts)
+}
+
+// zReport totals the sales, refunds and cash of a set of shifts
+func (db *DB) zReport(shifts []models.Shift) (models.ZReport, error) {
+	report := models.ZReport{Shifts: shifts}
+	if len(shifts) == 0 {
+		return report, nil
+	}
+
+	placeholders := make([]string, len(shifts))
+	args := make([]interface{}, len(shifts))
+	for i, shift := range shifts {
+		placeholders[i] = "?"
+		args[i] = shift.ID
+		report.OpeningFloat += shift.OpeningFloat
+		if shift.IsOpen() {
+			report.OpenShifts++
+		} else {
+			report.CountedCash += shift.CountedCash
+		}
+	}
+	inShifts := "shift_id IN (" + strings.Join(placeholders, ", ") + ")"
+
+	var err error
+	report.Sales, err = db.tenderTotals("SELECT payment_method, COUNT(*), COALESCE(SUM(total_price), 0) FROM orders WHERE "+inShifts+" GROUP BY payment_method ORDER BY payment_method", args)
+	if err != nil {
+		return report, err
+	}
+	report.Refunds, err = db.tenderTotals("SELECT method, COUNT(*), COALESCE(SUM(amount), 0) FROM refunds WHERE "+inShifts+" GROUP BY method ORDER BY method", args)
+	if err != nil {
+		return report, err
+	}
+
+	rows, err := db.Query("SELECT reason, COALESCE(SUM(amount), 0) FROM cash_movements WHERE "+inShifts+" GROUP BY reason", args...)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	var movements float64
+	for rows.Next() {
+		var reason string
+		var amount float64
+		if err := rows.Scan(&reason, &amount); err != nil {
+			return report, err
+		}
+		movements += amount
+		switch reason {
+		case models.CashSale:
+			report.CashSales += amount
+		case models.CashRefund:
+			report.CashRefunds -= amount
+		case models.CashPaidIn:
+			report.PaidIn += amount
+		case models.CashPaidOut:
+			report.PaidOut -= amount
+		}
+	}
+	report.ExpectedCash = report.OpeningFloat + movements
+
+	return report, rows.Err()
+}
+
+// tenderTotals runs a query selecting a method, a count and an amount
+func (db *DB) tenderTotals(query string, args []interface{}) ([]models.TenderTotal, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []models.TenderTotal
+	for rows.Next() {
+		var total models.TenderTotal
+		if err := rows.Scan(&total.Method, &total.Count, &total.Amount); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+
+	return totals, rows.Err()
+}
@@ -0,0 +1,452 @@
+package database
+
+import (
+	"auth-website/models"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// createWebhookTables creates the integration endpoint and delivery queue tables
+func (db *DB) createWebhookTables() error {
+	endpointsTable := `
+    CREATE TABLE IF NOT EXISTS webhook_endpoints (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        url TEXT NOT NULL,
+        description TEXT NOT NULL DEFAULT '',
+        secret TEXT NOT NULL,
+        events TEXT NOT NULL,
+        active INTEGER NOT NULL DEFAULT 1,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    )`
+
+	deliveriesTable := `
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        endpoint_id INTEGER NOT NULL,
+        event TEXT NOT NULL,
+        event_id TEXT NOT NULL,
+        payload TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        response_code INTEGER NOT NULL DEFAULT 0,
+        last_error TEXT NOT NULL DEFAULT '',
+        next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        delivered_at DATETIME,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (endpoint_id) REFERENCES webhook_endpoints(id)
+    )`
+
+	for _, table := range []string{endpointsTable, deliveriesTable} {
+		if _, err := db.Exec(table); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)")
+	return err
+}
+
+// queryExecer is satisfied by both *DB and *sql.Tx
+type queryExecer interface {
+	querier
+	execer
+}
+
+// webhookEnvelope is the JSON body posted for every event
+type webhookEnvelope struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WEBHOOK EVENT RELATED METHODS
+
+// enqueueWebhookEvent queues an event for every active endpoint subscribed
+// to it. Call it in the transaction that makes the change, so the event is
+// only sent if the change sticks.
+func enqueueWebhookEvent(q queryExecer, event string, data interface{}) error {
+	endpoints, err := queryWebhookEndpoints(q, "WHERE active = 1")
+	if err != nil {
+		return err
+	}
+
+	var subscribed []models.WebhookEndpoint
+	for _, endpoint := range endpoints {
+		if endpoint.Subscribes(event) {
+			subscribed = append(subscribed, endpoint)
+		}
+	}
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	eventID, err := randomToken("evt_", 12)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(webhookEnvelope{ID: eventID, Type: event, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range subscribed {
+		_, err := q.Exec(
+			"INSERT INTO webhook_deliveries (endpoint_id, event, event_id, payload, status, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?)",
+			endpoint.ID, event, eventID, string(payload), models.DeliveryPending, time.Now().UTC().Format(timeLayout),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderHookItem is an order line in order event payloads
+type orderHookItem struct {
+	ProductID   int     `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	VariantName string  `json:"variant_name,omitempty"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+}
+
+// orderHookData is the data of order events
+type orderHookData struct {
+	OrderID       int             `json:"order_id"`
+	UserID        int             `json:"user_id"`
+	Username      string          `json:"username"`
+	Email         string          `json:"email"`
+	Status        string          `json:"status"`
+	Total         float64         `json:"total"`
+	PaymentMethod string          `json:"payment_method"`
+	WalletBalance *float64        `json:"wallet_balance,omitempty"` // After the order, for wallet payments
+	CashierID     int             `json:"cashier_id,omitempty"`
+	PickupAt      *time.Time      `json:"pickup_at,omitempty"`
+	Items         []orderHookItem `json:"items"`
+}
+
+// enqueueOrderEvent queues an order event with the order's current state
+func enqueueOrderEvent(q queryExecer, event string, orderID int) error {
+	data := orderHookData{OrderID: orderID}
+	var pickupAt sql.NullTime
+	err := q.QueryRow(`
+		SELECT o.user_id, u.username, u.email, o.status, o.total_price, o.payment_method, COALESCE(o.cashier_id, 0), o.pickup_at
+		FROM orders o JOIN users u ON o.user_id = u.id WHERE o.id = ?
+	`, orderID).Scan(&data.UserID, &data.Username, &data.Email, &data.Status, &data.Total, &data.PaymentMethod, &data.CashierID, &pickupAt)
+	if err != nil {
+		return err
+	}
+	if pickupAt.Valid {
+		data.PickupAt = &pickupAt.Time
+	}
+	if data.PaymentMethod == models.PaymentWallet {
+		balance, err := walletBalance(q, data.UserID)
+		if err != nil {
+			return err
+		}
+		data.WalletBalance = &balance
+	}
+
+	rows, err := q.Query("SELECT product_id, product_name, variant_name, quantity, unit_price FROM order_items WHERE order_id = ? ORDER BY id", orderID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var item orderHookItem
+		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.VariantName, &item.Quantity, &item.UnitPrice); err != nil {
+			rows.Close()
+			return err
+		}
+		data.Items = append(data.Items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return enqueueWebhookEvent(q, event, data)
+}
+
+// productHookData is the data of product events
+type productHookData struct {
+	ProductID    int     `json:"product_id"`
+	Action       string  `json:"action"` // created, updated, archived or restored
+	Name         string  `json:"name"`
+	Price        float64 `json:"price"`
+	Stock        int     `json:"stock"`
+	CategoryID   int     `json:"category_id,omitempty"`
+	Archived     bool    `json:"archived"`
+	ReorderLevel int     `json:"reorder_level"`
+}
+
+// enqueueProductEvent queues a product.updated event with the product's current state
+func enqueueProductEvent(q queryExecer, productID int, action string) error {
+	data := productHookData{ProductID: productID, Action: action}
+	err := q.QueryRow(`
+		SELECT name, price, stock, COALESCE(category_id, 0), archived_at IS NOT NULL, reorder_level
+		FROM products WHERE id = ?
+	`, productID).Scan(&data.Name, &data.Price, &data.Stock, &data.CategoryID, &data.Archived, &data.ReorderLevel)
+	if err != nil {
+		return err
+	}
+	return enqueueWebhookEvent(q, models.HookProductUpdated, data)
+}
+
+// stockHookData is the data of stock.low events
+type stockHookData struct {
+	AlertID      int    `json:"alert_id"`
+	ProductID    int    `json:"product_id"`
+	ProductName  string `json:"product_name"`
+	Stock        int    `json:"stock"`
+	ReorderLevel int    `json:"reorder_level"`
+}
+
+// feedbackHookData is the data of feedback events
+type feedbackHookData struct {
+	FeedbackID  int    `json:"feedback_id"`
+	Kind        string `json:"kind"` // general, order or review
+	UserID      int    `json:"user_id"`
+	OrderID     int    `json:"order_id,omitempty"`
+	ProductID   int    `json:"product_id,omitempty"`
+	FoodQuality int    `json:"food_quality"`
+	Service     int    `json:"service"`
+	Comments    string `json:"comments"`
+}
+
+// enqueueFeedbackEvent queues a feedback.created event for a new feedback entry
+func enqueueFeedbackEvent(q queryExecer, feedbackID int64, kind string) error {
+	data := feedbackHookData{FeedbackID: int(feedbackID), Kind: kind}
+	err := q.QueryRow(`
+		SELECT COALESCE(user_id, 0), COALESCE(order_id, 0), COALESCE(product_id, 0), food_quality, service, COALESCE(comments, '')
+		FROM feedback WHERE id = ?
+	`, feedbackID).Scan(&data.UserID, &data.OrderID, &data.ProductID, &data.FoodQuality, &data.Service, &data.Comments)
+	if err != nil {
+		return err
+	}
+	return enqueueWebhookEvent(q, models.HookFeedbackCreated, data)
+}
+
+// randomToken returns prefix followed by n random bytes in hex
+func randomToken(prefix string, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// WEBHOOK ENDPOINT RELATED METHODS
+
+// validWebhookURL reports whether raw is an absolute http or https URL
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// CreateWebhookEndpoint registers a URL to receive events and returns its signing secret
+func (db *DB) CreateWebhookEndpoint(rawURL, description string, events []string) (string, error) {
+	if !validWebhookURL(rawURL) {
+		return "", models.ErrInvalidWebhookURL
+	}
+	secret, err := randomToken("whsec_", 24)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO webhook_endpoints (url, description, secret, events) VALUES (?, ?, ?, ?)",
+		rawURL, description, secret, strings.Join(events, ","),
+	)
+	return secret, err
+}
+
+// UpdateWebhookEndpoint changes an endpoint's URL, description, events and whether it is active
+func (db *DB) UpdateWebhookEndpoint(id int, rawURL, description string, events []string, active bool) error {
+	if !validWebhookURL(rawURL) {
+		return models.ErrInvalidWebhookURL
+	}
+	_, err := db.Exec(
+		"UPDATE webhook_endpoints SET url = ?, description = ?, events = ?, active = ? WHERE id = ?",
+		rawURL, description, strings.Join(events, ","), active, id,
+	)
+	return err
+}
+
+// RotateWebhookSecret gives an endpoint a new signing secret and returns it
+func (db *DB) RotateWebhookSecret(id int) (string, error) {
+	secret, err := randomToken("whsec_", 24)
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec("UPDATE webhook_endpoints SET secret = ? WHERE id = ?", secret, id)
+	return secret, err
+}
+
+// queryWebhookEndpoints returns the endpoints matching a WHERE clause, oldest first
+func queryWebhookEndpoints(q querier, where string, args ...interface{}) ([]models.WebhookEndpoint, error) {
+	rows, err := q.Query("SELECT id, url, description, secret, events, active, created_at FROM webhook_endpoints "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []models.WebhookEndpoint
+	for rows.Next() {
+		var endpoint models.WebhookEndpoint
+		var events string
+		err := rows.Scan(&endpoint.ID, &endpoint.URL, &endpoint.Description, &endpoint.Secret, &events, &endpoint.Active, &endpoint.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		endpoint.Events = splitList(events)
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, rows.Err()
+}
+
+// GetWebhookEndpoints returns all registered endpoints
+func (db *DB) GetWebhookEndpoints() ([]models.WebhookEndpoint, error) {
+	return queryWebhookEndpoints(db, "")
+}
+
+// GetWebhookEndpoint returns one endpoint
+func (db *DB) GetWebhookEndpoint(id int) (*models.WebhookEndpoint, error) {
+	endpoints, err := queryWebhookEndpoints(db, "WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &endpoints[0], nil
+}
+
+// WEBHOOK DELIVERY RELATED METHODS
+
+// deliveryColumns is the column list scanned by scanDelivery
+const deliveryColumns = `d.id, d.endpoint_id, e.url, d.event, d.event_id, d.payload, d.status, d.attempts,
+	d.response_code, d.last_error, d.next_attempt_at, d.delivered_at, d.created_at`
+
+// scanDelivery scans a row selected with deliveryColumns
+func scanDelivery(row rowScanner) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.EndpointID, &d.EndpointURL, &d.Event, &d.EventID, &d.Payload, &d.Status, &d.Attempts,
+		&d.ResponseCode, &d.LastError, &d.NextAttemptAt, &deliveredAt, &d.CreatedAt)
+	if deliveredAt.Valid {
+		d.DeliveredAt = deliveredAt.Time
+	}
+	return d, err
+}
+
+// DueWebhookDelivery is a delivery ready to send, with its endpoint's secret
+type DueWebhookDelivery struct {
+	models.WebhookDelivery
+	Secret string
+}
+
+// GetDueWebhookDeliveries returns pending deliveries to active endpoints
+// whose next attempt is due, oldest first
+func (db *DB) GetDueWebhookDeliveries(now time.Time, limit int) ([]DueWebhookDelivery, error) {
+	rows, err := db.Query(
+		"SELECT "+deliveryColumns+`, e.secret FROM webhook_deliveries d JOIN webhook_endpoints e ON d.endpoint_id = e.id
+		WHERE d.status = ? AND e.active = 1 AND d.next_attempt_at <= ? ORDER BY d.id LIMIT ?`,
+		models.DeliveryPending, now.UTC().Format(timeLayout), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []DueWebhookDelivery
+	for rows.Next() {
+		var d DueWebhookDelivery
+		var deliveredAt sql.NullTime
+		err := rows.Scan(&d.ID, &d.EndpointID, &d.EndpointURL, &d.Event, &d.EventID, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseCode, &d.LastError, &d.NextAttemptAt, &deliveredAt, &d.CreatedAt, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, d)
+	}
+
+	return due, rows.Err()
+}
+
+// GetWebhookDeliveries returns the most recent deliveries, to one endpoint or to all when endpointID is 0
+func (db *DB) GetWebhookDeliveries(endpointID, limit int) ([]models.WebhookDelivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries d JOIN webhook_endpoints e ON d.endpoint_id = e.id"
+	var args []interface{}
+	if endpointID != 0 {
+		query += " WHERE d.endpoint_id = ?"
+		args = append(args, endpointID)
+	}
+	query += " ORDER BY d.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// MarkWebhookDelivered records that the endpoint accepted a delivery
+func (db *DB) MarkWebhookDelivered(id, responseCode int) error {
+	_, err := db.Exec(`
+		UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, response_code = ?, last_error = '', delivered_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, models.DeliveryDelivered, responseCode, id)
+	return err
+}
+
+// MarkWebhookFailed records a failed attempt at a delivery. responseCode is
+// 0 when the endpoint could not be reached. It is retried at retryAt unless
+// giveUp is set.
+func (db *DB) MarkWebhookFailed(id, responseCode int, errMsg string, retryAt time.Time, giveUp bool) error {
+	status := models.DeliveryPending
+	if giveUp {
+		status = models.DeliveryFailed
+	}
+	_, err := db.Exec(`
+		UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, response_code = ?, last_error = ?, next_attempt_at = ?
+		WHERE id = ?
+	`, status, responseCode, errMsg, retryAt.UTC().Format(timeLayout), id)
+	return err
+}
+
+// RedeliverWebhook queues a copy of a delivery to be sent straight away. The
+// copy keeps the event ID, so receivers can tell it is the same event.
+func (db *DB) RedeliverWebhook(id int) error {
+	result, err := db.Exec(`
+		INSERT INTO webhook_deliveries (endpoint_id, event, event_id, payload, status, next_attempt_at)
+		SELECT endpoint_id, event, event_id, payload, ?, ? FROM webhook_deliveries WHERE id = ?
+	`, models.DeliveryPending, time.Now().UTC().Format(timeLayout), id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+	return nil
+}
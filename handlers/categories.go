@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"auth-website/database"
+	"auth-website/models"
+)
+
+// Category related handlers
+
+// Categories handler shows the category management page
+func (h *Handler) Categories(w http.ResponseWriter, r *http.Request) {
+	h.renderCategories(w, "")
+}
+
+// renderCategories renders the category management page with an optional error
+func (h *Handler) renderCategories(w http.ResponseWriter, errMsg string) {
+	categories, err := h.DB.GetAllCategories()
+	if err != nil {
+		http.Error(w, "Could not fetch categories", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/categories.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Categories []models.Category
+		Error      string
+	}{
+		Categories: categories,
+		Error:      errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// categoryForm reads and validates the fields shared by the add and update category forms
+func categoryForm(r *http.Request) (name, slug, iconURL string, displayOrder int, errMsg string) {
+	name = strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		return "", "", "", 0, "Category name is required"
+	}
+
+	// Derive the slug from the name unless one was given
+	slug = database.Slugify(r.FormValue("slug"))
+	if slug == "" {
+		slug = database.Slugify(name)
+	}
+	if slug == "" {
+		return "", "", "", 0, "Category slug must contain letters or digits"
+	}
+
+	if orderStr := r.FormValue("display_order"); orderStr != "" {
+		order, err := strconv.Atoi(orderStr)
+		if err != nil {
+			return "", "", "", 0, "Invalid display order"
+		}
+		displayOrder = order
+	}
+
+	return name, slug, strings.TrimSpace(r.FormValue("icon_url")), displayOrder, ""
+}
+
+// AddCategory handler creates a new category
+func (h *Handler) AddCategory(w http.ResponseWriter, r *http.Request) {
+	name, slug, iconURL, displayOrder, errMsg := categoryForm(r)
+	if errMsg != "" {
+		h.renderCategories(w, errMsg)
+		return
+	}
+
+	if err := h.DB.CreateCategory(name, slug, iconURL, displayOrder); err != nil {
+		h.renderCategories(w, "Failed to create category, the name or slug may already exist")
+		return
+	}
+
+	http.Redirect(w, r, "/categories", http.StatusSeeOther)
+}
+
+// UpdateCategory handler saves changes to an existing category
+func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	name, slug, iconURL, displayOrder, errMsg := categoryForm(r)
+	if errMsg != "" {
+		h.renderCategories(w, errMsg)
+		return
+	}
+
+	active := r.FormValue("active") == "1"
+	if err := h.DB.UpdateCategory(id, name, slug, iconURL, displayOrder, active); err != nil {
+		h.renderCategories(w, "Failed to update category, the name or slug may already exist")
+		return
+	}
+
+	http.Redirect(w, r, "/categories", http.StatusSeeOther)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"auth-website/models"
+)
+
+// Dietary related handlers
+
+// menuFilter reads the menu filters of a request. Users who asked to hide
+// products that do not suit them always have their preferences applied too.
+func menuFilter(r *http.Request, prefs models.DietaryPreferences) models.MenuFilter {
+	query := r.URL.Query()
+	filter := models.MenuFilter{
+		Category:         query.Get("category"),
+		Sort:             query.Get("sort"),
+		Diets:            models.NormalizeDietaryTags(query["diet"]),
+		ExcludeAllergens: models.NormalizeAllergens(query["avoid"]),
+	}
+	if filter.Sort != models.ProductSortRating {
+		filter.Sort = models.ProductSortNewest
+	}
+
+	if prefs.HideIncompatible {
+		filter.Diets = models.NormalizeDietaryTags(append(filter.Diets, prefs.Diets...))
+		filter.ExcludeAllergens = models.NormalizeAllergens(append(filter.ExcludeAllergens, prefs.AvoidAllergens...))
+	}
+	return filter
+}
+
+// nutritionFromForm reads the optional nutrition fields of the product form,
+// leaving blank or invalid ones unknown
+func nutritionFromForm(r *http.Request) models.Nutrition {
+	var nutrition models.Nutrition
+	if c, err := strconv.Atoi(r.FormValue("calories")); err == nil && c > 0 {
+		nutrition.Calories = c
+	}
+
+	grams := func(field string) float64 {
+		g, err := strconv.ParseFloat(r.FormValue(field), 64)
+		if err != nil || g < 0 {
+			return 0
+		}
+		return g
+	}
+	nutrition.ProteinGrams = grams("protein_g")
+	nutrition.CarbsGrams = grams("carbs_g")
+	nutrition.FatGrams = grams("fat_g")
+	return nutrition
+}
+
+// Profile handler shows and saves the user's dietary preferences
+func (h *Handler) Profile(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	saved := false
+	if r.Method == "POST" {
+		r.ParseForm()
+		prefs := models.DietaryPreferences{
+			Diets:            models.NormalizeDietaryTags(r.Form["diets"]),
+			AvoidAllergens:   models.NormalizeAllergens(r.Form["avoid_allergens"]),
+			HideIncompatible: r.FormValue("hide_incompatible") == "1",
+		}
+		if err := h.DB.SaveDietaryPreferences(userID, prefs); err != nil {
+			http.Error(w, "Failed to save preferences", http.StatusInternalServerError)
+			return
+		}
+		saved = true
+	}
+
+	prefs, err := h.DB.GetDietaryPreferences(userID)
+	if err != nil {
+		http.Error(w, "Could not fetch preferences", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/profile.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Username    string
+		Preferences models.DietaryPreferences
+		DietaryTags []string
+		Allergens   []string
+		Saved       bool
+	}{
+		Username:    session.Values["username"].(string),
+		Preferences: prefs,
+		DietaryTags: models.DietaryTags,
+		Allergens:   models.Allergens,
+		Saved:       saved,
+	}
+
+	tmpl.Execute(w, data)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Favourite related handlers
+
+// menuQuery returns the query string of the menu's filters and search,
+// without the one-off parameters of a redirect
+func menuQuery(r *http.Request) string {
+	query := r.URL.Query()
+	for _, key := range []string{"error", "product_id", "quantity", "variant_id", "modifier_id"} {
+		query.Del(key)
+	}
+	return query.Encode()
+}
+
+// ToggleFavourite handler pins a product to the top of the user's menu, or unpins it
+func (h *Handler) ToggleFavourite(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.SetFavourite(userID, productID, r.FormValue("favourite") == "1"); err != nil {
+		http.Error(w, "Failed to update favourites", http.StatusInternalServerError)
+		return
+	}
+
+	// Go back to the menu as it was filtered
+	target := "/dashboard"
+	if returnQuery := r.FormValue("return"); returnQuery != "" {
+		target += "?" + returnQuery
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
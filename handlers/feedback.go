@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"auth-website/models"
+)
+
+// Feedback management handlers
+
+// FeedbackPerPage is how many feedback entries the management page shows at once
+const FeedbackPerPage = 20
+
+// pageLink is one link of a page list
+type pageLink struct {
+	Number int
+	URL    string
+	Active bool
+}
+
+// AdminFeedback handler lists feedback with filters, pagination and rating trends
+func (h *Handler) AdminFeedback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to := reportRange(r)
+
+	filter := models.FeedbackFilter{
+		Search:  strings.TrimSpace(query.Get("q")),
+		Kind:    query.Get("kind"),
+		Status:  query.Get("status"),
+		PerPage: FeedbackPerPage,
+	}
+	// The list covers all time unless a range is given, the trends always have one
+	if query.Get("from") != "" {
+		filter.From = from
+	}
+	if query.Get("to") != "" {
+		filter.To = to
+	}
+	filter.FoodQuality, _ = strconv.Atoi(query.Get("food_quality"))
+	filter.Service, _ = strconv.Atoi(query.Get("service"))
+	filter.Page, _ = strconv.Atoi(query.Get("page"))
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+
+	groupBy := query.Get("group")
+	if groupBy != models.GroupByWeek && groupBy != models.GroupByMonth {
+		groupBy = models.GroupByDay
+	}
+
+	feedbacks, total, err := h.DB.GetFeedback(filter)
+	if err != nil {
+		http.Error(w, "Could not fetch feedback", http.StatusInternalServerError)
+		return
+	}
+
+	trends, err := h.DB.GetFeedbackTrends(from, to, groupBy)
+	if err != nil {
+		http.Error(w, "Could not fetch feedback trends", http.StatusInternalServerError)
+		return
+	}
+
+	// Page links keep the current filters
+	var pages []pageLink
+	for page := 1; (page-1)*FeedbackPerPage < total; page++ {
+		values := url.Values{}
+		for key, value := range query {
+			values[key] = value
+		}
+		values.Set("page", strconv.Itoa(page))
+		pages = append(pages, pageLink{Number: page, URL: "/admin-feedback?" + values.Encode(), Active: page == filter.Page})
+	}
+	if len(pages) < 2 {
+		pages = nil
+	}
+
+	tmpl, err := template.ParseFiles("templates/admin-feedback.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Feedbacks   []models.Feedback
+		Total       int
+		Pages       []pageLink
+		Trends      []models.FeedbackTrend
+		Filter      models.FeedbackFilter
+		From        string
+		To          string
+		GroupBy     string
+		ReturnQuery string
+		Ratings     []int
+	}{
+		Feedbacks:   feedbacks,
+		Total:       total,
+		Pages:       pages,
+		Trends:      trends,
+		Filter:      filter,
+		From:        query.Get("from"),
+		To:          query.Get("to"),
+		GroupBy:     groupBy,
+		ReturnQuery: r.URL.RawQuery,
+		Ratings:     []int{1, 2, 3, 4, 5},
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// redirectToFeedback sends the admin back to the feedback page they came from
+func redirectToFeedback(w http.ResponseWriter, r *http.Request) {
+	target := "/admin-feedback"
+	if returnQuery := r.FormValue("return"); returnQuery != "" {
+		target += "?" + returnQuery
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// ResolveFeedback handler marks feedback as resolved or reopens it
+func (h *Handler) ResolveFeedback(w http.ResponseWriter, r *http.Request) {
+	feedbackID, err := strconv.Atoi(r.FormValue("feedback_id"))
+	if err != nil {
+		http.Error(w, "Invalid feedback ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.SetFeedbackResolved(feedbackID, r.FormValue("resolved") == "1"); err != nil {
+		http.Error(w, "Failed to update feedback", http.StatusInternalServerError)
+		return
+	}
+
+	redirectToFeedback(w, r)
+}
+
+// HideFeedback handler hides feedback as spam or shows it again
+func (h *Handler) HideFeedback(w http.ResponseWriter, r *http.Request) {
+	feedbackID, err := strconv.Atoi(r.FormValue("feedback_id"))
+	if err != nil {
+		http.Error(w, "Invalid feedback ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.SetFeedbackHidden(feedbackID, r.FormValue("hidden") == "1"); err != nil {
+		http.Error(w, "Failed to update feedback", http.StatusInternalServerError)
+		return
+	}
+
+	redirectToFeedback(w, r)
+}
+
+// ReplyFeedback handler stores an admin's reply to feedback
+func (h *Handler) ReplyFeedback(w http.ResponseWriter, r *http.Request) {
+	feedbackID, err := strconv.Atoi(r.FormValue("feedback_id"))
+	if err != nil {
+		http.Error(w, "Invalid feedback ID", http.StatusBadRequest)
+		return
+	}
+
+	body := strings.TrimSpace(r.FormValue("body"))
+	if body == "" {
+		redirectToFeedback(w, r)
+		return
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+
+	if err := h.DB.AddFeedbackReply(feedbackID, adminID, body); err != nil {
+		http.Error(w, "Failed to save reply", http.StatusInternalServerError)
+		return
+	}
+
+	redirectToFeedback(w, r)
+}
@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"database/sql"
 	"html/template"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"auth-website/database"
 	"auth-website/models"
+	"auth-website/printing"
+	"auth-website/storage"
 
 	"github.com/gorilla/sessions"
 )
@@ -14,12 +20,16 @@ import (
 type Handler struct {
 	DB    *database.DB
 	Store *sessions.CookieStore
+	Files storage.Storage
+	// Receipts queues receipts for the thermal printer. Nil when no printer is configured.
+	Receipts *printing.Queue
 }
 
-func NewHandler(db *database.DB, store *sessions.CookieStore) *Handler {
+func NewHandler(db *database.DB, store *sessions.CookieStore, files storage.Storage) *Handler {
 	return &Handler{
 		DB:    db,
 		Store: store,
+		Files: files,
 	}
 }
 
@@ -33,7 +43,7 @@ func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
 	tmpl.Execute(w, nil)
 }
 
-// Feedback page handler
+// Feedback page handler takes general feedback from signed-in users
 func (h *Handler) Feedback(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
 		tmpl, err := template.ParseFiles("templates/feedback.html")
@@ -46,8 +56,13 @@ func (h *Handler) Feedback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == "POST" {
-		name := r.FormValue("name")
-		email := r.FormValue("email")
+		session, _ := h.Store.Get(r, "session-name")
+		userID, ok := session.Values["user_id"].(int)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
 		foodQualityStr := r.FormValue("food_quality")
 		serviceStr := r.FormValue("service")
 		comments := r.FormValue("comments")
@@ -68,7 +83,12 @@ func (h *Handler) Feedback(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Save feedback to database
-		err = h.DB.CreateFeedback(name, email, comments, foodQuality, service)
+		err = h.DB.CreateFeedback(userID, comments, foodQuality, service)
+		if err == models.ErrFeedbackLimit {
+			tmpl, _ := template.ParseFiles("templates/feedback.html")
+			tmpl.Execute(w, map[string]string{"Error": "You have already left feedback today, thank you!"})
+			return
+		}
 		if err != nil {
 			tmpl, _ := template.ParseFiles("templates/feedback.html")
 			tmpl.Execute(w, map[string]string{"Error": "Failed to submit feedback"})
@@ -113,6 +133,8 @@ func (h *Handler) LoginPage(w http.ResponseWriter, r *http.Request) {
 		// Redirect based on role
 		if user.Role == "admin" {
 			http.Redirect(w, r, "/admin-dashboard", http.StatusSeeOther)
+		} else if user.Role == models.RoleCashier {
+			http.Redirect(w, r, "/pos", http.StatusSeeOther)
 		} else {
 			http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 		}
@@ -163,12 +185,66 @@ func (h *Handler) Dashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	products, err := h.DB.GetAllProducts()
+	userID, _ := session.Values["user_id"].(int)
+	prefs, err := h.DB.GetDietaryPreferences(userID)
+	if err != nil {
+		http.Error(w, "Could not fetch preferences", http.StatusInternalServerError)
+		return
+	}
+
+	// Filter by the selected category and dietary needs, if any, newest first
+	// unless sorted by rating. A search lists its matches best first instead.
+	filter := menuFilter(r, prefs)
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	var products []models.Product
+	if search != "" {
+		products, err = h.DB.SearchProducts(search, filter, SearchResultLimit)
+	} else {
+		products, err = h.DB.GetMenu(filter)
+	}
 	if err != nil {
 		http.Error(w, "Could not fetch products", http.StatusInternalServerError)
 		return
 	}
 
+	// Favourites are pinned to the top of the menu, but a search keeps its
+	// best matches first
+	favourites, err := h.DB.GetFavouriteIDs(userID)
+	if err != nil {
+		http.Error(w, "Could not fetch favourites", http.StatusInternalServerError)
+		return
+	}
+	if search == "" {
+		sort.SliceStable(products, func(i, j int) bool {
+			return favourites[products[i].ID] && !favourites[products[j].ID]
+		})
+	}
+
+	// A product that does not suit the user's preferences needs confirming
+	// before it goes in the cart
+	var confirmProduct *models.Product
+	confirmQuantity := 1
+	if r.URL.Query().Get("error") == "incompatible" {
+		if id, err := strconv.Atoi(r.URL.Query().Get("product_id")); err == nil {
+			confirmProduct, _ = h.DB.GetProductByID(id)
+		}
+		if q, err := strconv.Atoi(r.URL.Query().Get("quantity")); err == nil && q > 0 {
+			confirmQuantity = q
+		}
+	}
+
+	categories, err := h.DB.GetActiveCategories()
+	if err != nil {
+		http.Error(w, "Could not fetch categories", http.StatusInternalServerError)
+		return
+	}
+
+	unread, err := h.DB.CountUnreadNotifications(userID)
+	if err != nil {
+		http.Error(w, "Could not fetch notifications", http.StatusInternalServerError)
+		return
+	}
+
 	tmpl, err := template.ParseFiles("templates/dashboard.html")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -176,16 +252,47 @@ func (h *Handler) Dashboard(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Username string
-		Products []models.Product
+		Username         string
+		Products         []models.Product
+		Categories       []models.Category
+		SelectedCategory string
+		SelectedSort     string
+		Search           string
+		Filter           models.MenuFilter
+		Preferences      models.DietaryPreferences
+		DietaryTags      []string
+		Allergens        []string
+		ConfirmProduct   *models.Product
+		ConfirmQuantity  int
+		ConfirmOptions   models.OptionSelection
+		Favourites       map[int]bool
+		ReturnQuery      string
+		Unread           int
 	}{
-		Username: username,
-		Products: products,
+		Username:         username,
+		Products:         products,
+		Categories:       categories,
+		SelectedCategory: filter.Category,
+		SelectedSort:     filter.Sort,
+		Search:           search,
+		Filter:           filter,
+		Preferences:      prefs,
+		DietaryTags:      models.DietaryTags,
+		Allergens:        models.Allergens,
+		ConfirmProduct:   confirmProduct,
+		ConfirmQuantity:  confirmQuantity,
+		ConfirmOptions:   optionSelection(r.URL.Query()),
+		Favourites:       favourites,
+		ReturnQuery:      menuQuery(r),
+		Unread:           unread,
 	}
 
 	tmpl.Execute(w, data)
 }
 
+// DashboardFeedbackCount is how many open feedback entries the admin dashboard shows
+const DashboardFeedbackCount = 5
+
 // Admin dashboard handler - now for product management
 func (h *Handler) AdminDashboard(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.Store.Get(r, "session-name")
@@ -195,7 +302,16 @@ func (h *Handler) AdminDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	products, err := h.DB.GetAllProducts()
+	// Show either the products on the menu or the archived ones
+	tab := r.URL.Query().Get("tab")
+	var products []models.Product
+	var err error
+	if tab == "archived" {
+		products, err = h.DB.GetArchivedProducts()
+	} else {
+		tab = "active"
+		products, err = h.DB.GetAllProducts()
+	}
 	if err != nil {
 		http.Error(w, "Could not fetch products", http.StatusInternalServerError)
 		return
@@ -207,12 +323,28 @@ func (h *Handler) AdminDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	feedbacks, err := h.DB.GetAllFeedback()
+	// The dashboard only shows the latest feedback still waiting for an admin
+	feedbacks, openFeedback, err := h.DB.GetFeedback(models.FeedbackFilter{
+		Status:  models.FeedbackOpen,
+		PerPage: DashboardFeedbackCount,
+	})
 	if err != nil {
 		http.Error(w, "Could not fetch feedback", http.StatusInternalServerError)
 		return
 	}
 
+	lowStockAlerts, err := h.DB.CountOpenStockAlerts()
+	if err != nil {
+		http.Error(w, "Could not fetch stock alerts", http.StatusInternalServerError)
+		return
+	}
+
+	expiringBatches, err := h.DB.GetExpiringBatches(time.Now().AddDate(0, 0, ExpiryWarningDays))
+	if err != nil {
+		http.Error(w, "Could not fetch expiring batches", http.StatusInternalServerError)
+		return
+	}
+
 	tmpl, err := template.ParseFiles("templates/admin-dashboard.html")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -220,15 +352,23 @@ func (h *Handler) AdminDashboard(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Products  []models.Product
-		Users     []models.User
-		Feedbacks []models.Feedback
-		Admin     string
+		Products        []models.Product
+		Tab             string
+		Users           []models.User
+		Feedbacks       []models.Feedback
+		OpenFeedback    int
+		LowStockAlerts  int
+		ExpiringBatches []models.StockBatch
+		Admin           string
 	}{
-		Products:  products,
-		Users:     users,
-		Feedbacks: feedbacks,
-		Admin:     session.Values["username"].(string),
+		Products:        products,
+		Tab:             tab,
+		Users:           users,
+		Feedbacks:       feedbacks,
+		OpenFeedback:    openFeedback,
+		LowStockAlerts:  lowStockAlerts,
+		ExpiringBatches: expiringBatches,
+		Admin:           session.Values["username"].(string),
 	}
 
 	tmpl.Execute(w, data)
@@ -270,64 +410,210 @@ func (h *Handler) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// Middleware to check cashier role, which admins also have the rights of
+func (h *Handler) RequireCashier(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := h.Store.Get(r, "session-name")
+		role, ok := session.Values["role"].(string)
+		if !ok || (role != "admin" && role != models.RoleCashier) {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		next(w, r)
+	}
+}
+
 // Add product handler
 func (h *Handler) AddProduct(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		tmpl, err := template.ParseFiles("templates/add-product.html")
+		h.renderProductForm(w, nil, "")
+		return
+	}
+
+	if r.Method == "POST" {
+		product, errMsg := h.productFromForm(w, r)
+		if errMsg != "" {
+			h.renderProductForm(w, nil, errMsg)
+			return
+		}
+
+		session, _ := h.Store.Get(r, "session-name")
+		adminID, _ := session.Values["user_id"].(int)
+
+		_, err := h.DB.CreateProduct(product, adminID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.removeImages(product.ImageURL, product.ThumbnailURL)
+			h.renderProductForm(w, nil, "Failed to create product")
 			return
 		}
-		tmpl.Execute(w, nil)
+
+		http.Redirect(w, r, "/admin-dashboard", http.StatusSeeOther)
+	}
+}
+
+// Edit product handler
+func (h *Handler) EditProduct(w http.ResponseWriter, r *http.Request) {
+	// Read the ID from the URL, the body must not be parsed before the upload limit is set
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.DB.GetProductByID(id)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == "GET" {
+		h.renderProductForm(w, existing, "")
 		return
 	}
 
 	if r.Method == "POST" {
-		name := r.FormValue("name")
-		description := r.FormValue("description")
-		priceStr := r.FormValue("price")
-		imageURL := r.FormValue("image_url")
-		stockStr := r.FormValue("stock")
-		category := r.FormValue("category")
-
-		// Convert price and stock to appropriate types
-		price := 0.0
-		stock := 0
-
-		if priceStr != "" {
-			if p, err := strconv.ParseFloat(priceStr, 64); err == nil {
-				price = p
-			}
+		product, errMsg := h.productFromForm(w, r)
+		if errMsg != "" {
+			h.renderProductForm(w, existing, errMsg)
+			return
 		}
+		product.ID = existing.ID
 
-		if stockStr != "" {
-			if s, err := strconv.Atoi(stockStr); err == nil {
-				stock = s
-			}
+		// Keep the current image unless a new one was uploaded or entered
+		if product.ImageURL == "" {
+			product.ImageURL = existing.ImageURL
+			product.ThumbnailURL = existing.ThumbnailURL
 		}
 
-		err := h.DB.CreateProduct(name, description, imageURL, category, price, stock)
-		if err != nil {
-			tmpl, _ := template.ParseFiles("templates/add-product.html")
-			tmpl.Execute(w, map[string]string{"Error": "Failed to create product"})
+		session, _ := h.Store.Get(r, "session-name")
+		adminID, _ := session.Values["user_id"].(int)
+
+		if err := h.DB.UpdateProduct(product, adminID); err != nil {
+			if product.ImageURL != existing.ImageURL {
+				h.removeImages(product.ImageURL, product.ThumbnailURL)
+			}
+			h.renderProductForm(w, existing, "Failed to update product")
 			return
 		}
 
+		if product.ImageURL != existing.ImageURL {
+			h.removeImages(existing.ImageURL, existing.ThumbnailURL)
+		}
+
 		http.Redirect(w, r, "/admin-dashboard", http.StatusSeeOther)
 	}
 }
 
-// Delete product handler
-func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+// productFromForm reads the add/edit product form, storing an uploaded image if present
+func (h *Handler) productFromForm(w http.ResponseWriter, r *http.Request) (models.Product, string) {
+	product := models.Product{}
+
+	imageURL, thumbnailURL, err := h.saveUploadedImage(w, r, "image")
+	if err != nil {
+		return product, err.Error()
+	}
+
+	product.Name = r.FormValue("name")
+	product.Description = r.FormValue("description")
+	product.ImageURL = r.FormValue("image_url")
+	if imageURL != "" {
+		product.ImageURL = imageURL
+		product.ThumbnailURL = thumbnailURL
+	}
+
+	// Convert price, stock and category to appropriate types
+	if priceStr := r.FormValue("price"); priceStr != "" {
+		if p, err := strconv.ParseFloat(priceStr, 64); err == nil {
+			product.Price = p
+		}
+	}
+
+	if stockStr := r.FormValue("stock"); stockStr != "" {
+		if s, err := strconv.Atoi(stockStr); err == nil {
+			product.Stock = s
+		}
+	}
+
+	if levelStr := r.FormValue("reorder_level"); levelStr != "" {
+		if l, err := strconv.Atoi(levelStr); err == nil && l >= 0 {
+			product.ReorderLevel = l
+		}
+	}
+
+	if quantityStr := r.FormValue("reorder_quantity"); quantityStr != "" {
+		if q, err := strconv.Atoi(quantityStr); err == nil && q >= 0 {
+			product.ReorderQuantity = q
+		}
+	}
+
+	if categoryIDStr := r.FormValue("category_id"); categoryIDStr != "" {
+		if c, err := strconv.Atoi(categoryIDStr); err == nil {
+			product.CategoryID = c
+		}
+	}
+
+	product.DietaryTags = models.NormalizeDietaryTags(r.Form["dietary_tags"])
+	product.Allergens = models.NormalizeAllergens(r.Form["allergens"])
+	product.Nutrition = nutritionFromForm(r)
+
+	return product, ""
+}
+
+// renderProductForm renders the add product form, or the edit form when product is set
+func (h *Handler) renderProductForm(w http.ResponseWriter, product *models.Product, errMsg string) {
+	categories, err := h.DB.GetAllCategories()
+	if err != nil {
+		http.Error(w, "Could not fetch categories", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/add-product.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Product     *models.Product
+		Categories  []models.Category
+		DietaryTags []string
+		Allergens   []string
+		Error       string
+	}{
+		Product:     product,
+		Categories:  categories,
+		DietaryTags: models.DietaryTags,
+		Allergens:   models.Allergens,
+		Error:       errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// Archive product handler takes a product off the menu
+func (h *Handler) ArchiveProduct(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
 		idStr := r.FormValue("product_id")
 		if id, err := strconv.Atoi(idStr); err == nil {
-			h.DB.DeleteProduct(id)
+			session, _ := h.Store.Get(r, "session-name")
+			adminID, _ := session.Values["user_id"].(int)
+			h.DB.ArchiveProduct(id, adminID)
 		}
 	}
 	http.Redirect(w, r, "/admin-dashboard", http.StatusSeeOther)
 }
 
+// Restore product handler puts an archived product back on the menu
+func (h *Handler) RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		idStr := r.FormValue("product_id")
+		if id, err := strconv.Atoi(idStr); err == nil {
+			h.DB.RestoreProduct(id)
+		}
+	}
+	http.Redirect(w, r, "/admin-dashboard?tab=archived", http.StatusSeeOther)
+}
+
 // Cart related handlers
 
 // AddToCart handler processes the form submission to add a product to the cart
@@ -362,14 +648,43 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Get the variant and modifiers picked for the product, if any
+	r.ParseForm()
+	selection := optionSelection(r.Form)
+
+	// Ask before adding a product that does not suit the user's dietary preferences
+	if r.FormValue("confirm") != "1" {
+		prefs, err := h.DB.GetDietaryPreferences(userID)
+		if err != nil {
+			http.Error(w, "Could not fetch preferences", http.StatusInternalServerError)
+			return
+		}
+		if product, err := h.DB.GetProductByID(productID); err == nil && len(product.Conflicts(prefs)) > 0 {
+			query := selectionQuery(selection)
+			query.Set("error", "incompatible")
+			query.Set("product_id", strconv.Itoa(productID))
+			query.Set("quantity", strconv.Itoa(quantity))
+			http.Redirect(w, r, "/dashboard?"+query.Encode(), http.StatusSeeOther)
+			return
+		}
+	}
+
 	// Add product to cart
-	err = h.DB.AddToCart(userID, productID, quantity)
+	err = h.DB.AddToCart(userID, productID, quantity, selection)
 	if err != nil {
+		if err == models.ErrInvalidOptions {
+			http.Redirect(w, r, "/product?id="+strconv.Itoa(productID)+"&error=invalid_options", http.StatusSeeOther)
+			return
+		}
 		if err == models.ErrInsufficientStock {
 			// Redirect back with error message
 			http.Redirect(w, r, "/dashboard?error=insufficient_stock", http.StatusSeeOther)
 			return
 		}
+		if err == models.ErrProductUnavailable {
+			http.Redirect(w, r, "/dashboard?error=unavailable", http.StatusSeeOther)
+			return
+		}
 		http.Error(w, "Failed to add product to cart", http.StatusInternalServerError)
 		return
 	}
@@ -378,6 +693,16 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/cart", http.StatusSeeOther)
 }
 
+// cartErrors maps the error codes cart actions redirect with to messages
+var cartErrors = map[string]string{
+	"insufficient_stock": "Not enough stock for that quantity.",
+	"invalid_options":    "Please choose the options for this item.",
+	"empty_cart":         "Your cart is empty.",
+	"slot_full":          "That pickup slot is full, please pick another one.",
+	"slot_unavailable":   "That pickup slot can no longer be booked.",
+	"low_balance":        "Your wallet balance is too low for this order.",
+}
+
 // ViewCart handler displays the user's cart
 func (h *Handler) ViewCart(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from session
@@ -395,6 +720,19 @@ func (h *Handler) ViewCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Get the pickup slots that can still be booked today
+	slots, err := h.DB.GetAvailablePickupSlots(time.Now())
+	if err != nil {
+		http.Error(w, "Failed to load pickup slots", http.StatusInternalServerError)
+		return
+	}
+
+	balance, err := h.DB.GetWalletBalance(userID)
+	if err != nil {
+		http.Error(w, "Failed to load wallet", http.StatusInternalServerError)
+		return
+	}
+
 	tmpl, err := template.ParseFiles("templates/cart.html")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -404,9 +742,15 @@ func (h *Handler) ViewCart(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Username string
 		Cart     *models.Cart
+		Slots    []models.PickupSlot
+		Balance  float64
+		Error    string
 	}{
 		Username: session.Values["username"].(string),
 		Cart:     cart,
+		Slots:    slots,
+		Balance:  balance,
+		Error:    cartErrors[r.URL.Query().Get("error")],
 	}
 
 	tmpl.Execute(w, data)
@@ -421,7 +765,7 @@ func (h *Handler) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
 
 	// Get user ID from session
 	session, _ := h.Store.Get(r, "session-name")
-	_, ok := session.Values["user_id"].(int)
+	userID, ok := session.Values["user_id"].(int)
 	if !ok {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
@@ -444,8 +788,12 @@ func (h *Handler) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update cart item
-	err = h.DB.UpdateCartItemQuantity(itemID, quantity)
+	err = h.DB.UpdateCartItemQuantity(userID, itemID, quantity)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
 		if err == models.ErrInsufficientStock {
 			http.Redirect(w, r, "/cart?error=insufficient_stock", http.StatusSeeOther)
 			return
@@ -466,7 +814,7 @@ func (h *Handler) RemoveCartItem(w http.ResponseWriter, r *http.Request) {
 
 	// Get user ID from session
 	session, _ := h.Store.Get(r, "session-name")
-	_, ok := session.Values["user_id"].(int)
+	userID, ok := session.Values["user_id"].(int)
 	if !ok {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
@@ -481,8 +829,12 @@ func (h *Handler) RemoveCartItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Remove item from cart
-	err = h.DB.RemoveFromCart(itemID)
+	err = h.DB.RemoveFromCart(userID, itemID)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to remove item from cart", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-website/models"
+)
+
+// Inventory related handlers
+
+// dateLayout is the format used by HTML date inputs
+const dateLayout = "2006-01-02"
+
+// ExpiryWarningDays is how many days ahead the admin dashboard warns about expiring batches
+const ExpiryWarningDays = 3
+
+// adjustmentReasons are the movement reasons admins can record by hand
+var adjustmentReasons = map[string]bool{
+	models.MovementRestock:    true,
+	models.MovementWastage:    true,
+	models.MovementCorrection: true,
+}
+
+// StockHistory handler shows a product's inventory ledger
+func (h *Handler) StockHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	h.renderStockHistory(w, id, "")
+}
+
+// renderStockHistory renders the stock history page with an optional error
+func (h *Handler) renderStockHistory(w http.ResponseWriter, productID int, errMsg string) {
+	product, err := h.DB.GetProductByID(productID)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	movements, err := h.DB.GetStockMovements(productID)
+	if err != nil {
+		http.Error(w, "Could not fetch stock history", http.StatusInternalServerError)
+		return
+	}
+
+	batches, err := h.DB.GetProductBatches(productID)
+	if err != nil {
+		http.Error(w, "Could not fetch stock batches", http.StatusInternalServerError)
+		return
+	}
+
+	// The ledger total should always match the stored stock
+	ledgerStock := 0
+	for _, movement := range movements {
+		ledgerStock += movement.Change
+	}
+
+	tmpl, err := template.ParseFiles("templates/stock-history.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Product        *models.Product
+		Movements      []models.StockMovement
+		LedgerStock    int
+		Batches        []models.StockBatch
+		WastageReasons []string
+		Error          string
+	}{
+		Product:        product,
+		Movements:      movements,
+		LedgerStock:    ledgerStock,
+		Batches:        batches,
+		WastageReasons: models.WastageReasons,
+		Error:          errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// AdjustStock handler records a restock, wastage or correction
+func (h *Handler) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	reason := r.FormValue("reason")
+	if !adjustmentReasons[reason] {
+		h.renderStockHistory(w, productID, "Choose a reason for the adjustment")
+		return
+	}
+
+	quantity, err := strconv.Atoi(r.FormValue("quantity"))
+	if err != nil || quantity == 0 {
+		h.renderStockHistory(w, productID, "Quantity must be a non-zero whole number")
+		return
+	}
+
+	// Restocks add and wastage removes, whatever sign was typed.
+	// Corrections keep their sign.
+	switch reason {
+	case models.MovementRestock:
+		if quantity < 0 {
+			quantity = -quantity
+		}
+	case models.MovementWastage:
+		if quantity > 0 {
+			quantity = -quantity
+		}
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+	note := strings.TrimSpace(r.FormValue("note"))
+
+	// Restocks arrive as a batch with an optional cost and expiry date
+	if reason == models.MovementRestock {
+		var unitCost float64
+		if costStr := r.FormValue("unit_cost"); costStr != "" {
+			unitCost, err = strconv.ParseFloat(costStr, 64)
+			if err != nil || unitCost < 0 {
+				h.renderStockHistory(w, productID, "Invalid unit cost")
+				return
+			}
+		}
+
+		var expiresAt time.Time
+		if expiryStr := r.FormValue("expires_at"); expiryStr != "" {
+			expiresAt, err = time.Parse(dateLayout, expiryStr)
+			if err != nil {
+				h.renderStockHistory(w, productID, "Invalid expiry date")
+				return
+			}
+		}
+
+		err = h.DB.ReceiveStock(productID, quantity, unitCost, expiresAt, adminID, note)
+	} else {
+		err = h.DB.AdjustStock(productID, quantity, reason, adminID, note)
+	}
+	if err == models.ErrInsufficientStock {
+		h.renderStockHistory(w, productID, "Stock cannot go below zero")
+		return
+	}
+	if err == models.ErrRecipeStock {
+		h.renderStockHistory(w, productID, "This product's stock follows its recipe, adjust its ingredients instead")
+		return
+	}
+	if err != nil {
+		h.renderStockHistory(w, productID, "Failed to record stock adjustment")
+		return
+	}
+
+	http.Redirect(w, r, "/stock-history?id="+strconv.Itoa(productID), http.StatusSeeOther)
+}
+
+// StockReconciliation handler lists products whose stock does not match their ledger
+func (h *Handler) StockReconciliation(w http.ResponseWriter, r *http.Request) {
+	drifts, err := h.DB.GetStockDrift()
+	if err != nil {
+		http.Error(w, "Could not reconcile stock", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/stock-reconciliation.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Drifts []models.StockDrift
+	}{
+		Drifts: drifts,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// ReorderReport handler lists open low-stock alerts and what to reorder
+func (h *Handler) ReorderReport(w http.ResponseWriter, r *http.Request) {
+	alerts, err := h.DB.GetOpenStockAlerts()
+	if err != nil {
+		http.Error(w, "Could not fetch stock alerts", http.StatusInternalServerError)
+		return
+	}
+
+	lines, err := h.DB.GetReorderReport()
+	if err != nil {
+		http.Error(w, "Could not build reorder report", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/reorder-report.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Alerts []models.StockAlert
+		Lines  []models.ReorderLine
+	}{
+		Alerts: alerts,
+		Lines:  lines,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// WasteBatch handler records units of a batch thrown away
+func (h *Handler) WasteBatch(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	batchID, err := strconv.Atoi(r.FormValue("batch_id"))
+	if err != nil {
+		http.Error(w, "Invalid batch ID", http.StatusBadRequest)
+		return
+	}
+
+	reason := r.FormValue("reason")
+	validReason := false
+	for _, wastageReason := range models.WastageReasons {
+		if reason == wastageReason {
+			validReason = true
+		}
+	}
+	if !validReason {
+		h.renderStockHistory(w, productID, "Choose a reason for the wastage")
+		return
+	}
+
+	quantity, err := strconv.Atoi(r.FormValue("quantity"))
+	if err != nil || quantity <= 0 {
+		h.renderStockHistory(w, productID, "Quantity must be a positive whole number")
+		return
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+
+	err = h.DB.WasteBatch(batchID, quantity, reason, adminID, strings.TrimSpace(r.FormValue("note")))
+	if err == models.ErrInsufficientStock {
+		h.renderStockHistory(w, productID, "The batch does not have that many units on sale")
+		return
+	}
+	if err != nil {
+		h.renderStockHistory(w, productID, "Failed to record wastage")
+		return
+	}
+
+	http.Redirect(w, r, "/stock-history?id="+strconv.Itoa(productID), http.StatusSeeOther)
+}
+
+// WastageReport handler totals the cost of wastage over a date range,
+// the last 30 days unless from and to are given
+func (h *Handler) WastageReport(w http.ResponseWriter, r *http.Request) {
+	from, to := reportRange(r)
+
+	lines, err := h.DB.GetWastageReport(from, to)
+	if err != nil {
+		http.Error(w, "Could not fetch wastage report", http.StatusInternalServerError)
+		return
+	}
+
+	entries, err := h.DB.GetWastage(from, to)
+	if err != nil {
+		http.Error(w, "Could not fetch wastage", http.StatusInternalServerError)
+		return
+	}
+
+	totalCost := 0.0
+	for _, line := range lines {
+		totalCost += line.Cost
+	}
+
+	tmpl, err := template.ParseFiles("templates/wastage-report.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		From      string
+		To        string
+		Lines     []models.WastageLine
+		Entries   []models.WastageEntry
+		TotalCost float64
+	}{
+		From:      from.Format(dateLayout),
+		To:        to.AddDate(0, 0, -1).Format(dateLayout),
+		Lines:     lines,
+		Entries:   entries,
+		TotalCost: totalCost,
+	}
+
+	tmpl.Execute(w, data)
+}
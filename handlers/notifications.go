@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"auth-website/models"
+)
+
+// Notification inbox, preferences and outbox related handlers
+
+// NotificationListLimit is how many notifications the inbox and outbox pages list
+const NotificationListLimit = 50
+
+// Notifications handler shows the user's inbox and notification preferences
+func (h *Handler) Notifications(w http.ResponseWriter, r *http.Request) {
+	h.renderNotifications(w, r, "")
+}
+
+// renderNotifications renders the inbox page with an optional error
+func (h *Handler) renderNotifications(w http.ResponseWriter, r *http.Request, errMsg string) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, _ := session.Values["user_id"].(int)
+
+	notifications, err := h.DB.GetNotifications(userID, NotificationListLimit)
+	if err != nil {
+		http.Error(w, "Could not fetch notifications", http.StatusInternalServerError)
+		return
+	}
+	prefs, err := h.DB.GetNotificationPreferences(userID)
+	if err != nil {
+		http.Error(w, "Could not load notification preferences", http.StatusInternalServerError)
+		return
+	}
+	webhookURL, webhookSecret, err := h.DB.GetUserWebhook(userID)
+	if err != nil {
+		http.Error(w, "Could not load notification preferences", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/notifications.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Username      string
+		Notifications []models.Notification
+		Preferences   []models.EventPreferences
+		Channels      []string
+		WebhookURL    string
+		WebhookSecret string
+		Saved         bool
+		Error         string
+	}{
+		Username:      session.Values["username"].(string),
+		Notifications: notifications,
+		Preferences:   prefs,
+		Channels:      models.NotificationChannels,
+		WebhookURL:    webhookURL,
+		WebhookSecret: webhookSecret,
+		Saved:         r.URL.Query().Get("saved") == "1",
+		Error:         errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// MarkNotificationsRead handler marks all of the user's notifications as seen
+func (h *Handler) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, _ := session.Values["user_id"].(int)
+
+	if err := h.DB.MarkNotificationsRead(userID); err != nil {
+		h.renderNotifications(w, r, "Failed to mark notifications as read")
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// UpdateNotificationPreferences handler stores which channels the user wants
+// each event through. Checkboxes are named event:channel.
+func (h *Handler) UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, _ := session.Values["user_id"].(int)
+
+	if err := r.ParseForm(); err != nil {
+		h.renderNotifications(w, r, "Invalid form")
+		return
+	}
+
+	enabled := make(map[string]map[string]bool)
+	for _, event := range models.NotificationEvents {
+		enabled[event] = make(map[string]bool)
+		for _, channel := range models.NotificationChannels {
+			enabled[event][channel] = r.PostForm.Get(event+":"+channel) == "on"
+		}
+	}
+
+	// The server posts to the URL, so it must not lead into the server's own network
+	webhookURL := strings.TrimSpace(r.PostForm.Get("webhook_url"))
+	if webhookURL != "" {
+		if msg := publicURLError(r.Context(), webhookURL); msg != "" {
+			h.renderNotifications(w, r, msg)
+			return
+		}
+	}
+
+	if err := h.DB.SetNotificationPreferences(userID, enabled, webhookURL); err != nil {
+		if err == models.ErrInvalidWebhookURL {
+			h.renderNotifications(w, r, "Webhook URL must start with http:// or https://")
+		} else {
+			h.renderNotifications(w, r, "Failed to save notification preferences")
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/notifications?saved=1", http.StatusSeeOther)
+}
+
+// NotificationOutbox handler shows admins the notifications waiting to be
+// sent or that could not be sent
+func (h *Handler) NotificationOutbox(w http.ResponseWriter, r *http.Request) {
+	h.renderNotificationOutbox(w, r, "")
+}
+
+// renderNotificationOutbox renders the outbox page with an optional error
+func (h *Handler) renderNotificationOutbox(w http.ResponseWriter, r *http.Request, errMsg string) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case models.OutboxPending, models.OutboxSent, models.OutboxFailed:
+	default:
+		status = ""
+	}
+
+	messages, err := h.DB.GetOutboxMessages(status, NotificationListLimit)
+	if err != nil {
+		http.Error(w, "Could not fetch the outbox", http.StatusInternalServerError)
+		return
+	}
+	threshold, err := h.DB.GetLowBalanceThreshold()
+	if err != nil {
+		http.Error(w, "Could not load notification settings", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/notification-outbox.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Messages  []models.OutboxMessage
+		Status    string
+		Statuses  []string
+		Threshold float64
+		Error     string
+	}{
+		Messages:  messages,
+		Status:    status,
+		Statuses:  []string{models.OutboxPending, models.OutboxSent, models.OutboxFailed},
+		Threshold: threshold,
+		Error:     errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// RetryNotification handler puts a failed notification back in the outbox
+func (h *Handler) RetryNotification(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("message_id"))
+	if err != nil {
+		h.renderNotificationOutbox(w, r, "Invalid notification")
+		return
+	}
+
+	if err := h.DB.RetryOutboxMessage(id); err != nil {
+		h.renderNotificationOutbox(w, r, "Failed to retry the notification")
+		return
+	}
+
+	http.Redirect(w, r, "/notification-outbox", http.StatusSeeOther)
+}
+
+// UpdateLowBalanceThreshold handler stores the balance below which users are warned
+func (h *Handler) UpdateLowBalanceThreshold(w http.ResponseWriter, r *http.Request) {
+	threshold, err := strconv.ParseFloat(r.FormValue("threshold"), 64)
+	if err != nil || threshold < 0 {
+		h.renderNotificationOutbox(w, r, "Threshold must be zero or more")
+		return
+	}
+
+	if err := h.DB.SetLowBalanceThreshold(threshold); err != nil {
+		h.renderNotificationOutbox(w, r, "Failed to save the threshold")
+		return
+	}
+
+	http.Redirect(w, r, "/notification-outbox", http.StatusSeeOther)
+}
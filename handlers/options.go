@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"auth-website/models"
+)
+
+// Product variant and modifier related handlers
+
+// optionSelection reads the variant and modifiers picked in a form or query
+func optionSelection(values url.Values) models.OptionSelection {
+	var selection models.OptionSelection
+	if id, err := strconv.Atoi(values.Get("variant_id")); err == nil {
+		selection.VariantID = id
+	}
+	for _, value := range values["modifier_id"] {
+		if id, err := strconv.Atoi(value); err == nil {
+			selection.ModifierIDs = append(selection.ModifierIDs, id)
+		}
+	}
+	return selection
+}
+
+// selectionQuery encodes a selection the way optionSelection reads it
+func selectionQuery(selection models.OptionSelection) url.Values {
+	query := url.Values{}
+	if selection.VariantID != 0 {
+		query.Set("variant_id", strconv.Itoa(selection.VariantID))
+	}
+	for _, id := range selection.ModifierIDs {
+		query.Add("modifier_id", strconv.Itoa(id))
+	}
+	return query
+}
+
+// ProductOptions handler shows a product's variants and modifier groups
+func (h *Handler) ProductOptions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	h.renderProductOptions(w, id, "")
+}
+
+// renderProductOptions renders the product options page with an optional error
+func (h *Handler) renderProductOptions(w http.ResponseWriter, productID int, errMsg string) {
+	product, err := h.DB.GetProductByID(productID)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	options, err := h.DB.GetProductOptions(productID, false)
+	if err != nil {
+		http.Error(w, "Could not fetch product options", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/product-options.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Product *models.Product
+		Options models.ProductOptions
+		Error   string
+	}{
+		Product: product,
+		Options: options,
+		Error:   errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// redirectToOptions sends the admin back to a product's options page
+func redirectToOptions(w http.ResponseWriter, r *http.Request, productID int) {
+	http.Redirect(w, r, "/product-options?id="+strconv.Itoa(productID), http.StatusSeeOther)
+}
+
+// variantForm reads and validates the fields shared by the add and update variant forms
+func variantForm(r *http.Request) (name string, priceDelta float64, stock int, tracksStock bool, displayOrder int, errMsg string) {
+	name = strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		return "", 0, 0, false, 0, "Variant name is required"
+	}
+
+	if deltaStr := r.FormValue("price_delta"); deltaStr != "" {
+		delta, err := strconv.ParseFloat(deltaStr, 64)
+		if err != nil {
+			return "", 0, 0, false, 0, "Invalid price difference"
+		}
+		priceDelta = delta
+	}
+
+	// A blank stock shares the product's stock
+	if stockStr := strings.TrimSpace(r.FormValue("stock")); stockStr != "" {
+		s, err := strconv.Atoi(stockStr)
+		if err != nil || s < 0 {
+			return "", 0, 0, false, 0, "Variant stock must be zero or more, or blank to share the product's stock"
+		}
+		stock, tracksStock = s, true
+	}
+
+	if orderStr := r.FormValue("display_order"); orderStr != "" {
+		order, err := strconv.Atoi(orderStr)
+		if err != nil {
+			return "", 0, 0, false, 0, "Invalid display order"
+		}
+		displayOrder = order
+	}
+
+	return name, priceDelta, stock, tracksStock, displayOrder, ""
+}
+
+// AddVariant handler adds a variant to a product
+func (h *Handler) AddVariant(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	name, priceDelta, stock, tracksStock, displayOrder, errMsg := variantForm(r)
+	if errMsg != "" {
+		h.renderProductOptions(w, productID, errMsg)
+		return
+	}
+
+	if err := h.DB.CreateVariant(productID, name, priceDelta, stock, tracksStock, displayOrder); err != nil {
+		h.renderProductOptions(w, productID, "Failed to add variant, the name may already exist")
+		return
+	}
+
+	redirectToOptions(w, r, productID)
+}
+
+// UpdateVariant handler saves changes to a variant
+func (h *Handler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("variant_id"))
+	if err != nil {
+		http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+		return
+	}
+
+	name, priceDelta, stock, tracksStock, displayOrder, errMsg := variantForm(r)
+	if errMsg != "" {
+		h.renderProductOptions(w, productID, errMsg)
+		return
+	}
+
+	active := r.FormValue("active") == "1"
+	if err := h.DB.UpdateVariant(id, name, priceDelta, stock, tracksStock, displayOrder, active); err != nil {
+		h.renderProductOptions(w, productID, "Failed to update variant, the name may already exist")
+		return
+	}
+
+	redirectToOptions(w, r, productID)
+}
+
+// modifierGroupForm reads and validates the fields shared by the add and update modifier group forms
+func modifierGroupForm(r *http.Request) (name string, minSelect, maxSelect, displayOrder int, errMsg string) {
+	name = strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		return "", 0, 0, 0, "Group name is required"
+	}
+
+	minSelect, err := strconv.Atoi(r.FormValue("min_select"))
+	if err != nil || minSelect < 0 {
+		return "", 0, 0, 0, "Minimum must be zero or more"
+	}
+
+	// A blank or zero maximum means no limit
+	if maxStr := strings.TrimSpace(r.FormValue("max_select")); maxStr != "" {
+		maxSelect, err = strconv.Atoi(maxStr)
+		if err != nil || maxSelect < 0 {
+			return "", 0, 0, 0, "Maximum must be zero or more"
+		}
+	}
+	if maxSelect != 0 && maxSelect < minSelect {
+		return "", 0, 0, 0, "Maximum cannot be less than the minimum"
+	}
+
+	if orderStr := r.FormValue("display_order"); orderStr != "" {
+		order, err := strconv.Atoi(orderStr)
+		if err != nil {
+			return "", 0, 0, 0, "Invalid display order"
+		}
+		displayOrder = order
+	}
+
+	return name, minSelect, maxSelect, displayOrder, ""
+}
+
+// AddModifierGroup handler adds a modifier group to a product
+func (h *Handler) AddModifierGroup(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	name, minSelect, maxSelect, displayOrder, errMsg := modifierGroupForm(r)
+	if errMsg != "" {
+		h.renderProductOptions(w, productID, errMsg)
+		return
+	}
+
+	if err := h.DB.CreateModifierGroup(productID, name, minSelect, maxSelect, displayOrder); err != nil {
+		h.renderProductOptions(w, productID, "Failed to add modifier group")
+		return
+	}
+
+	redirectToOptions(w, r, productID)
+}
+
+// UpdateModifierGroup handler saves changes to a modifier group
+func (h *Handler) UpdateModifierGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("group_id"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	productID, err := h.DB.GetModifierGroupProduct(id)
+	if err != nil {
+		http.Error(w, "Modifier group not found", http.StatusNotFound)
+		return
+	}
+
+	name, minSelect, maxSelect, displayOrder, errMsg := modifierGroupForm(r)
+	if errMsg != "" {
+		h.renderProductOptions(w, productID, errMsg)
+		return
+	}
+
+	if err := h.DB.UpdateModifierGroup(id, name, minSelect, maxSelect, displayOrder); err != nil {
+		h.renderProductOptions(w, productID, "Failed to update modifier group")
+		return
+	}
+
+	redirectToOptions(w, r, productID)
+}
+
+// modifierForm reads and validates the fields shared by the add and update modifier forms
+func modifierForm(r *http.Request) (name string, price float64, errMsg string) {
+	name = strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		return "", 0, "Modifier name is required"
+	}
+
+	if priceStr := r.FormValue("price"); priceStr != "" {
+		p, err := strconv.ParseFloat(priceStr, 64)
+		if err != nil || p < 0 {
+			return "", 0, "Modifier price must be zero or more"
+		}
+		price = p
+	}
+
+	return name, price, ""
+}
+
+// AddModifier handler adds a modifier to a group
+func (h *Handler) AddModifier(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(r.FormValue("group_id"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	productID, err := h.DB.GetModifierGroupProduct(groupID)
+	if err != nil {
+		http.Error(w, "Modifier group not found", http.StatusNotFound)
+		return
+	}
+
+	name, price, errMsg := modifierForm(r)
+	if errMsg != "" {
+		h.renderProductOptions(w, productID, errMsg)
+		return
+	}
+
+	if err := h.DB.CreateModifier(groupID, name, price); err != nil {
+		h.renderProductOptions(w, productID, "Failed to add modifier")
+		return
+	}
+
+	redirectToOptions(w, r, productID)
+}
+
+// UpdateModifier handler saves changes to a modifier
+func (h *Handler) UpdateModifier(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(r.FormValue("group_id"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("modifier_id"))
+	if err != nil {
+		http.Error(w, "Invalid modifier ID", http.StatusBadRequest)
+		return
+	}
+
+	productID, err := h.DB.GetModifierGroupProduct(groupID)
+	if err != nil {
+		http.Error(w, "Modifier group not found", http.StatusNotFound)
+		return
+	}
+
+	name, price, errMsg := modifierForm(r)
+	if errMsg != "" {
+		h.renderProductOptions(w, productID, errMsg)
+		return
+	}
+
+	active := r.FormValue("active") == "1"
+	if err := h.DB.UpdateModifier(id, name, price, active); err != nil {
+		h.renderProductOptions(w, productID, "Failed to update modifier")
+		return
+	}
+
+	redirectToOptions(w, r, productID)
+}
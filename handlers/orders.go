@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-website/models"
+)
+
+// Order related handlers
+
+// Checkout handler places an order from the user's cart, optionally for a pickup slot
+func (h *Handler) Checkout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/cart", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from session
+	session, _ := h.Store.Get(r, "session-name")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	// An empty or missing slot means "as soon as possible"
+	slotID := 0
+	if slotStr := r.FormValue("pickup_slot_id"); slotStr != "" {
+		id, err := strconv.Atoi(slotStr)
+		if err != nil {
+			http.Error(w, "Invalid pickup slot", http.StatusBadRequest)
+			return
+		}
+		slotID = id
+	}
+
+	// Orders are paid by card unless the user picks their wallet
+	paymentMethod := models.PaymentCard
+	if r.FormValue("payment_method") == models.PaymentWallet {
+		paymentMethod = models.PaymentWallet
+	}
+
+	orderID, err := h.DB.PlaceOrder(userID, slotID, paymentMethod, time.Now())
+	if err != nil {
+		switch err {
+		case models.ErrEmptyCart:
+			http.Redirect(w, r, "/cart?error=empty_cart", http.StatusSeeOther)
+		case models.ErrSlotFull:
+			http.Redirect(w, r, "/cart?error=slot_full", http.StatusSeeOther)
+		case models.ErrSlotUnavailable:
+			http.Redirect(w, r, "/cart?error=slot_unavailable", http.StatusSeeOther)
+		case models.ErrInsufficientBalance:
+			http.Redirect(w, r, "/cart?error=low_balance", http.StatusSeeOther)
+		default:
+			http.Error(w, "Failed to place order", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/order?id="+strconv.Itoa(orderID), http.StatusSeeOther)
+}
+
+// ViewOrder handler shows the confirmation page of one of the user's orders
+func (h *Handler) ViewOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+	h.renderOrder(w, r, orderID, "")
+}
+
+// renderOrder renders one of the user's orders, with its rating form or the
+// rating they gave it, and an optional error
+func (h *Handler) renderOrder(w http.ResponseWriter, r *http.Request, orderID int, errMsg string) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	order, err := h.DB.GetOrderByID(orderID)
+	if err != nil || order.UserID != userID {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	ratings, err := h.DB.GetOrderFeedback(orderID)
+	if err != nil {
+		http.Error(w, "Could not fetch order rating", http.StatusInternalServerError)
+		return
+	}
+
+	refunds, err := h.DB.GetOrderRefunds(orderID)
+	if err != nil {
+		http.Error(w, "Could not fetch order refunds", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/order.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Username  string
+		Order     *models.Order
+		Ratings   []models.Feedback // The order's rating first, then its dishes
+		Refunds   []models.Refund
+		CanRate   bool
+		StarOrder []int
+		Error     string
+	}{
+		Username:  session.Values["username"].(string),
+		Order:     order,
+		Ratings:   ratings,
+		Refunds:   refunds,
+		CanRate:   len(ratings) == 0 && order.Status == models.OrderStatusCollected,
+		StarOrder: []int{5, 4, 3, 2, 1},
+		Error:     errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// RateOrder handler records the user's rating of a collected order and its dishes
+func (h *Handler) RateOrder(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	orderID, err := strconv.Atoi(r.FormValue("order_id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	foodQuality, err := strconv.Atoi(r.FormValue("food_quality"))
+	if err != nil || foodQuality < 1 || foodQuality > 5 {
+		h.renderOrder(w, r, orderID, "Please rate the food quality")
+		return
+	}
+
+	service, err := strconv.Atoi(r.FormValue("service"))
+	if err != nil || service < 1 || service > 5 {
+		h.renderOrder(w, r, orderID, "Please rate the service")
+		return
+	}
+
+	// Dish ratings are optional, unrated dishes are left out
+	order, err := h.DB.GetOrderByID(orderID)
+	if err != nil || order.UserID != userID {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	productRatings := make(map[int]int)
+	for _, item := range order.Items {
+		rating, err := strconv.Atoi(r.FormValue("product_" + strconv.Itoa(item.ProductID)))
+		if err == nil && rating >= 1 && rating <= 5 {
+			productRatings[item.ProductID] = rating
+		}
+	}
+
+	err = h.DB.RateOrder(userID, orderID, foodQuality, service, strings.TrimSpace(r.FormValue("comments")), productRatings)
+	if err != nil {
+		switch err {
+		case models.ErrOrderNotRateable:
+			h.renderOrder(w, r, orderID, "You can rate an order once you have collected it")
+		case models.ErrAlreadyRated:
+			h.renderOrder(w, r, orderID, "You have already rated this order")
+		default:
+			h.renderOrder(w, r, orderID, "Failed to save your rating")
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/order?id="+strconv.Itoa(orderID), http.StatusSeeOther)
+}
+
+// MyOrdersLimit is how many past orders the my orders page lists
+const MyOrdersLimit = 50
+
+// MyOrders handler lists the user's past orders
+func (h *Handler) MyOrders(w http.ResponseWriter, r *http.Request) {
+	h.renderMyOrders(w, r, nil, "")
+}
+
+// renderMyOrders renders the user's past orders with the outcome of a
+// reorder, if one was just made, and an optional error
+func (h *Handler) renderMyOrders(w http.ResponseWriter, r *http.Request, reordered []models.ReorderedItem, errMsg string) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	orders, err := h.DB.GetUserOrders(userID, MyOrdersLimit)
+	if err != nil {
+		http.Error(w, "Could not fetch orders", http.StatusInternalServerError)
+		return
+	}
+
+	balance, err := h.DB.GetWalletBalance(userID)
+	if err != nil {
+		http.Error(w, "Could not fetch wallet", http.StatusInternalServerError)
+		return
+	}
+
+	// Sort the reorder outcome into what made it to the cart and what did not
+	var added, missing []models.ReorderedItem
+	for _, item := range reordered {
+		if item.Outcome == models.ReorderAdded {
+			added = append(added, item)
+		} else {
+			missing = append(missing, item)
+		}
+	}
+
+	tmpl, err := template.ParseFiles("templates/my-orders.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Username  string
+		Orders    []models.Order
+		Balance   float64
+		Reordered bool
+		Added     []models.ReorderedItem
+		Missing   []models.ReorderedItem
+		Error     string
+	}{
+		Username:  session.Values["username"].(string),
+		Orders:    orders,
+		Balance:   balance,
+		Reordered: len(reordered) > 0,
+		Added:     added,
+		Missing:   missing,
+		Error:     errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// Reorder handler adds the items of one of the user's past orders to their cart
+func (h *Handler) Reorder(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	orderID, err := strconv.Atoi(r.FormValue("order_id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.DB.GetOrderByID(orderID)
+	if err != nil || order.UserID != userID {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	reordered, err := h.DB.Reorder(userID, order)
+	if err != nil {
+		h.renderMyOrders(w, r, nil, "Failed to add the order to your cart")
+		return
+	}
+
+	h.renderMyOrders(w, r, reordered, "")
+}
+
+// CancelOrder handler lets users cancel one of their orders before the
+// kitchen starts on it. The order is refunded to how it was paid, or to the
+// wallet if it was paid in cash.
+func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	orderID, err := strconv.Atoi(r.FormValue("order_id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.DB.GetOrderByID(orderID)
+	if err != nil || order.UserID != userID {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	// Cash cannot be handed back online, so it is credited to the wallet
+	refundMethod := ""
+	if order.PaymentMethod == models.PaymentCash {
+		refundMethod = models.PaymentWallet
+	}
+
+	if err := h.DB.CancelOrder(orderID, userID, false, "Cancelled by customer", refundMethod); err != nil {
+		if err == models.ErrOrderNotCancellable {
+			h.renderOrder(w, r, orderID, "The kitchen has already started on this order, please ask at the counter")
+		} else {
+			h.renderOrder(w, r, orderID, "Failed to cancel the order")
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/order?id="+strconv.Itoa(orderID), http.StatusSeeOther)
+}
+
+// Kitchen handler shows the orders the kitchen has to work on
+func (h *Handler) Kitchen(w http.ResponseWriter, r *http.Request) {
+	leadTime, err := h.DB.GetKitchenLeadTime()
+	if err != nil {
+		http.Error(w, "Could not load kitchen settings", http.StatusInternalServerError)
+		return
+	}
+
+	orders, err := h.DB.GetKitchenOrders(time.Now(), leadTime)
+	if err != nil {
+		http.Error(w, "Could not fetch orders", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/kitchen.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Orders          []models.Order
+		LeadTimeMinutes int
+		Error           string
+	}{
+		Orders:          orders,
+		LeadTimeMinutes: int(leadTime.Minutes()),
+		Error:           kitchenErrors[r.URL.Query().Get("error")],
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// kitchenErrors maps the error codes kitchen actions redirect with to messages
+var kitchenErrors = map[string]string{
+	"invalid_status": "That order cannot move to that status.",
+	"not_found":      "Order not found.",
+	"update_failed":  "Failed to update the order.",
+}
+
+// UpdateOrderStatus handler moves an order along the kitchen workflow
+func (h *Handler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("order_id"))
+	if err != nil {
+		http.Redirect(w, r, "/kitchen?error=not_found", http.StatusSeeOther)
+		return
+	}
+
+	if err := h.DB.UpdateOrderStatus(id, r.FormValue("status")); err != nil {
+		switch err {
+		case models.ErrInvalidStatusChange:
+			http.Redirect(w, r, "/kitchen?error=invalid_status", http.StatusSeeOther)
+		case sql.ErrNoRows:
+			http.Redirect(w, r, "/kitchen?error=not_found", http.StatusSeeOther)
+		default:
+			http.Redirect(w, r, "/kitchen?error=update_failed", http.StatusSeeOther)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/kitchen", http.StatusSeeOther)
+}
+
+// PickupSlots handler shows the pickup slot configuration page
+func (h *Handler) PickupSlots(w http.ResponseWriter, r *http.Request) {
+	h.renderPickupSlots(w, "")
+}
+
+// renderPickupSlots renders the pickup slot page with an optional error
+func (h *Handler) renderPickupSlots(w http.ResponseWriter, errMsg string) {
+	slots, err := h.DB.GetPickupSlots(time.Now())
+	if err != nil {
+		http.Error(w, "Could not fetch pickup slots", http.StatusInternalServerError)
+		return
+	}
+
+	leadTime, err := h.DB.GetKitchenLeadTime()
+	if err != nil {
+		http.Error(w, "Could not load kitchen settings", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/pickup-slots.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Slots           []models.PickupSlot
+		LeadTimeMinutes int
+		Error           string
+	}{
+		Slots:           slots,
+		LeadTimeMinutes: int(leadTime.Minutes()),
+		Error:           errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// AddPickupSlot handler creates a new pickup slot
+func (h *Handler) AddPickupSlot(w http.ResponseWriter, r *http.Request) {
+	label := r.FormValue("label")
+	startTime := r.FormValue("start_time")
+	endTime := r.FormValue("end_time")
+
+	start, err := time.Parse("15:04", startTime)
+	if err != nil {
+		h.renderPickupSlots(w, "Invalid start time")
+		return
+	}
+	end, err := time.Parse("15:04", endTime)
+	if err != nil || !end.After(start) {
+		h.renderPickupSlots(w, "End time must be after start time")
+		return
+	}
+
+	capacity, err := strconv.Atoi(r.FormValue("capacity"))
+	if err != nil || capacity < 1 {
+		h.renderPickupSlots(w, "Capacity must be at least 1")
+		return
+	}
+
+	if label == "" {
+		label = startTime + " - " + endTime
+	}
+
+	if err := h.DB.CreatePickupSlot(label, startTime, endTime, capacity); err != nil {
+		h.renderPickupSlots(w, "Failed to create pickup slot")
+		return
+	}
+
+	http.Redirect(w, r, "/pickup-slots", http.StatusSeeOther)
+}
+
+// TogglePickupSlot handler enables or disables a pickup slot
+func (h *Handler) TogglePickupSlot(w http.ResponseWriter, r *http.Request) {
+	if id, err := strconv.Atoi(r.FormValue("slot_id")); err == nil {
+		h.DB.SetPickupSlotActive(id, r.FormValue("active") == "1")
+	}
+	http.Redirect(w, r, "/pickup-slots", http.StatusSeeOther)
+}
+
+// UpdateKitchenSettings handler stores the kitchen lead time
+func (h *Handler) UpdateKitchenSettings(w http.ResponseWriter, r *http.Request) {
+	minutes, err := strconv.Atoi(r.FormValue("lead_minutes"))
+	if err != nil || minutes < 0 {
+		h.renderPickupSlots(w, "Lead time must be zero or more minutes")
+		return
+	}
+
+	if err := h.DB.SetKitchenLeadTime(minutes); err != nil {
+		h.renderPickupSlots(w, "Failed to save kitchen settings")
+		return
+	}
+
+	http.Redirect(w, r, "/pickup-slots", http.StatusSeeOther)
+}
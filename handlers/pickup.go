@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"auth-website/models"
+	"auth-website/qrcode"
+)
+
+// Order pickup verification related handlers
+
+// OrderQR handler serves an order's signed pickup code as a QR code image.
+// Customers can only fetch the codes of their own orders.
+func (h *Handler) OrderQR(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, _ := session.Values["user_id"].(int)
+	role, _ := session.Values["role"].(string)
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.DB.GetOrderByID(id)
+	isStaff := role == models.RoleAdmin || role == models.RoleCashier
+	if err != nil || (order.UserID != userID && !isStaff) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	code, err := h.DB.GetPickupCode(id)
+	if err != nil {
+		http.Error(w, "Could not create the pickup code", http.StatusInternalServerError)
+		return
+	}
+	qr, err := qrcode.Encode(code)
+	if err != nil {
+		http.Error(w, "Could not create the pickup code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(qr.SVG(6))
+}
+
+// PickupScan handler shows the pickup counter's scan page. A scanned code is
+// checked and the order it belongs to shown, ready to be handed over.
+func (h *Handler) PickupScan(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimSpace(r.URL.Query().Get("code"))
+	if code == "" {
+		var collected *models.Order
+		if id, err := strconv.Atoi(r.URL.Query().Get("collected")); err == nil {
+			collected, _ = h.DB.GetOrderByID(id)
+		}
+		h.renderPickupScan(w, "", nil, collected, "")
+		return
+	}
+
+	order, err := h.DB.VerifyPickupCode(code)
+	if err != nil {
+		h.renderPickupScan(w, code, nil, nil, pickupError(err))
+		return
+	}
+
+	errMsg := ""
+	switch {
+	case order.Status == models.OrderStatusCollected:
+		errMsg = pickupError(models.ErrAlreadyCollected)
+	case !order.Collectable():
+		errMsg = pickupError(models.ErrOrderNotCollectable)
+	}
+	h.renderPickupScan(w, code, order, nil, errMsg)
+}
+
+// CollectOrder handler marks the order behind a scanned code as collected
+func (h *Handler) CollectOrder(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	staffID, _ := session.Values["user_id"].(int)
+
+	code := strings.TrimSpace(r.FormValue("code"))
+	order, err := h.DB.CollectOrder(code, staffID)
+	if err != nil {
+		// Show what the code belongs to alongside why it was rejected
+		shown, _ := h.DB.VerifyPickupCode(code)
+		h.renderPickupScan(w, code, shown, nil, pickupError(err))
+		return
+	}
+
+	http.Redirect(w, r, "/pickup-scan?collected="+strconv.Itoa(order.ID), http.StatusSeeOther)
+}
+
+// pickupError returns the message shown at the counter for a rejected code
+func pickupError(err error) string {
+	switch err {
+	case models.ErrInvalidPickupCode:
+		return "This code is not valid. Ask the customer for their order page or receipt."
+	case models.ErrAlreadyCollected:
+		return "This order has already been collected. Do not hand it over again."
+	case models.ErrOrderNotCollectable:
+		return "This order cannot be collected."
+	}
+	return "Failed to check the code"
+}
+
+// renderPickupScan renders the scan page with the scanned order, the order
+// that was just collected and an optional error
+func (h *Handler) renderPickupScan(w http.ResponseWriter, code string, order, collected *models.Order, errMsg string) {
+	tmpl, err := template.ParseFiles("templates/pickup-scan.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Code      string
+		Order     *models.Order
+		Collected *models.Order
+		Error     string
+	}{
+		Code:      code,
+		Order:     order,
+		Collected: collected,
+		Error:     errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
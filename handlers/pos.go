@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"auth-website/models"
+	"auth-website/printing"
+)
+
+// Point of sale and staff role related handlers
+
+// CustomerSearchLimit is the most customers a point of sale lookup lists
+const CustomerSearchLimit = 10
+
+// posErrors maps the error codes point of sale actions redirect with to messages
+var posErrors = map[string]string{
+	"insufficient_stock":  "Not enough stock for that quantity.",
+	"unavailable":         "That product is no longer on the menu.",
+	"invalid_options":     "Please choose the options for this item.",
+	"empty_cart":          "Add some items before taking payment.",
+	"low_balance":         "The customer's wallet balance is too low for this order.",
+	"no_customer":         "Look up the customer to pay from their wallet.",
+	"insufficient_tender": "The cash tendered does not cover the total.",
+	"no_shift":            "Open a shift before taking payment.",
+}
+
+// redirectToPOS sends the cashier back to the point of sale with an optional error code
+func redirectToPOS(w http.ResponseWriter, r *http.Request, errCode string) {
+	target := "/pos"
+	if errCode != "" {
+		target += "?" + url.Values{"error": {errCode}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// POS handler shows the point of sale: the product grid, the order being
+// built and the customer it is for
+func (h *Handler) POS(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	cashierID, _ := session.Values["user_id"].(int)
+
+	products, err := h.DB.GetMenu(models.MenuFilter{})
+	if err != nil {
+		http.Error(w, "Could not fetch products", http.StatusInternalServerError)
+		return
+	}
+
+	cart, err := h.DB.GetUserCart(cashierID)
+	if err != nil {
+		http.Error(w, "Could not load the order", http.StatusInternalServerError)
+		return
+	}
+
+	shift, err := h.DB.GetOpenShift(cashierID)
+	if err != nil {
+		http.Error(w, "Could not load the shift", http.StatusInternalServerError)
+		return
+	}
+
+	// The customer the order is for, if one was looked up
+	var customer *models.User
+	var balance float64
+	if customerID, ok := session.Values["pos_customer_id"].(int); ok {
+		if customer, err = h.DB.GetUserByID(customerID); err == nil {
+			balance, err = h.DB.GetWalletBalance(customerID)
+		}
+		if err != nil {
+			http.Error(w, "Could not load the customer", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var matches []models.User
+	search := strings.TrimSpace(r.URL.Query().Get("customer_q"))
+	if search != "" {
+		if matches, err = h.DB.FindCustomers(search, CustomerSearchLimit); err != nil {
+			http.Error(w, "Could not search customers", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// A product with options gets its option picker opened, keeping the
+	// quantity that was keyed in
+	quantity, err := strconv.Atoi(r.URL.Query().Get("quantity"))
+	if err != nil || quantity <= 0 {
+		quantity = 1
+	}
+	var optionsProduct *models.Product
+	var options models.ProductOptions
+	if id, err := strconv.Atoi(r.URL.Query().Get("options")); err == nil {
+		if optionsProduct, err = h.DB.GetProductByID(id); err == nil {
+			options, err = h.DB.GetProductOptions(id, true)
+		}
+		if err != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	tmpl, err := template.ParseFiles("templates/pos.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Username       string
+		Products       []models.Product
+		Cart           *models.Cart
+		Shift          *models.Shift
+		Customer       *models.User
+		Balance        float64
+		CustomerSearch string
+		Matches        []models.User
+		OptionsProduct *models.Product
+		Options        models.ProductOptions
+		Quantity       int
+		Error          string
+	}{
+		Username:       session.Values["username"].(string),
+		Products:       products,
+		Cart:           cart,
+		Shift:          shift,
+		Customer:       customer,
+		Balance:        balance,
+		CustomerSearch: search,
+		Matches:        matches,
+		OptionsProduct: optionsProduct,
+		Options:        options,
+		Quantity:       quantity,
+		Error:          posErrors[r.URL.Query().Get("error")],
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// POSAddItem handler adds a product to the order being built
+func (h *Handler) POSAddItem(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	cashierID, _ := session.Values["user_id"].(int)
+
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	quantity, err := strconv.Atoi(r.FormValue("quantity"))
+	if err != nil || quantity <= 0 {
+		quantity = 1
+	}
+
+	r.ParseForm()
+	selection := optionSelection(r.Form)
+	if err := h.DB.AddToCart(cashierID, productID, quantity, selection); err != nil {
+		switch err {
+		case models.ErrInsufficientStock:
+			redirectToPOS(w, r, "insufficient_stock")
+		case models.ErrProductUnavailable:
+			redirectToPOS(w, r, "unavailable")
+		case models.ErrInvalidOptions:
+			// Open the option picker for the product
+			query := url.Values{"options": {strconv.Itoa(productID)}, "quantity": {strconv.Itoa(quantity)}}
+			if selection.VariantID != 0 || len(selection.ModifierIDs) > 0 {
+				query.Set("error", "invalid_options")
+			}
+			http.Redirect(w, r, "/pos?"+query.Encode(), http.StatusSeeOther)
+		default:
+			http.Error(w, "Failed to add item", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	redirectToPOS(w, r, "")
+}
+
+// POSUpdateItem handler changes the quantity of a line of the order being
+// built. A quantity of 0 removes the line.
+func (h *Handler) POSUpdateItem(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	cashierID, _ := session.Values["user_id"].(int)
+
+	itemID, err := strconv.Atoi(r.FormValue("item_id"))
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	quantity, err := strconv.Atoi(r.FormValue("quantity"))
+	if err != nil || quantity < 0 {
+		http.Error(w, "Invalid quantity", http.StatusBadRequest)
+		return
+	}
+
+	// Only lines of the cashier's own order can be changed
+	if quantity == 0 {
+		err = h.DB.RemoveFromCart(cashierID, itemID)
+	} else {
+		err = h.DB.UpdateCartItemQuantity(cashierID, itemID, quantity)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+		if err == models.ErrInsufficientStock {
+			redirectToPOS(w, r, "insufficient_stock")
+			return
+		}
+		http.Error(w, "Failed to update item", http.StatusInternalServerError)
+		return
+	}
+
+	redirectToPOS(w, r, "")
+}
+
+// POSClear handler empties the order being built and forgets its customer
+func (h *Handler) POSClear(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	cashierID, _ := session.Values["user_id"].(int)
+
+	if err := h.DB.ClearCart(cashierID); err != nil {
+		http.Error(w, "Failed to clear the order", http.StatusInternalServerError)
+		return
+	}
+
+	delete(session.Values, "pos_customer_id")
+	session.Save(r, w)
+	redirectToPOS(w, r, "")
+}
+
+// POSSetCustomer handler picks the customer the order is for. A customer ID
+// of 0 goes back to an anonymous walk-in order.
+func (h *Handler) POSSetCustomer(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+
+	customerID, err := strconv.Atoi(r.FormValue("customer_id"))
+	if err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+
+	if customerID == 0 {
+		delete(session.Values, "pos_customer_id")
+	} else {
+		customer, err := h.DB.GetUserByID(customerID)
+		if err != nil || customer.Role == models.RoleWalkIn {
+			http.Error(w, "Customer not found", http.StatusNotFound)
+			return
+		}
+		session.Values["pos_customer_id"] = customerID
+	}
+	session.Save(r, w)
+	redirectToPOS(w, r, "")
+}
+
+// POSCheckout handler takes payment for the order being built and places it
+func (h *Handler) POSCheckout(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	cashierID, _ := session.Values["user_id"].(int)
+	customerID, _ := session.Values["pos_customer_id"].(int)
+
+	var paymentMethod string
+	var tendered float64
+	switch r.FormValue("payment_method") {
+	case models.PaymentCash:
+		paymentMethod = models.PaymentCash
+		amount, err := parseAmount(r.FormValue("tendered"))
+		if err != nil || amount < 0 {
+			redirectToPOS(w, r, "insufficient_tender")
+			return
+		}
+		tendered = amount
+	case models.PaymentWallet:
+		if customerID == 0 {
+			redirectToPOS(w, r, "no_customer")
+			return
+		}
+		paymentMethod = models.PaymentWallet
+	default:
+		paymentMethod = models.PaymentCard
+	}
+
+	orderID, err := h.DB.PlaceCounterOrder(cashierID, customerID, paymentMethod, tendered)
+	if err != nil {
+		switch err {
+		case models.ErrEmptyCart:
+			redirectToPOS(w, r, "empty_cart")
+		case models.ErrInsufficientBalance:
+			redirectToPOS(w, r, "low_balance")
+		case models.ErrInsufficientTender:
+			redirectToPOS(w, r, "insufficient_tender")
+		case models.ErrNoOpenShift:
+			redirectToPOS(w, r, "no_shift")
+		default:
+			http.Error(w, "Failed to place order", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// A failed print is not fatal: the receipt can be reprinted from its page
+	h.printReceipt(orderID)
+
+	// The next order starts out anonymous again
+	delete(session.Values, "pos_customer_id")
+	session.Save(r, w)
+	http.Redirect(w, r, "/pos-receipt?id="+strconv.Itoa(orderID), http.StatusSeeOther)
+}
+
+// POSReceipt handler shows the printable receipt of an order
+func (h *Handler) POSReceipt(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.DB.GetOrderByID(id)
+	if err != nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	token, err := h.DB.GetOrderToken(order)
+	if err != nil {
+		http.Error(w, "Could not load the receipt", http.StatusInternalServerError)
+		return
+	}
+	header, err := h.DB.GetSetting(models.SettingReceiptHeader, models.DefaultReceiptHeader)
+	if err != nil {
+		http.Error(w, "Could not load the receipt", http.StatusInternalServerError)
+		return
+	}
+	taxRate, err := h.DB.GetTaxRate()
+	if err != nil {
+		http.Error(w, "Could not load the receipt", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/receipt.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Order      *models.Order
+		WalkIn     bool
+		Receipt    printing.Receipt
+		HasPrinter bool
+		Printed    bool
+	}{
+		Order:      order,
+		WalkIn:     order.Username == models.WalkInUsername,
+		Receipt:    printing.Receipt{Order: *order, Token: token, TaxRate: taxRate, ShopName: header},
+		HasPrinter: h.Receipts != nil,
+		Printed:    r.URL.Query().Get("printed") == "1",
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// Staff handler lists users with the roles an admin can give them
+func (h *Handler) Staff(w http.ResponseWriter, r *http.Request) {
+	users, err := h.DB.GetAllUsers()
+	if err != nil {
+		http.Error(w, "Could not fetch users", http.StatusInternalServerError)
+		return
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+
+	tmpl, err := template.ParseFiles("templates/staff.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Users   []models.User
+		Roles   []string
+		AdminID int
+		WalkIn  string
+	}{
+		Users:   users,
+		Roles:   models.StaffRoles,
+		AdminID: adminID,
+		WalkIn:  models.RoleWalkIn,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// SetUserRole handler changes the role of a user. Admins cannot change
+// their own role, so there is always an admin left.
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+
+	role := r.FormValue("role")
+	valid := false
+	for _, staffRole := range models.StaffRoles {
+		valid = valid || role == staffRole
+	}
+	if !valid || userID == adminID {
+		http.Error(w, "Invalid role change", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.SetUserRole(userID, role); err != nil {
+		http.Error(w, "Failed to change role", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/staff", http.StatusSeeOther)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"auth-website/models"
+)
+
+// Thermal receipt printing related handlers
+
+// PrintJobListLimit is how many recent print jobs the print jobs page lists
+const PrintJobListLimit = 50
+
+// printReceipt queues the receipt of an order for the thermal printer, if there is one
+func (h *Handler) printReceipt(orderID int) error {
+	if h.Receipts == nil {
+		return nil
+	}
+	_, err := h.Receipts.EnqueueOrder(orderID)
+	if err != nil {
+		log.Printf("Failed to queue receipt for order %d: %v", orderID, err)
+	}
+	return err
+}
+
+// POSPrintReceipt handler sends the receipt of an order to the thermal printer again
+func (h *Handler) POSPrintReceipt(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("order_id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+	if h.Receipts == nil {
+		http.Error(w, "No receipt printer is configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := h.printReceipt(id); err != nil {
+		http.Error(w, "Failed to print the receipt", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/pos-receipt?id="+strconv.Itoa(id)+"&printed=1", http.StatusSeeOther)
+}
+
+// PrintJobs handler shows the print queue and the receipt settings
+func (h *Handler) PrintJobs(w http.ResponseWriter, r *http.Request) {
+	h.renderPrintJobs(w, "")
+}
+
+// renderPrintJobs renders the print jobs page with an optional error
+func (h *Handler) renderPrintJobs(w http.ResponseWriter, errMsg string) {
+	jobs, err := h.DB.GetPrintJobs(PrintJobListLimit)
+	if err != nil {
+		http.Error(w, "Could not fetch print jobs", http.StatusInternalServerError)
+		return
+	}
+	header, err := h.DB.GetSetting(models.SettingReceiptHeader, models.DefaultReceiptHeader)
+	if err != nil {
+		http.Error(w, "Could not load receipt settings", http.StatusInternalServerError)
+		return
+	}
+	taxRate, err := h.DB.GetTaxRate()
+	if err != nil {
+		http.Error(w, "Could not load receipt settings", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/print-jobs.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Jobs       []models.PrintJob
+		Header     string
+		TaxRate    float64
+		HasPrinter bool
+		Error      string
+	}{
+		Jobs:       jobs,
+		Header:     header,
+		TaxRate:    taxRate,
+		HasPrinter: h.Receipts != nil,
+		Error:      errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// RetryPrintJob handler puts a print job back in the queue
+func (h *Handler) RetryPrintJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("job_id"))
+	if err != nil {
+		h.renderPrintJobs(w, "Invalid print job")
+		return
+	}
+
+	if err := h.DB.RetryPrintJob(id); err != nil {
+		h.renderPrintJobs(w, "Failed to retry the print job")
+		return
+	}
+	if h.Receipts != nil {
+		h.Receipts.Wake()
+	}
+
+	http.Redirect(w, r, "/print-jobs", http.StatusSeeOther)
+}
+
+// UpdateReceiptSettings handler stores the receipt header and tax rate
+func (h *Handler) UpdateReceiptSettings(w http.ResponseWriter, r *http.Request) {
+	header := strings.TrimSpace(r.FormValue("header"))
+	if header == "" {
+		h.renderPrintJobs(w, "Receipt header is required")
+		return
+	}
+
+	taxRate, err := strconv.ParseFloat(r.FormValue("tax_rate"), 64)
+	if err != nil || taxRate < 0 || taxRate > 100 {
+		h.renderPrintJobs(w, "Tax rate must be between 0 and 100 percent")
+		return
+	}
+
+	if err := h.DB.SetReceiptSettings(header, taxRate); err != nil {
+		h.renderPrintJobs(w, "Failed to save receipt settings")
+		return
+	}
+
+	http.Redirect(w, r, "/print-jobs", http.StatusSeeOther)
+}
@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-website/models"
+)
+
+// Purchasing related handlers
+
+// Suppliers handler shows the supplier management page
+func (h *Handler) Suppliers(w http.ResponseWriter, r *http.Request) {
+	h.renderSuppliers(w, "")
+}
+
+// renderSuppliers renders the supplier management page with an optional error
+func (h *Handler) renderSuppliers(w http.ResponseWriter, errMsg string) {
+	suppliers, err := h.DB.GetAllSuppliers()
+	if err != nil {
+		http.Error(w, "Could not fetch suppliers", http.StatusInternalServerError)
+		return
+	}
+
+	products, err := h.DB.GetAllProducts()
+	if err != nil {
+		http.Error(w, "Could not fetch products", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/suppliers.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Suppliers []models.Supplier
+		Products  []models.Product
+		Error     string
+	}{
+		Suppliers: suppliers,
+		Products:  products,
+		Error:     errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// supplierForm reads and validates the fields shared by the add and update supplier forms
+func supplierForm(r *http.Request) (models.Supplier, string) {
+	supplier := models.Supplier{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		ContactName: strings.TrimSpace(r.FormValue("contact_name")),
+		Phone:       strings.TrimSpace(r.FormValue("phone")),
+		Email:       strings.TrimSpace(r.FormValue("email")),
+		Notes:       strings.TrimSpace(r.FormValue("notes")),
+	}
+	if supplier.Name == "" {
+		return supplier, "Supplier name is required"
+	}
+
+	if leadStr := r.FormValue("lead_time_days"); leadStr != "" {
+		leadTime, err := strconv.Atoi(leadStr)
+		if err != nil || leadTime < 0 {
+			return supplier, "Lead time must be a whole number of days"
+		}
+		supplier.LeadTimeDays = leadTime
+	}
+
+	return supplier, ""
+}
+
+// AddSupplier handler creates a new supplier
+func (h *Handler) AddSupplier(w http.ResponseWriter, r *http.Request) {
+	supplier, errMsg := supplierForm(r)
+	if errMsg != "" {
+		h.renderSuppliers(w, errMsg)
+		return
+	}
+
+	if err := h.DB.CreateSupplier(supplier); err != nil {
+		h.renderSuppliers(w, "Failed to create supplier, the name may already exist")
+		return
+	}
+
+	http.Redirect(w, r, "/suppliers", http.StatusSeeOther)
+}
+
+// UpdateSupplier handler saves changes to an existing supplier
+func (h *Handler) UpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("supplier_id"))
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	supplier, errMsg := supplierForm(r)
+	if errMsg != "" {
+		h.renderSuppliers(w, errMsg)
+		return
+	}
+	supplier.ID = id
+
+	if err := h.DB.UpdateSupplier(supplier); err != nil {
+		h.renderSuppliers(w, "Failed to update supplier, the name may already exist")
+		return
+	}
+
+	http.Redirect(w, r, "/suppliers", http.StatusSeeOther)
+}
+
+// SetSupplierItem handler records a product a supplier provides and its cost
+func (h *Handler) SetSupplierItem(w http.ResponseWriter, r *http.Request) {
+	supplierID, err := strconv.Atoi(r.FormValue("supplier_id"))
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		h.renderSuppliers(w, "Choose a product")
+		return
+	}
+
+	unitCost, err := strconv.ParseFloat(r.FormValue("unit_cost"), 64)
+	if err != nil || unitCost < 0 {
+		h.renderSuppliers(w, "Invalid unit cost")
+		return
+	}
+
+	if err := h.DB.SetSupplierItem(supplierID, productID, unitCost); err != nil {
+		h.renderSuppliers(w, "Failed to save supplier item")
+		return
+	}
+
+	http.Redirect(w, r, "/suppliers", http.StatusSeeOther)
+}
+
+// RemoveSupplierItem handler removes a product from a supplier's items
+func (h *Handler) RemoveSupplierItem(w http.ResponseWriter, r *http.Request) {
+	supplierID, err := strconv.Atoi(r.FormValue("supplier_id"))
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.RemoveSupplierItem(supplierID, productID); err != nil {
+		h.renderSuppliers(w, "Failed to remove supplier item")
+		return
+	}
+
+	http.Redirect(w, r, "/suppliers", http.StatusSeeOther)
+}
+
+// PurchaseOrders handler lists purchase orders
+func (h *Handler) PurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := h.DB.GetAllPurchaseOrders()
+	if err != nil {
+		http.Error(w, "Could not fetch purchase orders", http.StatusInternalServerError)
+		return
+	}
+
+	suppliers, err := h.DB.GetAllSuppliers()
+	if err != nil {
+		http.Error(w, "Could not fetch suppliers", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/purchase-orders.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Orders    []models.PurchaseOrder
+		Suppliers []models.Supplier
+	}{
+		Orders:    orders,
+		Suppliers: suppliers,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// CreatePurchaseOrder handler starts a draft purchase order for a supplier
+func (h *Handler) CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	supplierID, err := strconv.Atoi(r.FormValue("supplier_id"))
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+
+	poID, err := h.DB.CreatePurchaseOrder(supplierID, strings.TrimSpace(r.FormValue("notes")), adminID)
+	if err != nil {
+		http.Error(w, "Failed to create purchase order", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/purchase-order?id="+strconv.Itoa(poID), http.StatusSeeOther)
+}
+
+// ViewPurchaseOrder handler shows a purchase order with its lines and receipts
+func (h *Handler) ViewPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+	h.renderPurchaseOrder(w, id, "")
+}
+
+// renderPurchaseOrder renders the purchase order page with an optional error
+func (h *Handler) renderPurchaseOrder(w http.ResponseWriter, poID int, errMsg string) {
+	po, err := h.DB.GetPurchaseOrderByID(poID)
+	if err != nil {
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+		return
+	}
+
+	supplier, err := h.DB.GetSupplierByID(po.SupplierID)
+	if err != nil {
+		http.Error(w, "Could not fetch supplier", http.StatusInternalServerError)
+		return
+	}
+
+	receipts, err := h.DB.GetGoodsReceipts(poID)
+	if err != nil {
+		http.Error(w, "Could not fetch goods receipts", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/purchase-order.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Order    *models.PurchaseOrder
+		Supplier *models.Supplier
+		Receipts []models.GoodsReceipt
+		Error    string
+	}{
+		Order:    po,
+		Supplier: supplier,
+		Receipts: receipts,
+		Error:    errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// AddPurchaseOrderLine handler adds a product to a draft purchase order
+func (h *Handler) AddPurchaseOrderLine(w http.ResponseWriter, r *http.Request) {
+	poID, err := strconv.Atoi(r.FormValue("purchase_order_id"))
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		h.renderPurchaseOrder(w, poID, "Choose a product")
+		return
+	}
+
+	quantity, err := strconv.Atoi(r.FormValue("quantity"))
+	if err != nil || quantity <= 0 {
+		h.renderPurchaseOrder(w, poID, "Quantity must be a positive whole number")
+		return
+	}
+
+	// Leaving the cost blank uses the supplier's recorded cost
+	var unitCost float64
+	if costStr := r.FormValue("unit_cost"); costStr != "" {
+		unitCost, err = strconv.ParseFloat(costStr, 64)
+		if err != nil || unitCost < 0 {
+			h.renderPurchaseOrder(w, poID, "Invalid unit cost")
+			return
+		}
+	}
+
+	err = h.DB.AddPurchaseOrderLine(poID, productID, quantity, unitCost)
+	if err == models.ErrInvalidPurchaseOrder {
+		h.renderPurchaseOrder(w, poID, "Lines can only be added to draft orders")
+		return
+	}
+	if err == models.ErrRecipeStock {
+		h.renderPurchaseOrder(w, poID, "Products made to a recipe are restocked through their ingredients")
+		return
+	}
+	if err != nil {
+		h.renderPurchaseOrder(w, poID, "Failed to add line")
+		return
+	}
+
+	http.Redirect(w, r, "/purchase-order?id="+strconv.Itoa(poID), http.StatusSeeOther)
+}
+
+// RemovePurchaseOrderLine handler removes a line from a draft purchase order
+func (h *Handler) RemovePurchaseOrderLine(w http.ResponseWriter, r *http.Request) {
+	poID, err := strconv.Atoi(r.FormValue("purchase_order_id"))
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	lineID, err := strconv.Atoi(r.FormValue("line_id"))
+	if err != nil {
+		http.Error(w, "Invalid line ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.RemovePurchaseOrderLine(poID, lineID); err != nil {
+		h.renderPurchaseOrder(w, poID, "Lines can only be removed from draft orders")
+		return
+	}
+
+	http.Redirect(w, r, "/purchase-order?id="+strconv.Itoa(poID), http.StatusSeeOther)
+}
+
+// SendPurchaseOrder handler marks a draft purchase order as sent to the supplier
+func (h *Handler) SendPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	poID, err := strconv.Atoi(r.FormValue("purchase_order_id"))
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.SendPurchaseOrder(poID); err != nil {
+		h.renderPurchaseOrder(w, poID, "Only draft orders with at least one line can be sent")
+		return
+	}
+
+	http.Redirect(w, r, "/purchase-order?id="+strconv.Itoa(poID), http.StatusSeeOther)
+}
+
+// ReceiveGoods handler books a delivery against a sent purchase order. The
+// form has a received_<line id> and an optional expires_<line id> field per line.
+func (h *Handler) ReceiveGoods(w http.ResponseWriter, r *http.Request) {
+	poID, err := strconv.Atoi(r.FormValue("purchase_order_id"))
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	po, err := h.DB.GetPurchaseOrderByID(poID)
+	if err != nil {
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+		return
+	}
+
+	received := make(map[int]int)
+	expiries := make(map[int]time.Time)
+	for _, line := range po.Lines {
+		if expiryStr := r.FormValue("expires_" + strconv.Itoa(line.ID)); expiryStr != "" {
+			expiresAt, err := time.Parse(dateLayout, expiryStr)
+			if err != nil {
+				h.renderPurchaseOrder(w, poID, "Invalid expiry date")
+				return
+			}
+			expiries[line.ID] = expiresAt
+		}
+
+		qtyStr := strings.TrimSpace(r.FormValue("received_" + strconv.Itoa(line.ID)))
+		if qtyStr == "" {
+			continue
+		}
+		quantity, err := strconv.Atoi(qtyStr)
+		if err != nil || quantity < 0 {
+			h.renderPurchaseOrder(w, poID, "Received quantities must be whole numbers")
+			return
+		}
+		if quantity > 0 {
+			received[line.ID] = quantity
+		}
+	}
+	if len(received) == 0 {
+		h.renderPurchaseOrder(w, poID, "Enter the quantity received for at least one line")
+		return
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+
+	if err := h.DB.ReceiveGoods(poID, received, expiries, adminID); err != nil {
+		switch err {
+		case models.ErrOverReceipt:
+			h.renderPurchaseOrder(w, poID, "Cannot receive more than is outstanding on a line")
+		case models.ErrInvalidPurchaseOrder:
+			h.renderPurchaseOrder(w, poID, "Goods can only be received against sent orders")
+		default:
+			h.renderPurchaseOrder(w, poID, "Failed to record goods receipt")
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/purchase-order?id="+strconv.Itoa(poID), http.StatusSeeOther)
+}
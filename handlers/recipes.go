@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"auth-website/models"
+)
+
+// Recipe and ingredient related handlers
+
+// Ingredients handler shows ingredient stock and the ingredient ledger
+func (h *Handler) Ingredients(w http.ResponseWriter, r *http.Request) {
+	h.renderIngredients(w, "")
+}
+
+// renderIngredients renders the ingredients page with an optional error
+func (h *Handler) renderIngredients(w http.ResponseWriter, errMsg string) {
+	ingredients, err := h.DB.GetAllIngredients()
+	if err != nil {
+		http.Error(w, "Could not fetch ingredients", http.StatusInternalServerError)
+		return
+	}
+
+	movements, err := h.DB.GetIngredientMovements(50)
+	if err != nil {
+		http.Error(w, "Could not fetch ingredient history", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/ingredients.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Ingredients []models.Ingredient
+		Movements   []models.IngredientMovement
+		Error       string
+	}{
+		Ingredients: ingredients,
+		Movements:   movements,
+		Error:       errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// AddIngredient handler creates a new ingredient
+func (h *Handler) AddIngredient(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	unit := strings.TrimSpace(r.FormValue("unit"))
+	if name == "" || unit == "" {
+		h.renderIngredients(w, "Ingredient name and unit are required")
+		return
+	}
+
+	if err := h.DB.CreateIngredient(name, unit); err != nil {
+		h.renderIngredients(w, "Failed to create ingredient, the name may already exist")
+		return
+	}
+
+	http.Redirect(w, r, "/ingredients", http.StatusSeeOther)
+}
+
+// AdjustIngredient handler records a restock, wastage or correction of an ingredient
+func (h *Handler) AdjustIngredient(w http.ResponseWriter, r *http.Request) {
+	ingredientID, err := strconv.Atoi(r.FormValue("ingredient_id"))
+	if err != nil {
+		http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+		return
+	}
+
+	reason := r.FormValue("reason")
+	if !adjustmentReasons[reason] {
+		h.renderIngredients(w, "Choose a reason for the adjustment")
+		return
+	}
+
+	quantity, err := strconv.ParseFloat(r.FormValue("quantity"), 64)
+	if err != nil || quantity == 0 {
+		h.renderIngredients(w, "Quantity must be a non-zero number")
+		return
+	}
+
+	// Same sign rules as product stock adjustments
+	switch reason {
+	case models.MovementRestock:
+		if quantity < 0 {
+			quantity = -quantity
+		}
+	case models.MovementWastage:
+		if quantity > 0 {
+			quantity = -quantity
+		}
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+
+	err = h.DB.AdjustIngredientStock(ingredientID, quantity, reason, adminID, strings.TrimSpace(r.FormValue("note")))
+	if err == models.ErrInsufficientStock {
+		h.renderIngredients(w, "Ingredient stock cannot go below zero")
+		return
+	}
+	if err != nil {
+		h.renderIngredients(w, "Failed to record ingredient adjustment")
+		return
+	}
+
+	http.Redirect(w, r, "/ingredients", http.StatusSeeOther)
+}
+
+// Recipe handler shows and edits a product's recipe
+func (h *Handler) Recipe(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	h.renderRecipe(w, id, "")
+}
+
+// renderRecipe renders the recipe page with an optional error
+func (h *Handler) renderRecipe(w http.ResponseWriter, productID int, errMsg string) {
+	product, err := h.DB.GetProductByID(productID)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	items, err := h.DB.GetRecipe(productID)
+	if err != nil {
+		http.Error(w, "Could not fetch recipe", http.StatusInternalServerError)
+		return
+	}
+
+	ingredients, err := h.DB.GetAllIngredients()
+	if err != nil {
+		http.Error(w, "Could not fetch ingredients", http.StatusInternalServerError)
+		return
+	}
+
+	// The ingredient allowing the fewest portions limits the product
+	var limiting *models.RecipeItem
+	for i := range items {
+		if limiting == nil || items[i].Portions() < limiting.Portions() {
+			limiting = &items[i]
+		}
+	}
+
+	tmpl, err := template.ParseFiles("templates/recipe.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Product     *models.Product
+		Items       []models.RecipeItem
+		Limiting    *models.RecipeItem
+		Ingredients []models.Ingredient
+		Error       string
+	}{
+		Product:     product,
+		Items:       items,
+		Limiting:    limiting,
+		Ingredients: ingredients,
+		Error:       errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// SetRecipeItem handler sets how much of an ingredient goes into a product
+func (h *Handler) SetRecipeItem(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	ingredientID, err := strconv.Atoi(r.FormValue("ingredient_id"))
+	if err != nil {
+		h.renderRecipe(w, productID, "Choose an ingredient")
+		return
+	}
+
+	quantity, err := strconv.ParseFloat(r.FormValue("quantity"), 64)
+	if err != nil || quantity <= 0 {
+		h.renderRecipe(w, productID, "Quantity must be a positive number")
+		return
+	}
+
+	if err := h.DB.SetRecipeItem(productID, ingredientID, quantity); err != nil {
+		h.renderRecipe(w, productID, "Failed to save recipe")
+		return
+	}
+
+	http.Redirect(w, r, "/recipe?id="+strconv.Itoa(productID), http.StatusSeeOther)
+}
+
+// RemoveRecipeItem handler takes an ingredient out of a product's recipe
+func (h *Handler) RemoveRecipeItem(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	ingredientID, err := strconv.Atoi(r.FormValue("ingredient_id"))
+	if err != nil {
+		http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.RemoveRecipeItem(productID, ingredientID); err != nil {
+		h.renderRecipe(w, productID, "Failed to update recipe")
+		return
+	}
+
+	http.Redirect(w, r, "/recipe?id="+strconv.Itoa(productID), http.StatusSeeOther)
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"auth-website/models"
+)
+
+// Order cancellation, refund and wallet related handlers
+
+// errInvalidAmount is returned by parseAmount for values that are no amount
+var errInvalidAmount = errors.New("amount is not a finite number")
+
+// parseAmount parses a sum of money entered in a form. ParseFloat also
+// accepts "Inf" and "NaN", which would pass any comparison with zero.
+func parseAmount(s string) (float64, error) {
+	amount, err := strconv.ParseFloat(s, 64)
+	if err == nil && (math.IsInf(amount, 0) || math.IsNaN(amount)) {
+		return 0, errInvalidAmount
+	}
+	return amount, err
+}
+
+// AdminOrder handler shows an order to staff with its cancel and refund forms
+func (h *Handler) AdminOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+	h.renderAdminOrder(w, id, "")
+}
+
+// renderAdminOrder renders the staff view of an order with an optional error
+func (h *Handler) renderAdminOrder(w http.ResponseWriter, orderID int, errMsg string) {
+	order, err := h.DB.GetOrderByID(orderID)
+	if err != nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	refunds, err := h.DB.GetOrderRefunds(orderID)
+	if err != nil {
+		http.Error(w, "Could not fetch order refunds", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/admin-order.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Order   *models.Order
+		Refunds []models.Refund
+		Wallet  string
+		Error   string
+	}{
+		Order:   order,
+		Refunds: refunds,
+		Wallet:  models.PaymentWallet,
+		Error:   errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// redirectToAdminOrder sends staff back to the staff view of an order
+func redirectToAdminOrder(w http.ResponseWriter, r *http.Request, orderID int) {
+	http.Redirect(w, r, "/admin-order?id="+strconv.Itoa(orderID), http.StatusSeeOther)
+}
+
+// StaffCancelOrder handler cancels an order at any stage, with a reason
+func (h *Handler) StaffCancelOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.FormValue("order_id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		h.renderAdminOrder(w, orderID, "Please give a reason for cancelling the order")
+		return
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+
+	if err := h.DB.CancelOrder(orderID, adminID, true, reason, r.FormValue("refund_method")); err != nil {
+		switch err {
+		case models.ErrOrderNotCancellable:
+			h.renderAdminOrder(w, orderID, "The order is already cancelled")
+		case models.ErrInvalidRefund:
+			h.renderAdminOrder(w, orderID, "Orders can only be refunded to how they were paid or to the wallet")
+		case models.ErrNoOpenShift:
+			h.renderAdminOrder(w, orderID, "Open a shift to hand cash back from your drawer, or refund to the wallet")
+		default:
+			h.renderAdminOrder(w, orderID, "Failed to cancel the order")
+		}
+		return
+	}
+
+	redirectToAdminOrder(w, r, orderID)
+}
+
+// RefundOrderItem handler refunds units of an order line that were missing
+func (h *Handler) RefundOrderItem(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.FormValue("order_id"))
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	itemID, err := strconv.Atoi(r.FormValue("order_item_id"))
+	if err != nil {
+		http.Error(w, "Invalid order item ID", http.StatusBadRequest)
+		return
+	}
+
+	quantity, err := strconv.Atoi(r.FormValue("quantity"))
+	if err != nil || quantity <= 0 {
+		h.renderAdminOrder(w, orderID, "Quantity to refund must be at least 1")
+		return
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		reason = "Missing from order"
+	}
+
+	if err := h.DB.RefundOrderItem(orderID, itemID, quantity, adminID, r.FormValue("refund_method"), reason); err != nil {
+		if err == models.ErrInvalidRefund {
+			h.renderAdminOrder(w, orderID, "That is more than can still be refunded for this item")
+		} else if err == models.ErrNoOpenShift {
+			h.renderAdminOrder(w, orderID, "Open a shift to hand cash back from your drawer, or refund to the wallet")
+		} else {
+			h.renderAdminOrder(w, orderID, "Failed to refund the item")
+		}
+		return
+	}
+
+	redirectToAdminOrder(w, r, orderID)
+}
+
+// Wallets handler lists the wallet balance of every user
+func (h *Handler) Wallets(w http.ResponseWriter, r *http.Request) {
+	h.renderWallets(w, "")
+}
+
+// renderWallets renders the wallets page with an optional error
+func (h *Handler) renderWallets(w http.ResponseWriter, errMsg string) {
+	wallets, err := h.DB.GetWallets()
+	if err != nil {
+		http.Error(w, "Could not fetch wallets", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/wallets.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Wallets []models.Wallet
+		Error   string
+	}{
+		Wallets: wallets,
+		Error:   errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// TopUpWallet handler adds money a user paid in at the counter to their wallet
+func (h *Handler) TopUpWallet(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	amount, err := parseAmount(r.FormValue("amount"))
+	if err != nil || amount <= 0 {
+		h.renderWallets(w, "Top-up amount must be more than zero")
+		return
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	adminID, _ := session.Values["user_id"].(int)
+
+	if err := h.DB.TopUpWallet(userID, amount, adminID, strings.TrimSpace(r.FormValue("note"))); err != nil {
+		h.renderWallets(w, "Failed to top up the wallet")
+		return
+	}
+
+	http.Redirect(w, r, "/wallets", http.StatusSeeOther)
+}
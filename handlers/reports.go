@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-website/models"
+)
+
+// Report related handlers
+
+// TopSellerCount is how many products the top sellers report lists
+const TopSellerCount = 10
+
+// reportRange reads the from and to dates of a report, both inclusive and in
+// local time, defaulting to the last 30 days. The returned end is the start of
+// the day after to.
+func reportRange(r *http.Request) (from, to time.Time) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	from, to = today.AddDate(0, 0, -29), today.AddDate(0, 0, 1)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		if t, err := time.ParseInLocation(dateLayout, fromStr, time.Local); err == nil {
+			from = t
+		}
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		if t, err := time.ParseInLocation(dateLayout, toStr, time.Local); err == nil {
+			// Include the whole of the last day
+			to = t.AddDate(0, 0, 1)
+		}
+	}
+	return from, to
+}
+
+// money formats an amount for CSV exports
+func money(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// writeExport sends a report as a CSV or JSON download. rows are the CSV
+// lines below header and data is what gets encoded as JSON.
+func writeExport(w http.ResponseWriter, format, filename string, header []string, rows [][]string, data interface{}) {
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		json.NewEncoder(w).Encode(data)
+	default:
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		writer.WriteAll(rows)
+	}
+}
+
+// Reports handler shows the sales reports for a date range. With a format of
+// csv or json it instead exports the report named by the report parameter.
+func (h *Handler) Reports(w http.ResponseWriter, r *http.Request) {
+	from, to := reportRange(r)
+	groupBy := r.URL.Query().Get("group")
+	if groupBy != models.GroupByWeek && groupBy != models.GroupByMonth {
+		groupBy = models.GroupByDay
+	}
+
+	if format := r.URL.Query().Get("format"); format == "csv" || format == "json" {
+		h.exportReport(w, r.URL.Query().Get("report"), format, from, to, groupBy)
+		return
+	}
+
+	summary, err := h.DB.GetSalesSummary(from, to)
+	if err != nil {
+		http.Error(w, "Could not fetch sales summary", http.StatusInternalServerError)
+		return
+	}
+
+	periods, err := h.DB.GetSalesByPeriod(from, to, groupBy)
+	if err != nil {
+		http.Error(w, "Could not fetch sales", http.StatusInternalServerError)
+		return
+	}
+
+	products, err := h.DB.GetSalesByProduct(from, to)
+	if err != nil {
+		http.Error(w, "Could not fetch product sales", http.StatusInternalServerError)
+		return
+	}
+
+	categories, err := h.DB.GetSalesByCategory(from, to)
+	if err != nil {
+		http.Error(w, "Could not fetch category sales", http.StatusInternalServerError)
+		return
+	}
+
+	topSellers, err := h.DB.GetTopSellers(from, to, TopSellerCount)
+	if err != nil {
+		http.Error(w, "Could not fetch top sellers", http.StatusInternalServerError)
+		return
+	}
+
+	hours, err := h.DB.GetSalesByHour(from, to)
+	if err != nil {
+		http.Error(w, "Could not fetch peak hours", http.StatusInternalServerError)
+		return
+	}
+
+	// Scale the peak hours chart to the busiest hour
+	busiest := 0
+	for _, hour := range hours {
+		if hour.Orders > busiest {
+			busiest = hour.Orders
+		}
+	}
+
+	tmpl, err := template.New("reports.html").Funcs(template.FuncMap{
+		"percent": func(orders int) int {
+			if busiest == 0 {
+				return 0
+			}
+			return orders * 100 / busiest
+		},
+	}).ParseFiles("templates/reports.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		From       string
+		To         string
+		GroupBy    string
+		Summary    models.SalesSummary
+		Periods    []models.SalesPeriod
+		Products   []models.ProductSales
+		Categories []models.CategorySales
+		TopSellers []models.ProductSales
+		Hours      []models.HourlySales
+	}{
+		From:       from.Format(dateLayout),
+		To:         to.AddDate(0, 0, -1).Format(dateLayout),
+		GroupBy:    groupBy,
+		Summary:    summary,
+		Periods:    periods,
+		Products:   products,
+		Categories: categories,
+		TopSellers: topSellers,
+		Hours:      hours,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// exportReport writes one report as CSV or JSON
+func (h *Handler) exportReport(w http.ResponseWriter, report, format string, from, to time.Time, groupBy string) {
+	filename := fmt.Sprintf("%s-%s-to-%s", report, from.Format(dateLayout), to.AddDate(0, 0, -1).Format(dateLayout))
+
+	switch report {
+	case "summary":
+		summary, err := h.DB.GetSalesSummary(from, to)
+		if err != nil {
+			http.Error(w, "Could not fetch sales summary", http.StatusInternalServerError)
+			return
+		}
+		rows := [][]string{{strconv.Itoa(summary.Orders), strconv.Itoa(summary.Units), money(summary.Revenue), money(summary.Refunded), money(summary.AverageOrderValue)}}
+		writeExport(w, format, filename, []string{"orders", "units", "revenue", "refunded", "average_order_value"}, rows, summary)
+
+	case "sales":
+		periods, err := h.DB.GetSalesByPeriod(from, to, groupBy)
+		if err != nil {
+			http.Error(w, "Could not fetch sales", http.StatusInternalServerError)
+			return
+		}
+		var rows [][]string
+		for _, p := range periods {
+			rows = append(rows, []string{p.Period, strconv.Itoa(p.Orders), strconv.Itoa(p.Units), money(p.Revenue)})
+		}
+		writeExport(w, format, filename, []string{groupBy, "orders", "units", "revenue"}, rows, periods)
+
+	case "products", "top-sellers":
+		var products []models.ProductSales
+		var err error
+		if report == "products" {
+			products, err = h.DB.GetSalesByProduct(from, to)
+		} else {
+			products, err = h.DB.GetTopSellers(from, to, TopSellerCount)
+		}
+		if err != nil {
+			http.Error(w, "Could not fetch product sales", http.StatusInternalServerError)
+			return
+		}
+		var rows [][]string
+		for _, p := range products {
+			rows = append(rows, []string{strconv.Itoa(p.ProductID), p.ProductName, p.Category, strconv.Itoa(p.Units), money(p.Revenue)})
+		}
+		writeExport(w, format, filename, []string{"product_id", "product", "category", "units", "revenue"}, rows, products)
+
+	case "categories":
+		categories, err := h.DB.GetSalesByCategory(from, to)
+		if err != nil {
+			http.Error(w, "Could not fetch category sales", http.StatusInternalServerError)
+			return
+		}
+		var rows [][]string
+		for _, c := range categories {
+			rows = append(rows, []string{c.Category, strconv.Itoa(c.Units), money(c.Revenue)})
+		}
+		writeExport(w, format, filename, []string{"category", "units", "revenue"}, rows, categories)
+
+	case "hours":
+		hours, err := h.DB.GetSalesByHour(from, to)
+		if err != nil {
+			http.Error(w, "Could not fetch peak hours", http.StatusInternalServerError)
+			return
+		}
+		var rows [][]string
+		for _, hr := range hours {
+			rows = append(rows, []string{strconv.Itoa(hr.Hour), strconv.Itoa(hr.Orders), money(hr.Revenue)})
+		}
+		writeExport(w, format, filename, []string{"hour", "orders", "revenue"}, rows, hours)
+
+	default:
+		http.Error(w, "Unknown report", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"auth-website/models"
+)
+
+// Review related handlers
+
+// ProductPage handler shows a product with its rating and reviews
+func (h *Handler) ProductPage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	h.renderProductPage(w, r, id, "")
+}
+
+// renderProductPage renders a product's page with the user's review form and an optional error
+func (h *Handler) renderProductPage(w http.ResponseWriter, r *http.Request, productID int, errMsg string) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	product, err := h.DB.GetProductByID(productID)
+	if err != nil || product.IsArchived() {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	reviews, err := h.DB.GetProductReviews(productID)
+	if err != nil {
+		http.Error(w, "Could not fetch reviews", http.StatusInternalServerError)
+		return
+	}
+
+	userReview, err := h.DB.GetUserReview(userID, productID)
+	if err != nil {
+		http.Error(w, "Could not fetch your review", http.StatusInternalServerError)
+		return
+	}
+
+	purchased, err := h.DB.HasPurchased(userID, productID)
+	if err != nil {
+		http.Error(w, "Could not check your orders", http.StatusInternalServerError)
+		return
+	}
+
+	options, err := h.DB.GetProductOptions(productID, true)
+	if err != nil {
+		http.Error(w, "Could not fetch product options", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/product.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Username        string
+		Product         *models.Product
+		Options         models.ProductOptions
+		CartError       string
+		Reviews         []models.Feedback
+		UserReview      *models.Feedback
+		CanReview       bool
+		StarOrder       []int
+		MaxReviewLength int
+		Error           string
+	}{
+		Username:        session.Values["username"].(string),
+		Product:         product,
+		Options:         options,
+		CartError:       cartErrors[r.URL.Query().Get("error")],
+		Reviews:         reviews,
+		UserReview:      userReview,
+		CanReview:       purchased,
+		StarOrder:       []int{5, 4, 3, 2, 1},
+		MaxReviewLength: models.MaxReviewLength,
+		Error:           errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// ReviewProduct handler saves the user's rating and review of a product they bought
+func (h *Handler) ReviewProduct(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	productID, err := strconv.Atoi(r.FormValue("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	rating, err := strconv.Atoi(r.FormValue("rating"))
+	if err != nil || rating < 1 || rating > 5 {
+		h.renderProductPage(w, r, productID, "Please choose a rating")
+		return
+	}
+
+	body := strings.TrimSpace(r.FormValue("body"))
+	if utf8.RuneCountInString(body) > models.MaxReviewLength {
+		h.renderProductPage(w, r, productID, "Reviews can be at most "+strconv.Itoa(models.MaxReviewLength)+" characters")
+		return
+	}
+
+	err = h.DB.SaveProductReview(userID, productID, rating, body)
+	if err == models.ErrNotPurchased {
+		h.renderProductPage(w, r, productID, "You can review a product once you have collected an order with it")
+		return
+	}
+	if err != nil {
+		h.renderProductPage(w, r, productID, "Failed to save your review")
+		return
+	}
+
+	http.Redirect(w, r, "/product?id="+strconv.Itoa(productID), http.StatusSeeOther)
+}
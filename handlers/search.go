@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"auth-website/models"
+)
+
+// Search related handlers
+
+// SearchResultLimit is the most products a search returns
+const SearchResultLimit = 50
+
+// wantsJSON reports whether a request asked for JSON, either with a format
+// parameter or through its Accept header
+func wantsJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// Search handler searches the menu by name, description and category. It
+// answers with JSON for API clients and with the menu page otherwise.
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	if !wantsJSON(r) {
+		h.Dashboard(w, r)
+		return
+	}
+
+	session, _ := h.Store.Get(r, "session-name")
+	userID, _ := session.Values["user_id"].(int)
+	prefs, err := h.DB.GetDietaryPreferences(userID)
+	if err != nil {
+		http.Error(w, "Could not fetch preferences", http.StatusInternalServerError)
+		return
+	}
+
+	products, err := h.DB.SearchProducts(r.URL.Query().Get("q"), menuFilter(r, prefs), SearchResultLimit)
+	if err != nil {
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		return
+	}
+	if products == nil {
+		products = []models.Product{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-website/models"
+)
+
+// Cashier shift and close-out related handlers
+
+// ShiftListLimit is how many recent shifts the shifts page lists
+const ShiftListLimit = 50
+
+// Shift handler shows the cashier's open shift, or the form to open one
+func (h *Handler) Shift(w http.ResponseWriter, r *http.Request) {
+	h.renderShift(w, r, "")
+}
+
+// renderShift renders the cashier's shift page with an optional error
+func (h *Handler) renderShift(w http.ResponseWriter, r *http.Request, errMsg string) {
+	session, _ := h.Store.Get(r, "session-name")
+	cashierID, _ := session.Values["user_id"].(int)
+
+	shift, err := h.DB.GetOpenShift(cashierID)
+	if err != nil {
+		http.Error(w, "Could not load the shift", http.StatusInternalServerError)
+		return
+	}
+
+	var movements []models.CashMovement
+	var report models.ZReport
+	if shift != nil {
+		if movements, err = h.DB.GetShiftMovements(shift.ID); err == nil {
+			report, err = h.DB.GetShiftZReport(shift.ID)
+		}
+		if err != nil {
+			http.Error(w, "Could not load the shift", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	tmpl, err := template.ParseFiles("templates/shift.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Username  string
+		Shift     *models.Shift
+		Movements []models.CashMovement
+		Report    models.ZReport
+		Error     string
+	}{
+		Username:  session.Values["username"].(string),
+		Shift:     shift,
+		Movements: movements,
+		Report:    report,
+		Error:     errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// OpenShift handler opens a shift for the cashier with the float in the drawer
+func (h *Handler) OpenShift(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	cashierID, _ := session.Values["user_id"].(int)
+
+	openingFloat, err := parseAmount(r.FormValue("opening_float"))
+	if err != nil || openingFloat < 0 {
+		h.renderShift(w, r, "Enter the cash in the drawer, zero or more")
+		return
+	}
+
+	if _, err := h.DB.OpenShift(cashierID, openingFloat); err != nil {
+		if err == models.ErrShiftAlreadyOpen {
+			h.renderShift(w, r, "You already have a shift open")
+		} else {
+			h.renderShift(w, r, "Failed to open the shift")
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/pos", http.StatusSeeOther)
+}
+
+// RecordCashMovement handler records cash paid into or out of the drawer
+// other than for orders
+func (h *Handler) RecordCashMovement(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	cashierID, _ := session.Values["user_id"].(int)
+
+	shift, err := h.DB.GetOpenShift(cashierID)
+	if err != nil || shift == nil {
+		h.renderShift(w, r, "Open a shift first")
+		return
+	}
+
+	amount, err := parseAmount(r.FormValue("amount"))
+	if err != nil || amount <= 0 {
+		h.renderShift(w, r, "Amount must be more than zero")
+		return
+	}
+	if r.FormValue("direction") == "out" {
+		amount = -amount
+	}
+
+	note := strings.TrimSpace(r.FormValue("note"))
+	if note == "" {
+		h.renderShift(w, r, "Please say what the cash was for")
+		return
+	}
+
+	if err := h.DB.RecordCashMovement(shift.ID, cashierID, amount, note); err != nil {
+		h.renderShift(w, r, "Failed to record the cash movement")
+		return
+	}
+
+	http.Redirect(w, r, "/shift", http.StatusSeeOther)
+}
+
+// CloseShift handler closes the cashier's shift with the cash counted in the
+// drawer and shows its Z report
+func (h *Handler) CloseShift(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	cashierID, _ := session.Values["user_id"].(int)
+
+	shift, err := h.DB.GetOpenShift(cashierID)
+	if err != nil || shift == nil {
+		h.renderShift(w, r, "You have no shift open")
+		return
+	}
+
+	countedStr := strings.TrimSpace(r.FormValue("counted_cash"))
+	counted, err := parseAmount(countedStr)
+	if countedStr == "" || err != nil || counted < 0 {
+		h.renderShift(w, r, "Count the cash in the drawer to close the shift")
+		return
+	}
+
+	if err := h.DB.CloseShift(shift.ID, counted, strings.TrimSpace(r.FormValue("note"))); err != nil {
+		h.renderShift(w, r, "Failed to close the shift")
+		return
+	}
+
+	http.Redirect(w, r, "/z-report?shift="+strconv.Itoa(shift.ID), http.StatusSeeOther)
+}
+
+// ZReport handler shows the printable close-out of a shift, or of all the
+// shifts of a day. Cashiers can only see their own shifts.
+func (h *Handler) ZReport(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, "session-name")
+	userID, _ := session.Values["user_id"].(int)
+	isAdmin := session.Values["role"] == models.RoleAdmin
+
+	var report models.ZReport
+	var title string
+	if shiftStr := r.URL.Query().Get("shift"); shiftStr != "" {
+		id, err := strconv.Atoi(shiftStr)
+		if err != nil {
+			http.Error(w, "Invalid shift ID", http.StatusBadRequest)
+			return
+		}
+		shift, err := h.DB.GetShift(id)
+		if err != nil || (!isAdmin && shift.CashierID != userID) {
+			http.Error(w, "Shift not found", http.StatusNotFound)
+			return
+		}
+		if report, err = h.DB.GetShiftZReport(id); err != nil {
+			http.Error(w, "Could not build the report", http.StatusInternalServerError)
+			return
+		}
+		title = "Shift #" + strconv.Itoa(id)
+	} else {
+		if !isAdmin {
+			http.Error(w, "Only admins can close out a day", http.StatusForbidden)
+			return
+		}
+		day := time.Now()
+		if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+			t, err := time.ParseInLocation(dateLayout, dateStr, time.Local)
+			if err != nil {
+				http.Error(w, "Invalid date", http.StatusBadRequest)
+				return
+			}
+			day = t
+		}
+		var err error
+		if report, err = h.DB.GetDayZReport(day); err != nil {
+			http.Error(w, "Could not build the report", http.StatusInternalServerError)
+			return
+		}
+		title = day.Format("Monday, Jan 2, 2006")
+	}
+
+	tmpl, err := template.ParseFiles("templates/z-report.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Title     string
+		Report    models.ZReport
+		PrintedAt time.Time
+	}{
+		Title:     title,
+		Report:    report,
+		PrintedAt: time.Now(),
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// Shifts handler lists recent shifts for admins
+func (h *Handler) Shifts(w http.ResponseWriter, r *http.Request) {
+	shifts, err := h.DB.GetShifts(ShiftListLimit)
+	if err != nil {
+		http.Error(w, "Could not fetch shifts", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/shifts.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Shifts []models.Shift
+		Today  string
+	}{
+		Shifts: shifts,
+		Today:  time.Now().Format(dateLayout),
+	}
+
+	tmpl.Execute(w, data)
+}
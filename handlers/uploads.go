@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"auth-website/storage"
+)
+
+// Upload limits and thumbnail size for product images
+const (
+	MaxImageSize    = 5 << 20 // 5 MB
+	ThumbnailWidth  = 560     // Twice the dashboard card width, for high density screens
+	ThumbnailHeight = 400
+)
+
+// imageTypes maps the accepted sniffed content types to file extensions
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// saveUploadedImage stores the image uploaded in field, along with a
+// thumbnail, and returns both URLs. It returns empty URLs if no file was
+// sent. It must be called before anything else reads the request form, so
+// the size limit applies to the whole body.
+func (h *Handler) saveUploadedImage(w http.ResponseWriter, r *http.Request, field string) (string, string, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return "", "", nil
+	}
+
+	// Leave some room for the other form fields
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImageSize+1<<20)
+	if err := r.ParseMultipartForm(MaxImageSize); err != nil {
+		return "", "", errors.New("Upload is too large, images must be at most 5 MB")
+	}
+
+	file, _, err := r.FormFile(field)
+	if err == http.ErrMissingFile {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", errors.New("Could not read uploaded image")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxImageSize+1))
+	if err != nil {
+		return "", "", errors.New("Could not read uploaded image")
+	}
+	if len(data) == 0 {
+		return "", "", nil
+	}
+	if len(data) > MaxImageSize {
+		return "", "", errors.New("Images must be at most 5 MB")
+	}
+
+	// Trust the file contents rather than the name or the client's content type
+	ext, ok := imageTypes[http.DetectContentType(data)]
+	if !ok {
+		return "", "", errors.New("Only JPEG, PNG and GIF images are supported")
+	}
+
+	thumbnail, err := storage.Thumbnail(data, ThumbnailWidth, ThumbnailHeight)
+	if err == storage.ErrImageTooLarge {
+		return "", "", errors.New("Images must be at most 25 megapixels")
+	}
+	if err != nil {
+		return "", "", errors.New("Uploaded file is not a valid image")
+	}
+
+	imageURL, err := h.Files.Save(ext, data)
+	if err != nil {
+		return "", "", errors.New("Failed to store uploaded image")
+	}
+	thumbnailURL, err := h.Files.Save(".jpg", thumbnail)
+	if err != nil {
+		h.removeImages(imageURL)
+		return "", "", errors.New("Failed to store uploaded image")
+	}
+
+	return imageURL, thumbnailURL, nil
+}
+
+// removeImages deletes uploaded files that no product refers to anymore.
+// URLs that were not uploaded, such as images under /static, are left alone.
+func (h *Handler) removeImages(urls ...string) {
+	for _, url := range urls {
+		if url == "" || !h.Files.Owns(url) {
+			continue
+		}
+
+		count, err := h.DB.CountProductsUsingImage(url)
+		if err != nil || count > 0 {
+			continue
+		}
+
+		if err := h.Files.Delete(url); err != nil {
+			log.Printf("Warning: Could not delete %s: %v", url, err)
+		}
+	}
+}
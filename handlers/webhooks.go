@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"auth-website/models"
+	"auth-website/webhooks"
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WebhookDeliveryLimit is how many deliveries the delivery log shows
+const WebhookDeliveryLimit = 100
+
+// Webhooks handler shows the integration endpoints and a form to add one
+func (h *Handler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	h.renderWebhooks(w, "")
+}
+
+// renderWebhooks renders the webhooks page with an optional error
+func (h *Handler) renderWebhooks(w http.ResponseWriter, errMsg string) {
+	endpoints, err := h.DB.GetWebhookEndpoints()
+	if err != nil {
+		http.Error(w, "Could not fetch webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/webhooks.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Endpoints []models.WebhookEndpoint
+		Events    []string
+		Error     string
+	}{
+		Endpoints: endpoints,
+		Events:    models.WebhookEvents,
+		Error:     errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// webhookEvents returns the known events ticked in a form
+func webhookEvents(r *http.Request) []string {
+	r.ParseForm()
+	var events []string
+	for _, event := range models.WebhookEvents {
+		for _, ticked := range r.Form["events"] {
+			if ticked == event {
+				events = append(events, event)
+				break
+			}
+		}
+	}
+	return events
+}
+
+// publicURLError checks that a webhook URL leads outside the server's own
+// network and returns what is wrong with it, or "" if nothing is. The
+// server posts to the URL, so it must not be able to reach internal hosts.
+func publicURLError(ctx context.Context, url string) string {
+	switch err := webhooks.CheckPublicURL(ctx, url); {
+	case err == nil:
+		return ""
+	case errors.Is(err, models.ErrInvalidWebhookURL):
+		return "Webhook URL must start with http:// or https://"
+	case errors.Is(err, webhooks.ErrInternalAddress):
+		return "Webhook URL must be a public address"
+	default:
+		return "Could not find the webhook URL's host"
+	}
+}
+
+// AddWebhook handler registers a new endpoint
+func (h *Handler) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	url := strings.TrimSpace(r.FormValue("url"))
+	description := strings.TrimSpace(r.FormValue("description"))
+	events := webhookEvents(r)
+	if len(events) == 0 {
+		h.renderWebhooks(w, "Pick at least one event")
+		return
+	}
+	if msg := publicURLError(r.Context(), url); msg != "" {
+		h.renderWebhooks(w, msg)
+		return
+	}
+
+	if _, err := h.DB.CreateWebhookEndpoint(url, description, events); err != nil {
+		if errors.Is(err, models.ErrInvalidWebhookURL) {
+			h.renderWebhooks(w, err.Error())
+			return
+		}
+		h.renderWebhooks(w, "Failed to add the webhook")
+		return
+	}
+
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// UpdateWebhook handler changes an endpoint's URL, events and whether it is active
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("endpoint_id"))
+	if err != nil {
+		h.renderWebhooks(w, "Invalid webhook")
+		return
+	}
+	url := strings.TrimSpace(r.FormValue("url"))
+	description := strings.TrimSpace(r.FormValue("description"))
+	events := webhookEvents(r)
+	if len(events) == 0 {
+		h.renderWebhooks(w, "Pick at least one event")
+		return
+	}
+	if msg := publicURLError(r.Context(), url); msg != "" {
+		h.renderWebhooks(w, msg)
+		return
+	}
+
+	if err := h.DB.UpdateWebhookEndpoint(id, url, description, events, r.FormValue("active") == "on"); err != nil {
+		if errors.Is(err, models.ErrInvalidWebhookURL) {
+			h.renderWebhooks(w, err.Error())
+			return
+		}
+		h.renderWebhooks(w, "Failed to update the webhook")
+		return
+	}
+
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// RotateWebhookSecret handler gives an endpoint a new signing secret
+func (h *Handler) RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("endpoint_id"))
+	if err != nil {
+		h.renderWebhooks(w, "Invalid webhook")
+		return
+	}
+
+	if _, err := h.DB.RotateWebhookSecret(id); err != nil {
+		h.renderWebhooks(w, "Failed to rotate the secret")
+		return
+	}
+
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// WebhookDeliveries handler shows the delivery log, of one endpoint or of all
+func (h *Handler) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	h.renderWebhookDeliveries(w, r, "")
+}
+
+// renderWebhookDeliveries renders the delivery log with an optional error
+func (h *Handler) renderWebhookDeliveries(w http.ResponseWriter, r *http.Request, errMsg string) {
+	endpointID, _ := strconv.Atoi(r.FormValue("endpoint"))
+
+	var endpoint *models.WebhookEndpoint
+	if endpointID != 0 {
+		var err error
+		endpoint, err = h.DB.GetWebhookEndpoint(endpointID)
+		if err != nil {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	deliveries, err := h.DB.GetWebhookDeliveries(endpointID, WebhookDeliveryLimit)
+	if err != nil {
+		http.Error(w, "Could not fetch webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/webhook-deliveries.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Endpoint   *models.WebhookEndpoint
+		Deliveries []models.WebhookDelivery
+		Error      string
+	}{
+		Endpoint:   endpoint,
+		Deliveries: deliveries,
+		Error:      errMsg,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// RedeliverWebhook handler queues a delivery to be sent again
+func (h *Handler) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("delivery_id"))
+	if err != nil {
+		h.renderWebhookDeliveries(w, r, "Invalid delivery")
+		return
+	}
+
+	if err := h.DB.RedeliverWebhook(id); err != nil {
+		h.renderWebhookDeliveries(w, r, "Failed to redeliver the webhook")
+		return
+	}
+
+	redirect := "/webhook-deliveries"
+	if endpoint := r.FormValue("endpoint"); endpoint != "" {
+		redirect += "?endpoint=" + endpoint
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
@@ -0,0 +1,42 @@
+package inventory
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"auth-website/database"
+	"auth-website/notify"
+	"auth-website/worker"
+)
+
+// LowStockChecker periodically raises alerts for products that need reordering
+type LowStockChecker struct {
+	DB       *database.DB
+	Notifier notify.Notifier
+	Interval time.Duration
+}
+
+// Run checks stock every Interval until stop is closed
+func (c *LowStockChecker) Run(stop <-chan struct{}) {
+	worker.Loop("Low stock check", c.Interval, nil, stop, c.Check)
+}
+
+// Check raises alerts for newly low products and sends a notification for each
+func (c *LowStockChecker) Check() error {
+	alerts, err := c.DB.CheckLowStock()
+	if err != nil {
+		return err
+	}
+
+	for _, alert := range alerts {
+		msg := notify.Message{
+			Subject: "Low stock: " + alert.ProductName,
+			Body:    fmt.Sprintf("%s is down to %d (reorder level %d).", alert.ProductName, alert.Stock, alert.ReorderLevel),
+		}
+		if err := c.Notifier.Notify(msg); err != nil {
+			log.Printf("Failed to send low stock notification for %s: %v", alert.ProductName, err)
+		}
+	}
+	return nil
+}
@@ -3,8 +3,16 @@ package main
 import (
 	"auth-website/database"
 	"auth-website/handlers"
+	"auth-website/inventory"
+	"auth-website/models"
+	"auth-website/notify"
+	"auth-website/printing"
+	"auth-website/storage"
+	"auth-website/webhooks"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
@@ -12,7 +20,11 @@ import (
 
 func main() {
 	// Initialize database
-	db, err := database.Initialize()
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		dsn = database.DefaultDSN
+	}
+	db, err := database.Initialize(dsn)
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
@@ -24,12 +36,70 @@ func main() {
 		MaxAge:   86400 * 7, // 1 week
 		HttpOnly: true,
 	}
+	// Initialize storage for uploaded images
+	uploadDir := os.Getenv("UPLOAD_DIR")
+	if uploadDir == "" {
+		uploadDir = "./uploads"
+	}
+	files, err := storage.NewLocalStorage(uploadDir, "/uploads/")
+	if err != nil {
+		log.Fatal("Failed to initialize upload storage:", err)
+	}
+	// Check for low stock in the background
+	checkInterval := 5 * time.Minute
+	if value := os.Getenv("LOW_STOCK_CHECK_INTERVAL"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			checkInterval = d
+		}
+	}
+	checker := &inventory.LowStockChecker{DB: db, Notifier: notify.LogNotifier{}, Interval: checkInterval}
+	go checker.Run(nil)
+	// Send user notifications from the outbox. Emails are only logged until
+	// an SMTP server is configured.
+	var email notify.Notifier = notify.LogNotifier{}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		email = &notify.SMTPNotifier{
+			Addr:     addr,
+			From:     os.Getenv("SMTP_FROM"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	}
+	dispatcher := notify.NewDispatcher(db, map[string]notify.Notifier{
+		models.ChannelInApp:   notify.InboxNotifier{DB: db},
+		models.ChannelEmail:   email,
+		models.ChannelWebhook: notify.WebhookNotifier{DB: db},
+	})
+	if value := os.Getenv("NOTIFY_INTERVAL"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			dispatcher.Interval = d
+		}
+	}
+	go dispatcher.Run(nil)
+	// Deliver integration webhooks in the background
+	deliverer := webhooks.NewDeliverer(db)
+	if value := os.Getenv("WEBHOOK_RETRY_DELAY"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			deliverer.RetryDelay = d
+		}
+	}
+	go deliverer.Run(nil)
 	// Initialize handlers
-	h := handlers.NewHandler(db, store)
+	h := handlers.NewHandler(db, store, files)
+	// Print receipts in the background when a printer is configured
+	if target := os.Getenv("PRINTER_TARGET"); target != "" {
+		printer, err := printing.ParseTarget(target)
+		if err != nil {
+			log.Fatal("Invalid PRINTER_TARGET:", err)
+		}
+		h.Receipts = printing.NewQueue(db, printer)
+		go h.Receipts.Run(nil)
+	}
 	// Setup router
 	r := mux.NewRouter()
 	// Static files
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))))
+	r.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir(uploadDir))))
 	// Public routes
 	r.HandleFunc("/", h.Home).Methods("GET")
 	r.HandleFunc("/home", h.Home).Methods("GET")
@@ -37,15 +107,119 @@ func main() {
 	r.HandleFunc("/login", h.LoginPage).Methods("GET", "POST")
 	r.HandleFunc("/register", h.RegisterPage).Methods("GET", "POST")
 	r.HandleFunc("/logout", h.Logout).Methods("GET")
-	r.HandleFunc("/feedback", h.Feedback).Methods("GET", "POST")
-	r.HandleFunc("/submit_feedback", h.Feedback).Methods("POST")
 	// Protected routes
+	r.HandleFunc("/feedback", h.RequireAuth(h.Feedback)).Methods("GET", "POST")
+	r.HandleFunc("/submit_feedback", h.RequireAuth(h.Feedback)).Methods("POST")
 	r.HandleFunc("/dashboard", h.RequireAuth(h.Dashboard)).Methods("GET")
+	r.HandleFunc("/search", h.RequireAuth(h.Search)).Methods("GET")
+	r.HandleFunc("/profile", h.RequireAuth(h.Profile)).Methods("GET", "POST")
+	r.HandleFunc("/notifications", h.RequireAuth(h.Notifications)).Methods("GET")
+	r.HandleFunc("/mark-notifications-read", h.RequireAuth(h.MarkNotificationsRead)).Methods("POST")
+	r.HandleFunc("/notification-preferences", h.RequireAuth(h.UpdateNotificationPreferences)).Methods("POST")
 	r.HandleFunc("/admin-dashboard", h.RequireAdmin(h.AdminDashboard)).Methods("GET")
 	r.HandleFunc("/add-product", h.RequireAdmin(h.AddProduct)).Methods("GET", "POST")
-	r.HandleFunc("/delete-product", h.RequireAdmin(h.DeleteProduct)).Methods("POST")
+	r.HandleFunc("/edit-product", h.RequireAdmin(h.EditProduct)).Methods("GET", "POST")
+	r.HandleFunc("/archive-product", h.RequireAdmin(h.ArchiveProduct)).Methods("POST")
+	r.HandleFunc("/restore-product", h.RequireAdmin(h.RestoreProduct)).Methods("POST")
+	r.HandleFunc("/stock-history", h.RequireAdmin(h.StockHistory)).Methods("GET")
+	r.HandleFunc("/adjust-stock", h.RequireAdmin(h.AdjustStock)).Methods("POST")
+	r.HandleFunc("/waste-batch", h.RequireAdmin(h.WasteBatch)).Methods("POST")
+	r.HandleFunc("/wastage-report", h.RequireAdmin(h.WastageReport)).Methods("GET")
+	r.HandleFunc("/reports", h.RequireAdmin(h.Reports)).Methods("GET")
+	r.HandleFunc("/admin-feedback", h.RequireAdmin(h.AdminFeedback)).Methods("GET")
+	r.HandleFunc("/resolve-feedback", h.RequireAdmin(h.ResolveFeedback)).Methods("POST")
+	r.HandleFunc("/hide-feedback", h.RequireAdmin(h.HideFeedback)).Methods("POST")
+	r.HandleFunc("/reply-feedback", h.RequireAdmin(h.ReplyFeedback)).Methods("POST")
+	r.HandleFunc("/stock-reconciliation", h.RequireAdmin(h.StockReconciliation)).Methods("GET")
+	r.HandleFunc("/reorder-report", h.RequireAdmin(h.ReorderReport)).Methods("GET")
+	r.HandleFunc("/suppliers", h.RequireAdmin(h.Suppliers)).Methods("GET")
+	r.HandleFunc("/add-supplier", h.RequireAdmin(h.AddSupplier)).Methods("POST")
+	r.HandleFunc("/update-supplier", h.RequireAdmin(h.UpdateSupplier)).Methods("POST")
+	r.HandleFunc("/set-supplier-item", h.RequireAdmin(h.SetSupplierItem)).Methods("POST")
+	r.HandleFunc("/remove-supplier-item", h.RequireAdmin(h.RemoveSupplierItem)).Methods("POST")
+	r.HandleFunc("/purchase-orders", h.RequireAdmin(h.PurchaseOrders)).Methods("GET")
+	r.HandleFunc("/create-purchase-order", h.RequireAdmin(h.CreatePurchaseOrder)).Methods("POST")
+	r.HandleFunc("/purchase-order", h.RequireAdmin(h.ViewPurchaseOrder)).Methods("GET")
+	r.HandleFunc("/add-purchase-order-line", h.RequireAdmin(h.AddPurchaseOrderLine)).Methods("POST")
+	r.HandleFunc("/remove-purchase-order-line", h.RequireAdmin(h.RemovePurchaseOrderLine)).Methods("POST")
+	r.HandleFunc("/send-purchase-order", h.RequireAdmin(h.SendPurchaseOrder)).Methods("POST")
+	r.HandleFunc("/receive-goods", h.RequireAdmin(h.ReceiveGoods)).Methods("POST")
+	r.HandleFunc("/ingredients", h.RequireAdmin(h.Ingredients)).Methods("GET")
+	r.HandleFunc("/add-ingredient", h.RequireAdmin(h.AddIngredient)).Methods("POST")
+	r.HandleFunc("/adjust-ingredient", h.RequireAdmin(h.AdjustIngredient)).Methods("POST")
+	r.HandleFunc("/recipe", h.RequireAdmin(h.Recipe)).Methods("GET")
+	r.HandleFunc("/set-recipe-item", h.RequireAdmin(h.SetRecipeItem)).Methods("POST")
+	r.HandleFunc("/remove-recipe-item", h.RequireAdmin(h.RemoveRecipeItem)).Methods("POST")
+	r.HandleFunc("/product-options", h.RequireAdmin(h.ProductOptions)).Methods("GET")
+	r.HandleFunc("/add-variant", h.RequireAdmin(h.AddVariant)).Methods("POST")
+	r.HandleFunc("/update-variant", h.RequireAdmin(h.UpdateVariant)).Methods("POST")
+	r.HandleFunc("/add-modifier-group", h.RequireAdmin(h.AddModifierGroup)).Methods("POST")
+	r.HandleFunc("/update-modifier-group", h.RequireAdmin(h.UpdateModifierGroup)).Methods("POST")
+	r.HandleFunc("/add-modifier", h.RequireAdmin(h.AddModifier)).Methods("POST")
+	r.HandleFunc("/update-modifier", h.RequireAdmin(h.UpdateModifier)).Methods("POST")
+	r.HandleFunc("/categories", h.RequireAdmin(h.Categories)).Methods("GET")
+	r.HandleFunc("/add-category", h.RequireAdmin(h.AddCategory)).Methods("POST")
+	r.HandleFunc("/update-category", h.RequireAdmin(h.UpdateCategory)).Methods("POST")
 	// Cart routes
 	r.HandleFunc("/cart", h.RequireAuth(h.ViewCart)).Methods("GET")
+	r.HandleFunc("/add-to-cart", h.RequireAuth(h.AddToCart)).Methods("POST")
+	r.HandleFunc("/update-cart-item", h.RequireAuth(h.UpdateCartItem)).Methods("POST")
+	r.HandleFunc("/remove-cart-item", h.RequireAuth(h.RemoveCartItem)).Methods("POST")
+	r.HandleFunc("/clear-cart", h.RequireAuth(h.ClearCart)).Methods("POST")
+	// Order routes
+	r.HandleFunc("/checkout", h.RequireAuth(h.Checkout)).Methods("POST")
+	r.HandleFunc("/order", h.RequireAuth(h.ViewOrder)).Methods("GET")
+	r.HandleFunc("/rate-order", h.RequireAuth(h.RateOrder)).Methods("POST")
+	r.HandleFunc("/my-orders", h.RequireAuth(h.MyOrders)).Methods("GET")
+	r.HandleFunc("/reorder", h.RequireAuth(h.Reorder)).Methods("POST")
+	r.HandleFunc("/cancel-order", h.RequireAuth(h.CancelOrder)).Methods("POST")
+	r.HandleFunc("/order-qr", h.RequireAuth(h.OrderQR)).Methods("GET")
+	r.HandleFunc("/toggle-favourite", h.RequireAuth(h.ToggleFavourite)).Methods("POST")
+	r.HandleFunc("/product", h.RequireAuth(h.ProductPage)).Methods("GET")
+	r.HandleFunc("/review-product", h.RequireAuth(h.ReviewProduct)).Methods("POST")
+	r.HandleFunc("/kitchen", h.RequireAdmin(h.Kitchen)).Methods("GET")
+	r.HandleFunc("/update-order-status", h.RequireAdmin(h.UpdateOrderStatus)).Methods("POST")
+	r.HandleFunc("/admin-order", h.RequireAdmin(h.AdminOrder)).Methods("GET")
+	r.HandleFunc("/staff-cancel-order", h.RequireAdmin(h.StaffCancelOrder)).Methods("POST")
+	r.HandleFunc("/refund-order-item", h.RequireAdmin(h.RefundOrderItem)).Methods("POST")
+	r.HandleFunc("/wallets", h.RequireAdmin(h.Wallets)).Methods("GET")
+	r.HandleFunc("/top-up-wallet", h.RequireAdmin(h.TopUpWallet)).Methods("POST")
+	r.HandleFunc("/notification-outbox", h.RequireAdmin(h.NotificationOutbox)).Methods("GET")
+	r.HandleFunc("/retry-notification", h.RequireAdmin(h.RetryNotification)).Methods("POST")
+	r.HandleFunc("/update-low-balance-threshold", h.RequireAdmin(h.UpdateLowBalanceThreshold)).Methods("POST")
+	r.HandleFunc("/webhooks", h.RequireAdmin(h.Webhooks)).Methods("GET")
+	r.HandleFunc("/add-webhook", h.RequireAdmin(h.AddWebhook)).Methods("POST")
+	r.HandleFunc("/update-webhook", h.RequireAdmin(h.UpdateWebhook)).Methods("POST")
+	r.HandleFunc("/rotate-webhook-secret", h.RequireAdmin(h.RotateWebhookSecret)).Methods("POST")
+	r.HandleFunc("/webhook-deliveries", h.RequireAdmin(h.WebhookDeliveries)).Methods("GET")
+	r.HandleFunc("/redeliver-webhook", h.RequireAdmin(h.RedeliverWebhook)).Methods("POST")
+
+	// Point of sale routes
+	r.HandleFunc("/pos", h.RequireCashier(h.POS)).Methods("GET")
+	r.HandleFunc("/pos-add", h.RequireCashier(h.POSAddItem)).Methods("POST")
+	r.HandleFunc("/pos-update", h.RequireCashier(h.POSUpdateItem)).Methods("POST")
+	r.HandleFunc("/pos-clear", h.RequireCashier(h.POSClear)).Methods("POST")
+	r.HandleFunc("/pos-customer", h.RequireCashier(h.POSSetCustomer)).Methods("POST")
+	r.HandleFunc("/pos-checkout", h.RequireCashier(h.POSCheckout)).Methods("POST")
+	r.HandleFunc("/pos-receipt", h.RequireCashier(h.POSReceipt)).Methods("GET")
+	r.HandleFunc("/pos-print", h.RequireCashier(h.POSPrintReceipt)).Methods("POST")
+	r.HandleFunc("/pickup-scan", h.RequireCashier(h.PickupScan)).Methods("GET")
+	r.HandleFunc("/collect-order", h.RequireCashier(h.CollectOrder)).Methods("POST")
+	r.HandleFunc("/shift", h.RequireCashier(h.Shift)).Methods("GET")
+	r.HandleFunc("/open-shift", h.RequireCashier(h.OpenShift)).Methods("POST")
+	r.HandleFunc("/cash-movement", h.RequireCashier(h.RecordCashMovement)).Methods("POST")
+	r.HandleFunc("/close-shift", h.RequireCashier(h.CloseShift)).Methods("POST")
+	r.HandleFunc("/z-report", h.RequireCashier(h.ZReport)).Methods("GET")
+	r.HandleFunc("/shifts", h.RequireAdmin(h.Shifts)).Methods("GET")
+	r.HandleFunc("/print-jobs", h.RequireAdmin(h.PrintJobs)).Methods("GET")
+	r.HandleFunc("/retry-print-job", h.RequireAdmin(h.RetryPrintJob)).Methods("POST")
+	r.HandleFunc("/update-receipt-settings", h.RequireAdmin(h.UpdateReceiptSettings)).Methods("POST")
+	r.HandleFunc("/staff", h.RequireAdmin(h.Staff)).Methods("GET")
+	r.HandleFunc("/set-user-role", h.RequireAdmin(h.SetUserRole)).Methods("POST")
+	r.HandleFunc("/pickup-slots", h.RequireAdmin(h.PickupSlots)).Methods("GET")
+	r.HandleFunc("/add-pickup-slot", h.RequireAdmin(h.AddPickupSlot)).Methods("POST")
+	r.HandleFunc("/toggle-pickup-slot", h.RequireAdmin(h.TogglePickupSlot)).Methods("POST")
+	r.HandleFunc("/update-kitchen-settings", h.RequireAdmin(h.UpdateKitchenSettings)).Methods("POST")
 
 	log.Println("Server starting on :8080")
 	log.Println("Default admin credentials: username=admin, password=admin123")
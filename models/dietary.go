@@ -0,0 +1,154 @@
+package models
+
+// Dietary tags a product can carry
+const (
+	DietVegetarian = "vegetarian"
+	DietVegan      = "vegan"
+	DietJain       = "jain"
+	DietGlutenFree = "gluten-free"
+	DietHalal      = "halal"
+)
+
+// DietaryTags lists the dietary tags in the order forms and badges show them
+var DietaryTags = []string{DietVegetarian, DietVegan, DietJain, DietGlutenFree, DietHalal}
+
+// dietImplies maps a dietary tag to the tags it implies, so a vegan dish also
+// counts as vegetarian
+var dietImplies = map[string][]string{
+	DietVegan: {DietVegetarian},
+	DietJain:  {DietVegetarian},
+}
+
+// Allergens a product can contain
+const (
+	AllergenNuts      = "nuts"
+	AllergenPeanuts   = "peanuts"
+	AllergenDairy     = "dairy"
+	AllergenGluten    = "gluten"
+	AllergenEgg       = "egg"
+	AllergenSoy       = "soy"
+	AllergenSesame    = "sesame"
+	AllergenShellfish = "shellfish"
+)
+
+// Allergens lists the allergens in the order forms and badges show them
+var Allergens = []string{
+	AllergenNuts, AllergenPeanuts, AllergenDairy, AllergenGluten,
+	AllergenEgg, AllergenSoy, AllergenSesame, AllergenShellfish,
+}
+
+// NormalizeDietaryTags keeps the known tags of a form submission, adds the
+// tags they imply and returns them in DietaryTags order
+func NormalizeDietaryTags(tags []string) []string {
+	selected := make(map[string]bool)
+	for _, tag := range tags {
+		selected[tag] = true
+		for _, implied := range dietImplies[tag] {
+			selected[implied] = true
+		}
+	}
+	return keepKnown(DietaryTags, selected)
+}
+
+// NormalizeAllergens keeps the known allergens of a form submission in Allergens order
+func NormalizeAllergens(allergens []string) []string {
+	selected := make(map[string]bool)
+	for _, allergen := range allergens {
+		selected[allergen] = true
+	}
+	return keepKnown(Allergens, selected)
+}
+
+// keepKnown returns the entries of known that are selected
+func keepKnown(known []string, selected map[string]bool) []string {
+	var kept []string
+	for _, entry := range known {
+		if selected[entry] {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// Nutrition is the optional nutrition information of one serving. Zero
+// values are unknown.
+type Nutrition struct {
+	Calories     int     `json:"calories,omitempty"`
+	ProteinGrams float64 `json:"protein_g,omitempty"`
+	CarbsGrams   float64 `json:"carbs_g,omitempty"`
+	FatGrams     float64 `json:"fat_g,omitempty"`
+}
+
+// IsKnown reports whether any nutrition information was entered
+func (n Nutrition) IsKnown() bool {
+	return n.Calories != 0 || n.ProteinGrams != 0 || n.CarbsGrams != 0 || n.FatGrams != 0
+}
+
+// DietaryPreferences is what a user has said about their diet
+type DietaryPreferences struct {
+	Diets            []string `json:"diets"`           // Tags every product must carry, such as vegetarian
+	AvoidAllergens   []string `json:"avoid_allergens"` // Allergens a product must not contain
+	HideIncompatible bool     `json:"hide_incompatible"`
+}
+
+// IsSet reports whether the user has any dietary preferences
+func (d DietaryPreferences) IsSet() bool {
+	return len(d.Diets) > 0 || len(d.AvoidAllergens) > 0
+}
+
+// HasDiet reports whether the preferences include a dietary tag
+func (d DietaryPreferences) HasDiet(tag string) bool {
+	return contains(d.Diets, tag)
+}
+
+// Avoids reports whether the preferences avoid an allergen
+func (d DietaryPreferences) Avoids(allergen string) bool {
+	return contains(d.AvoidAllergens, allergen)
+}
+
+// contains reports whether list holds value
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDietaryTag reports whether the product carries a dietary tag
+func (p Product) HasDietaryTag(tag string) bool {
+	return contains(p.DietaryTags, tag)
+}
+
+// Contains reports whether the product contains an allergen
+func (p Product) Contains(allergen string) bool {
+	return contains(p.Allergens, allergen)
+}
+
+// Conflicts lists why a product does not suit dietary preferences, such as
+// "not vegan" or "contains nuts". It is empty when the product suits them.
+func (p Product) Conflicts(prefs DietaryPreferences) []string {
+	var conflicts []string
+	for _, diet := range prefs.Diets {
+		if !p.HasDietaryTag(diet) {
+			conflicts = append(conflicts, "not "+diet)
+		}
+	}
+	for _, allergen := range prefs.AvoidAllergens {
+		if p.Contains(allergen) {
+			conflicts = append(conflicts, "contains "+allergen)
+		}
+	}
+	return conflicts
+}
+
+// HasDiet reports whether the filter requires a dietary tag
+func (f MenuFilter) HasDiet(tag string) bool {
+	return contains(f.Diets, tag)
+}
+
+// Excludes reports whether the filter excludes an allergen
+func (f MenuFilter) Excludes(allergen string) bool {
+	return contains(f.ExcludeAllergens, allergen)
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// MaxReviewLength is the longest product review text accepted, in characters
+const MaxReviewLength = 500
+
+// Kinds of feedback admins can filter by
+const (
+	FeedbackKindGeneral = "general" // Left from the feedback form
+	FeedbackKindOrder   = "order"   // Ratings of a collected order and its dishes
+	FeedbackKindReview  = "review"  // Product reviews from the menu
+)
+
+// Feedback statuses admins can filter by
+const (
+	FeedbackOpen     = "open"
+	FeedbackResolved = "resolved"
+	FeedbackHidden   = "hidden"
+)
+
+// Feedback model
+type Feedback struct {
+	ID          int             `json:"id"`
+	Name        string          `json:"name"`
+	Email       string          `json:"email"`
+	FoodQuality int             `json:"food_quality"`
+	Service     int             `json:"service"`
+	Comments    string          `json:"comments"`
+	UserID      int             `json:"user_id,omitempty"`    // Zero for feedback left before sign-in was required
+	OrderID     int             `json:"order_id,omitempty"`   // Set when rating a collected order
+	ProductID   int             `json:"product_id,omitempty"` // Set on the per-dish ratings of an order and on product reviews
+	ProductName string          `json:"product_name,omitempty"`
+	ResolvedAt  time.Time       `json:"resolved_at,omitempty"` // Zero until an admin marks it resolved
+	HiddenAt    time.Time       `json:"hidden_at,omitempty"`   // Zero unless an admin hid it as spam
+	Replies     []FeedbackReply `json:"replies,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// IsProductRating reports whether the entry rates a single product, either
+// as a dish of an order or as a review. Its FoodQuality holds the rating.
+func (f Feedback) IsProductRating() bool {
+	return f.ProductID != 0
+}
+
+// IsReview reports whether the entry is a product review left from the menu
+func (f Feedback) IsReview() bool {
+	return f.ProductID != 0 && f.OrderID == 0
+}
+
+// IsResolved reports whether an admin has dealt with the feedback
+func (f Feedback) IsResolved() bool {
+	return !f.ResolvedAt.IsZero()
+}
+
+// IsHidden reports whether the feedback was hidden as spam
+func (f Feedback) IsHidden() bool {
+	return !f.HiddenAt.IsZero()
+}
+
+// FoodQualityStars renders the food quality rating as stars
+func (f Feedback) FoodQualityStars() string {
+	return Stars(f.FoodQuality)
+}
+
+// ServiceStars renders the service rating as stars
+func (f Feedback) ServiceStars() string {
+	return Stars(f.Service)
+}
+
+// Stars renders a 1 to 5 rating as filled and empty stars
+func Stars(rating int) string {
+	if rating < 0 {
+		rating = 0
+	}
+	if rating > 5 {
+		rating = 5
+	}
+	return strings.Repeat("★", rating) + strings.Repeat("☆", 5-rating)
+}
+
+// FeedbackReply is an admin's answer to a piece of feedback
+type FeedbackReply struct {
+	ID         int       `json:"id"`
+	FeedbackID int       `json:"feedback_id"`
+	AdminName  string    `json:"admin_name"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FeedbackFilter selects a page of feedback. Zero values match everything,
+// except that hidden feedback is only returned when Status is FeedbackHidden.
+type FeedbackFilter struct {
+	From        time.Time
+	To          time.Time // Exclusive
+	FoodQuality int
+	Service     int
+	Search      string // Matched against the comments
+	Kind        string
+	Status      string
+	Page        int // Starts at 1
+	PerPage     int
+}
+
+// FeedbackTrend is the average ratings of the feedback left in one period
+type FeedbackTrend struct {
+	Period         string  `json:"period"`
+	Count          int     `json:"count"`
+	AvgFoodQuality float64 `json:"avg_food_quality"`
+	AvgService     float64 `json:"avg_service"`
+}
@@ -0,0 +1,175 @@
+package models
+
+import "time"
+
+// Reasons recorded on stock movements
+const (
+	MovementOpeningBalance = "opening-balance" // Stock a product already had when the ledger was introduced
+	MovementRestock        = "restock"
+	MovementSale           = "sale"
+	MovementCartReserve    = "cart-reserve"
+	MovementCartRelease    = "cart-release"
+	MovementWastage        = "wastage"
+	MovementCorrection     = "manual-correction"
+	MovementAvailability   = "ingredient-availability" // Stock of a recipe product following its ingredients
+	MovementConsumption    = "consumption"             // Ingredients used up by an order
+	MovementCancellation   = "order-cancelled"         // Units of a cancelled order put back on sale
+)
+
+// StockMovement is one entry of the inventory ledger. Summing the changes of
+// a product's movements gives its current stock.
+type StockMovement struct {
+	ID        int       `json:"id"`
+	ProductID int       `json:"product_id"`
+	Change    int       `json:"change"`
+	Reason    string    `json:"reason"`
+	ActorID   int       `json:"actor_id,omitempty"`
+	ActorName string    `json:"actor_name,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StockDrift reports a product whose stock does not match its ledger
+type StockDrift struct {
+	ProductID   int    `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Stock       int    `json:"stock"`
+	LedgerStock int    `json:"ledger_stock"`
+}
+
+// Drift returns how far the stored stock is from the ledger
+func (d StockDrift) Drift() int {
+	return d.Stock - d.LedgerStock
+}
+
+// StockAlert is raised when a product's stock falls to its reorder level.
+// It stays open until the stock is back above the level.
+type StockAlert struct {
+	ID           int       `json:"id"`
+	ProductID    int       `json:"product_id"`
+	ProductName  string    `json:"product_name"`
+	Stock        int       `json:"stock"` // Stock when the alert was raised
+	ReorderLevel int       `json:"reorder_level"`
+	CreatedAt    time.Time `json:"created_at"`
+	ResolvedAt   time.Time `json:"resolved_at,omitempty"`
+}
+
+// ReorderLine is one row of the "to reorder" report
+type ReorderLine struct {
+	ProductID         int    `json:"product_id"`
+	ProductName       string `json:"product_name"`
+	Stock             int    `json:"stock"`
+	ReorderLevel      int    `json:"reorder_level"`
+	SuggestedQuantity int    `json:"suggested_quantity"`
+}
+
+// Ingredient is a raw material consumed by products made to a recipe
+type Ingredient struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Unit      string    `json:"unit"` // Unit the stock and recipe quantities are measured in, e.g. g, ml, pcs
+	Stock     float64   `json:"stock"`
+	Committed float64   `json:"committed"` // Needed by carts and orders not yet prepared
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Available returns the stock not already committed to carts and orders
+func (i Ingredient) Available() float64 {
+	if i.Stock <= i.Committed {
+		return 0
+	}
+	return i.Stock - i.Committed
+}
+
+// RecipeItem is the quantity of an ingredient that goes into one unit of a product
+type RecipeItem struct {
+	ProductID      int     `json:"product_id"`
+	IngredientID   int     `json:"ingredient_id"`
+	IngredientName string  `json:"ingredient_name"`
+	Unit           string  `json:"unit"`
+	Quantity       float64 `json:"quantity"`
+	Available      float64 `json:"available"` // Uncommitted stock of the ingredient
+}
+
+// Portions returns how many units of the product the ingredient's available stock allows
+func (r RecipeItem) Portions() int {
+	if r.Quantity <= 0 {
+		return 0
+	}
+	return int(r.Available/r.Quantity + 1e-9)
+}
+
+// IngredientMovement is one entry of the ingredient ledger
+type IngredientMovement struct {
+	ID             int       `json:"id"`
+	IngredientID   int       `json:"ingredient_id"`
+	IngredientName string    `json:"ingredient_name"`
+	Change         float64   `json:"change"`
+	Reason         string    `json:"reason"`
+	ActorName      string    `json:"actor_name,omitempty"`
+	Note           string    `json:"note,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Reasons staff can give when recording wastage
+const (
+	WastageExpired = "expired"
+	WastageDamaged = "damaged"
+	WastageSpoiled = "spoiled"
+	WastageOther   = "other"
+)
+
+// WastageReasons lists the wastage reasons in the order they are offered
+var WastageReasons = []string{WastageExpired, WastageDamaged, WastageSpoiled, WastageOther}
+
+// StockBatch is a quantity of a product received together, consumed first
+// expiry first out
+type StockBatch struct {
+	ID                int       `json:"id"`
+	ProductID         int       `json:"product_id"`
+	ProductName       string    `json:"product_name"`
+	QuantityReceived  int       `json:"quantity_received"`
+	QuantityRemaining int       `json:"quantity_remaining"`
+	UnitCost          float64   `json:"unit_cost"`
+	ReceivedAt        time.Time `json:"received_at"`
+	ExpiresAt         time.Time `json:"expires_at,omitempty"` // Zero for batches that do not expire
+	Note              string    `json:"note,omitempty"`
+}
+
+// HasExpiry reports whether the batch has an expiry date
+func (b StockBatch) HasExpiry() bool {
+	return !b.ExpiresAt.IsZero()
+}
+
+// IsExpired reports whether the batch's expiry date has passed
+func (b StockBatch) IsExpired() bool {
+	return b.HasExpiry() && !time.Now().Before(b.ExpiresAt)
+}
+
+// WastageEntry records units thrown away and what they cost
+type WastageEntry struct {
+	ID          int       `json:"id"`
+	BatchID     int       `json:"batch_id,omitempty"` // Zero when the units were not tracked in a batch
+	ProductID   int       `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	Quantity    int       `json:"quantity"`
+	UnitCost    float64   `json:"unit_cost"`
+	Reason      string    `json:"reason"`
+	Note        string    `json:"note,omitempty"`
+	ActorName   string    `json:"actor_name,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Cost returns the value of the wasted units
+func (w WastageEntry) Cost() float64 {
+	return w.UnitCost * float64(w.Quantity)
+}
+
+// WastageLine is one row of the wastage cost report
+type WastageLine struct {
+	ProductID   int     `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Reason      string  `json:"reason"`
+	Quantity    int     `json:"quantity"`
+	Cost        float64 `json:"cost"`
+}
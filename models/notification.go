@@ -0,0 +1,103 @@
+package models
+
+import "time"
+
+// Events users can be notified about
+const (
+	EventOrderReady  = "order-ready"
+	EventOrderUpdate = "order-update" // Being prepared, collected or cancelled
+	EventLowBalance  = "low-balance"
+)
+
+// NotificationEvents lists the events in the order the preferences page shows them
+var NotificationEvents = []string{EventOrderReady, EventOrderUpdate, EventLowBalance}
+
+// Channels notifications are delivered through
+const (
+	ChannelInApp   = "in-app"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// NotificationChannels lists the channels a user can turn on or off
+var NotificationChannels = []string{ChannelInApp, ChannelEmail, ChannelWebhook}
+
+// EventLabel describes an event for the preferences page
+func EventLabel(event string) string {
+	switch event {
+	case EventOrderReady:
+		return "Order ready for pickup"
+	case EventOrderUpdate:
+		return "Other order updates"
+	case EventLowBalance:
+		return "Low wallet balance"
+	}
+	return event
+}
+
+// DefaultNotificationPreference reports whether a channel is on for an event
+// until the user says otherwise. Webhooks only fire once a URL is set.
+func DefaultNotificationPreference(event, channel string) bool {
+	switch channel {
+	case ChannelInApp, ChannelWebhook:
+		return true
+	case ChannelEmail:
+		return event == EventOrderReady || event == EventLowBalance
+	}
+	return false
+}
+
+// EventPreferences holds which channels a user wants an event through
+type EventPreferences struct {
+	Event    string
+	Label    string
+	Channels map[string]bool
+}
+
+// Notification is a message in a user's in-app inbox
+type Notification struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Event     string    `json:"event"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	Link      string    `json:"link,omitempty"`
+	ReadAt    time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsRead reports whether the user has seen the notification
+func (n Notification) IsRead() bool {
+	return !n.ReadAt.IsZero()
+}
+
+// Outbox statuses
+const (
+	OutboxPending = "pending" // Waiting to be sent, or to be retried
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed" // Gave up after too many attempts
+)
+
+// OutboxMessage is a notification waiting to be delivered through one channel.
+// It is written in the same transaction as the change it reports, so it is
+// sent even if the server restarts in between.
+type OutboxMessage struct {
+	ID            int       `json:"id"`
+	UserID        int       `json:"user_id"`
+	Username      string    `json:"username"`
+	Channel       string    `json:"channel"`
+	Recipient     string    `json:"recipient,omitempty"` // Email address or webhook URL
+	Event         string    `json:"event"`
+	Subject       string    `json:"subject"`
+	Body          string    `json:"body"`
+	Link          string    `json:"link,omitempty"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	SentAt        time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// DefaultLowBalanceThreshold is the wallet balance below which users are warned
+const DefaultLowBalanceThreshold = 50.0
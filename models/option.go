@@ -0,0 +1,96 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ProductVariant is a version of a product, such as a size, with its own
+// price difference and optionally its own stock
+type ProductVariant struct {
+	ID           int       `json:"id"`
+	ProductID    int       `json:"product_id"`
+	Name         string    `json:"name"`
+	PriceDelta   float64   `json:"price_delta"` // Added to the product's price, may be negative
+	Stock        int       `json:"stock"`
+	TracksStock  bool      `json:"tracks_stock"` // Without its own stock the variant shares the product's
+	Active       bool      `json:"active"`
+	DisplayOrder int       `json:"display_order"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AbsPriceDelta returns the size of the price difference, for display next to its sign
+func (v ProductVariant) AbsPriceDelta() float64 {
+	if v.PriceDelta < 0 {
+		return -v.PriceDelta
+	}
+	return v.PriceDelta
+}
+
+// ModifierGroup is a set of add-ons a customer picks between MinSelect and
+// MaxSelect of, such as extra toppings
+type ModifierGroup struct {
+	ID           int        `json:"id"`
+	ProductID    int        `json:"product_id"`
+	Name         string     `json:"name"`
+	MinSelect    int        `json:"min_select"`
+	MaxSelect    int        `json:"max_select"` // 0 for no limit
+	DisplayOrder int        `json:"display_order"`
+	Modifiers    []Modifier `json:"modifiers"`
+}
+
+// IsRequired reports whether at least one modifier of the group must be picked
+func (g ModifierGroup) IsRequired() bool {
+	return g.MinSelect > 0
+}
+
+// Allows reports whether picking count modifiers of the group is within its limits
+func (g ModifierGroup) Allows(count int) bool {
+	return count >= g.MinSelect && (g.MaxSelect == 0 || count <= g.MaxSelect)
+}
+
+// Modifier is an add-on with its own price
+type Modifier struct {
+	ID      int     `json:"id"`
+	GroupID int     `json:"group_id"`
+	Name    string  `json:"name"`
+	Price   float64 `json:"price"`
+	Active  bool    `json:"active"`
+}
+
+// ProductOptions are the variants and modifier groups of a product
+type ProductOptions struct {
+	Variants []ProductVariant `json:"variants"`
+	Groups   []ModifierGroup  `json:"groups"`
+}
+
+// HasOptions reports whether there is anything to choose
+func (o ProductOptions) HasOptions() bool {
+	return len(o.Variants) > 0 || len(o.Groups) > 0
+}
+
+// OptionSelection is what a customer picked when adding a product to the cart
+type OptionSelection struct {
+	VariantID   int   `json:"variant_id,omitempty"`
+	ModifierIDs []int `json:"modifier_ids,omitempty"`
+}
+
+// SelectedModifier is a modifier picked for a cart or order line, with the
+// name and price it had at the time
+type SelectedModifier struct {
+	ID    int     `json:"id"`
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+}
+
+// optionsLabel describes a variant and modifiers, such as "Large, Extra cheese"
+func optionsLabel(variantName string, modifiers []SelectedModifier) string {
+	var parts []string
+	if variantName != "" {
+		parts = append(parts, variantName)
+	}
+	for _, modifier := range modifiers {
+		parts = append(parts, modifier.Name)
+	}
+	return strings.Join(parts, ", ")
+}
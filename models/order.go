@@ -0,0 +1,156 @@
+package models
+
+import "time"
+
+// Order statuses
+const (
+	OrderStatusScheduled = "scheduled" // Waiting for its pickup slot to come within the kitchen lead time
+	OrderStatusPending   = "pending"
+	OrderStatusPreparing = "preparing"
+	OrderStatusReady     = "ready"
+	OrderStatusCollected = "collected"
+	OrderStatusCancelled = "cancelled"
+)
+
+// Order model
+type Order struct {
+	ID              int         `json:"id"`
+	UserID          int         `json:"user_id"`
+	Username        string      `json:"username"`
+	Status          string      `json:"status"`
+	TotalPrice      float64     `json:"total_price"`
+	PickupSlotID    int         `json:"pickup_slot_id,omitempty"`
+	PickupSlotLabel string      `json:"pickup_slot_label,omitempty"`
+	PickupAt        time.Time   `json:"pickup_at,omitempty"` // Zero for "as soon as possible" orders
+	PaymentMethod   string      `json:"payment_method"`
+	RefundedTotal   float64     `json:"refunded_total"`
+	CancelledAt     time.Time   `json:"cancelled_at,omitempty"`
+	CancelReason    string      `json:"cancel_reason,omitempty"`
+	CashierID       int         `json:"cashier_id,omitempty"` // Set for orders taken at the counter
+	CashierName     string      `json:"cashier_name,omitempty"`
+	Tendered        float64     `json:"tendered,omitempty"` // Cash handed over for a counter order
+	ShiftID         int         `json:"shift_id,omitempty"` // Cashier shift a counter order was taken in
+	CollectedAt     time.Time   `json:"collected_at,omitempty"`
+	CollectedByName string      `json:"collected_by,omitempty"` // Staff member who handed over the order
+	Items           []OrderItem `json:"items"`
+	CreatedAt       time.Time   `json:"created_at"`
+}
+
+// IsScheduled reports whether the order was placed for a pickup slot
+func (o Order) IsScheduled() bool {
+	return !o.PickupAt.IsZero()
+}
+
+// IsCancelled reports whether the order was cancelled
+func (o Order) IsCancelled() bool {
+	return o.Status == OrderStatusCancelled
+}
+
+// CustomerCanCancel reports whether the customer may still cancel the order,
+// which they can until the kitchen starts preparing it
+func (o Order) CustomerCanCancel() bool {
+	return o.Status == OrderStatusScheduled || o.Status == OrderStatusPending
+}
+
+// Collectable reports whether the order can be handed over at the counter
+func (o Order) Collectable() bool {
+	return o.Status == OrderStatusPending || o.Status == OrderStatusPreparing || o.Status == OrderStatusReady
+}
+
+// IsCounterOrder reports whether a cashier took the order at the counter
+func (o Order) IsCounterOrder() bool {
+	return o.CashierID != 0
+}
+
+// Change returns the cash handed back for a counter order paid in cash
+func (o Order) Change() float64 {
+	if o.Tendered <= o.TotalPrice {
+		return 0
+	}
+	return o.Tendered - o.TotalPrice
+}
+
+// Refundable returns how much of the order's price has not been refunded yet
+func (o Order) Refundable() float64 {
+	if o.RefundedTotal >= o.TotalPrice {
+		return 0
+	}
+	return o.TotalPrice - o.RefundedTotal
+}
+
+// Dishes returns the first line of each product in the order, for rating
+// products ordered with different options only once
+func (o Order) Dishes() []OrderItem {
+	seen := make(map[int]bool)
+	var dishes []OrderItem
+	for _, item := range o.Items {
+		if !seen[item.ProductID] {
+			seen[item.ProductID] = true
+			dishes = append(dishes, item)
+		}
+	}
+	return dishes
+}
+
+type OrderItem struct {
+	ID          int                `json:"id"`
+	OrderID     int                `json:"order_id"`
+	ProductID   int                `json:"product_id"`
+	ProductName string             `json:"product_name"`
+	VariantID   int                `json:"variant_id,omitempty"`
+	VariantName string             `json:"variant_name,omitempty"`
+	Modifiers   []SelectedModifier `json:"modifiers,omitempty"`
+	Quantity    int                `json:"quantity"`
+	UnitPrice   float64            `json:"unit_price"` // Includes the variant and modifiers
+	ItemTotal   float64            `json:"item_total"`
+	Refunded    int                `json:"refunded"` // Units refunded as missing
+}
+
+// Refundable returns how many units of the line can still be refunded
+func (i OrderItem) Refundable() int {
+	return i.Quantity - i.Refunded
+}
+
+// OptionsLabel describes the variant and modifiers ordered
+func (i OrderItem) OptionsLabel() string {
+	return optionsLabel(i.VariantName, i.Modifiers)
+}
+
+// Outcomes of reordering an order line
+const (
+	ReorderAdded       = "added"
+	ReorderOutOfStock  = "out_of_stock"
+	ReorderUnavailable = "unavailable" // Taken off the menu, or its options are no longer offered
+)
+
+// ReorderedItem is what happened to one line of a past order when it was ordered again
+type ReorderedItem struct {
+	Item      OrderItem `json:"item"`
+	Outcome   string    `json:"outcome"`
+	UnitPrice float64   `json:"unit_price"` // Current price of a unit, set for added lines
+}
+
+// PriceChanged reports whether an added line costs something different now
+func (l ReorderedItem) PriceChanged() bool {
+	return l.Outcome == ReorderAdded && l.UnitPrice != l.Item.UnitPrice
+}
+
+// PickupSlot is a daily pickup window with a limited number of orders
+type PickupSlot struct {
+	ID        int       `json:"id"`
+	Label     string    `json:"label"`
+	StartTime string    `json:"start_time"` // "15:04", local time
+	EndTime   string    `json:"end_time"`
+	Capacity  int       `json:"capacity"`
+	Active    bool      `json:"active"`
+	Booked    int       `json:"booked"` // Orders already placed for the date the slot was loaded for
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Remaining returns how many more orders the slot can take
+func (s PickupSlot) Remaining() int {
+	if s.Booked >= s.Capacity {
+		return 0
+	}
+	return s.Capacity - s.Booked
+}
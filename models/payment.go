@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Payment methods
+const (
+	PaymentCard   = "card"
+	PaymentCash   = "cash"
+	PaymentWallet = "wallet"
+)
+
+// Reasons a wallet balance changes
+const (
+	WalletTopUp   = "top-up"
+	WalletPayment = "payment"
+	WalletRefund  = "refund"
+)
+
+// WalletTransaction is one entry of a user's wallet ledger. Summing the
+// amounts gives the balance.
+type WalletTransaction struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Amount    float64   `json:"amount"` // Positive for credit, negative for spending
+	Reason    string    `json:"reason"`
+	OrderID   int       `json:"order_id,omitempty"`
+	ActorID   int       `json:"actor_id,omitempty"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wallet is a user's wallet balance
+type Wallet struct {
+	UserID   int     `json:"user_id"`
+	Username string  `json:"username"`
+	Email    string  `json:"email"`
+	Balance  float64 `json:"balance"`
+}
+
+// Refund is money given back for an order, either all that was left of it
+// on cancellation or the price of items that were missing
+type Refund struct {
+	ID          int       `json:"id"`
+	OrderID     int       `json:"order_id"`
+	OrderItemID int       `json:"order_item_id,omitempty"` // Set for refunds of missing items
+	ProductName string    `json:"product_name,omitempty"`
+	Quantity    int       `json:"quantity,omitempty"`
+	Amount      float64   `json:"amount"`
+	Method      string    `json:"method"` // The order's payment method, or PaymentWallet for store credit
+	Reason      string    `json:"reason"`
+	ActorID     int       `json:"actor_id"`
+	ActorName   string    `json:"actor_name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// IsItemRefund reports whether the refund is for missing items rather than a cancellation
+func (r Refund) IsItemRefund() bool {
+	return r.OrderItemID != 0
+}
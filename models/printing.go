@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Print job statuses
+const (
+	PrintPending = "pending" // Waiting to be sent, or to be retried
+	PrintPrinted = "printed"
+	PrintFailed  = "failed" // Gave up after too many attempts
+)
+
+// PrintJob is a rendered receipt waiting in the print queue
+type PrintJob struct {
+	ID            int       `json:"id"`
+	OrderID       int       `json:"order_id"`
+	Data          []byte    `json:"-"` // ESC/POS bytes sent to the printer
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	PrintedAt     time.Time `json:"printed_at,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Settings that shape printed receipts
+const (
+	SettingReceiptHeader  = "receipt_header"
+	SettingTaxRatePercent = "tax_rate_percent" // Tax included in menu prices
+)
+
+// DefaultReceiptHeader is printed at the top of receipts until an admin changes it
+const DefaultReceiptHeader = "Smart Canteen"
@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Purchase order statuses
+const (
+	PurchaseOrderDraft             = "draft"
+	PurchaseOrderSent              = "sent"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+)
+
+// Supplier is a vendor the canteen restocks from
+type Supplier struct {
+	ID           int            `json:"id"`
+	Name         string         `json:"name"`
+	ContactName  string         `json:"contact_name"`
+	Phone        string         `json:"phone"`
+	Email        string         `json:"email"`
+	LeadTimeDays int            `json:"lead_time_days"`
+	Notes        string         `json:"notes"`
+	Items        []SupplierItem `json:"items,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+// SupplierItem is a product a supplier provides and what it usually costs
+type SupplierItem struct {
+	SupplierID  int     `json:"supplier_id"`
+	ProductID   int     `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	UnitCost    float64 `json:"unit_cost"`
+}
+
+// PurchaseOrder is an order for stock placed with a supplier
+type PurchaseOrder struct {
+	ID           int                 `json:"id"`
+	SupplierID   int                 `json:"supplier_id"`
+	SupplierName string              `json:"supplier_name"`
+	Status       string              `json:"status"`
+	Notes        string              `json:"notes"`
+	CreatedBy    int                 `json:"created_by"`
+	Lines        []PurchaseOrderLine `json:"lines,omitempty"`
+	TotalCost    float64             `json:"total_cost"`
+	CreatedAt    time.Time           `json:"created_at"`
+	SentAt       time.Time           `json:"sent_at,omitempty"`
+	ExpectedAt   time.Time           `json:"expected_at,omitempty"` // SentAt plus the supplier's lead time
+}
+
+// IsEditable reports whether lines can still be added or removed
+func (po PurchaseOrder) IsEditable() bool {
+	return po.Status == PurchaseOrderDraft
+}
+
+// CanReceive reports whether goods can be received against the order
+func (po PurchaseOrder) CanReceive() bool {
+	return po.Status == PurchaseOrderSent || po.Status == PurchaseOrderPartiallyReceived
+}
+
+// PurchaseOrderLine is a product and quantity on a purchase order
+type PurchaseOrderLine struct {
+	ID               int     `json:"id"`
+	PurchaseOrderID  int     `json:"purchase_order_id"`
+	ProductID        int     `json:"product_id"`
+	ProductName      string  `json:"product_name"`
+	QuantityOrdered  int     `json:"quantity_ordered"`
+	QuantityReceived int     `json:"quantity_received"`
+	UnitCost         float64 `json:"unit_cost"`
+}
+
+// Outstanding returns how many units are still to be delivered
+func (l PurchaseOrderLine) Outstanding() int {
+	if l.QuantityReceived >= l.QuantityOrdered {
+		return 0
+	}
+	return l.QuantityOrdered - l.QuantityReceived
+}
+
+// GoodsReceipt records a delivery of units against a purchase order line
+type GoodsReceipt struct {
+	ID                  int       `json:"id"`
+	PurchaseOrderLineID int       `json:"purchase_order_line_id"`
+	ProductName         string    `json:"product_name"`
+	Quantity            int       `json:"quantity"`
+	UnitCost            float64   `json:"unit_cost"`
+	ReceivedBy          string    `json:"received_by"`
+	ReceivedAt          time.Time `json:"received_at"`
+}
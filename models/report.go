@@ -0,0 +1,48 @@
+package models
+
+// Groupings for the sales over time report
+const (
+	GroupByDay   = "day"
+	GroupByWeek  = "week"
+	GroupByMonth = "month"
+)
+
+// SalesSummary totals the orders placed in a date range
+type SalesSummary struct {
+	Orders            int     `json:"orders"`
+	Units             int     `json:"units"`
+	Revenue           float64 `json:"revenue"`
+	Refunded          float64 `json:"refunded"` // Partial refunds of the orders, which were not cancelled
+	AverageOrderValue float64 `json:"average_order_value"`
+}
+
+// SalesPeriod is the sales of one day, week or month
+type SalesPeriod struct {
+	Period  string  `json:"period"` // 2024-03-01, the Monday 2024-02-26 of its week, or 2024-03
+	Orders  int     `json:"orders"`
+	Units   int     `json:"units"`
+	Revenue float64 `json:"revenue"`
+}
+
+// ProductSales is the units sold and revenue of one product
+type ProductSales struct {
+	ProductID   int     `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Category    string  `json:"category"`
+	Units       int     `json:"units"`
+	Revenue     float64 `json:"revenue"`
+}
+
+// CategorySales is the units sold and revenue of one category
+type CategorySales struct {
+	Category string  `json:"category"`
+	Units    int     `json:"units"`
+	Revenue  float64 `json:"revenue"`
+}
+
+// HourlySales is the orders placed in one hour of the day across a date range
+type HourlySales struct {
+	Hour    int     `json:"hour"` // 0-23, local time
+	Orders  int     `json:"orders"`
+	Revenue float64 `json:"revenue"`
+}
@@ -0,0 +1,102 @@
+package models
+
+import "time"
+
+// Reasons cash goes in or out of the drawer during a shift
+const (
+	CashSale    = "sale"
+	CashRefund  = "refund"
+	CashPaidIn  = "paid-in"  // Cash added to the drawer, such as change from the bank
+	CashPaidOut = "paid-out" // Cash taken out of the drawer, such as petty cash purchases
+)
+
+// Shift is a cashier's session at the till, from opening it with a float of
+// cash to closing it with the cash counted in the drawer
+type Shift struct {
+	ID           int       `json:"id"`
+	CashierID    int       `json:"cashier_id"`
+	CashierName  string    `json:"cashier_name"`
+	OpeningFloat float64   `json:"opening_float"`
+	OpenedAt     time.Time `json:"opened_at"`
+	ClosedAt     time.Time `json:"closed_at,omitempty"` // Zero while the shift is open
+	ExpectedCash float64   `json:"expected_cash"`       // Set on closing: the float plus the cash movements
+	CountedCash  float64   `json:"counted_cash"`
+	Note         string    `json:"note"`
+}
+
+// IsOpen reports whether the shift has not been closed yet
+func (s Shift) IsOpen() bool {
+	return s.ClosedAt.IsZero()
+}
+
+// OverShort returns how much more cash was counted than expected, negative
+// when the drawer is short
+func (s Shift) OverShort() float64 {
+	return s.CountedCash - s.ExpectedCash
+}
+
+// CashMovement is cash going in or out of the drawer during a shift
+type CashMovement struct {
+	ID        int       `json:"id"`
+	ShiftID   int       `json:"shift_id"`
+	Amount    float64   `json:"amount"` // Positive for cash in, negative for cash out
+	Reason    string    `json:"reason"`
+	OrderID   int       `json:"order_id,omitempty"`
+	ActorID   int       `json:"actor_id"`
+	ActorName string    `json:"actor_name"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TenderTotal totals the orders or refunds paid by one method
+type TenderTotal struct {
+	Method string  `json:"method"`
+	Count  int     `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// ZReport closes out one shift or all the shifts of a day
+type ZReport struct {
+	Shifts       []Shift       `json:"shifts"`
+	Sales        []TenderTotal `json:"sales"`   // Orders taken during the shifts, by payment method
+	Refunds      []TenderTotal `json:"refunds"` // Refunds given during the shifts, by method
+	OpeningFloat float64       `json:"opening_float"`
+	CashSales    float64       `json:"cash_sales"`
+	CashRefunds  float64       `json:"cash_refunds"`
+	PaidIn       float64       `json:"paid_in"`
+	PaidOut      float64       `json:"paid_out"`
+	ExpectedCash float64       `json:"expected_cash"`
+	CountedCash  float64       `json:"counted_cash"` // Only covers closed shifts
+	OpenShifts   int           `json:"open_shifts"`
+}
+
+// SalesTotal sums the sales of every payment method
+func (z ZReport) SalesTotal() float64 {
+	return sumTenders(z.Sales)
+}
+
+// RefundsTotal sums the refunds of every method
+func (z ZReport) RefundsTotal() float64 {
+	return sumTenders(z.Refunds)
+}
+
+// OverShort returns how much more cash was counted than expected over the
+// closed shifts, negative when the drawers were short
+func (z ZReport) OverShort() float64 {
+	var overShort float64
+	for _, shift := range z.Shifts {
+		if !shift.IsOpen() {
+			overShort += shift.OverShort()
+		}
+	}
+	return overShort
+}
+
+// sumTenders adds up the amounts of tender totals
+func sumTenders(tenders []TenderTotal) float64 {
+	var total float64
+	for _, tender := range tenders {
+		total += tender.Amount
+	}
+	return total
+}
@@ -5,6 +5,20 @@ import (
 	"time"
 )
 
+// User roles
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleCashier = "cashier" // Takes walk-in orders at the point of sale
+	RoleWalkIn  = "walk-in" // The account anonymous counter orders are placed for, which cannot log in
+)
+
+// WalkInUsername is the username of the RoleWalkIn account
+const WalkInUsername = "walk-in"
+
+// StaffRoles are the roles an admin can give a user
+var StaffRoles = []string{RoleUser, RoleCashier, RoleAdmin}
+
 type User struct {
 	ID        int       `json:"id"`
 	Username  string    `json:"username"`
@@ -15,14 +29,70 @@ type User struct {
 }
 
 type Product struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
-	ImageURL    string    `json:"image_url"`
-	Stock       int       `json:"stock"`
-	Category    string    `json:"category"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID              int       `json:"id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	Price           float64   `json:"price"`
+	ImageURL        string    `json:"image_url"`
+	ThumbnailURL    string    `json:"thumbnail_url,omitempty"` // Scaled-down copy of an uploaded image
+	Stock           int       `json:"stock"`
+	HasRecipe       bool      `json:"has_recipe"`       // Stock is derived from the ingredients of the product's recipe
+	ReorderLevel    int       `json:"reorder_level"`    // Stock at or below which the product should be reordered, 0 to never alert
+	ReorderQuantity int       `json:"reorder_quantity"` // Usual quantity to reorder
+	CategoryID      int       `json:"category_id,omitempty"`
+	Category        string    `json:"category"`              // Name of the category, loaded from the categories table
+	ArchivedAt      time.Time `json:"archived_at,omitempty"` // Zero unless the product was taken off the menu
+	AvgRating       float64   `json:"avg_rating"`            // Average of the ratings customers gave with their orders and reviews
+	RatingCount     int       `json:"rating_count"`
+	ReviewCount     int       `json:"review_count"` // Ratings that came with a written review
+	DietaryTags     []string  `json:"dietary_tags"`
+	Allergens       []string  `json:"allergens"`
+	Nutrition       Nutrition `json:"nutrition"`
+	HasOptions      bool      `json:"has_options"` // Has active variants or modifiers to choose from
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Orders the menu can be sorted in
+const (
+	ProductSortNewest = "newest"
+	ProductSortRating = "rating"
+)
+
+// MenuFilter selects the products shown on the menu. Zero values match everything.
+type MenuFilter struct {
+	Category         string   // Category slug
+	Sort             string   // ProductSortNewest or ProductSortRating
+	Diets            []string // Dietary tags every product must carry
+	ExcludeAllergens []string // Allergens no product may contain
+}
+
+// NeedsReorder reports whether stock has fallen to the reorder level
+func (p Product) NeedsReorder() bool {
+	return p.ReorderLevel > 0 && p.Stock <= p.ReorderLevel
+}
+
+// IsArchived reports whether the product has been taken off the menu
+func (p Product) IsArchived() bool {
+	return !p.ArchivedAt.IsZero()
+}
+
+// CardImage returns the image to show on menu cards, preferring the thumbnail
+func (p Product) CardImage() string {
+	if p.ThumbnailURL != "" {
+		return p.ThumbnailURL
+	}
+	return p.ImageURL
+}
+
+// Category groups products on the menu
+type Category struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Slug         string    `json:"slug"`
+	DisplayOrder int       `json:"display_order"`
+	IconURL      string    `json:"icon_url"`
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 // Cart related models
@@ -35,25 +105,48 @@ type Cart struct {
 }
 
 type CartItem struct {
-	ID        int     `json:"id"`
-	ProductID int     `json:"product_id"`
-	Product   Product `json:"product"`
-	Quantity  int     `json:"quantity"`
-	ItemTotal float64 `json:"item_total"`
+	ID          int                `json:"id"`
+	ProductID   int                `json:"product_id"`
+	Product     Product            `json:"product"`
+	VariantID   int                `json:"variant_id,omitempty"`
+	VariantName string             `json:"variant_name,omitempty"`
+	Modifiers   []SelectedModifier `json:"modifiers,omitempty"`
+	Quantity    int                `json:"quantity"`
+	UnitPrice   float64            `json:"unit_price"` // Product price with the variant and modifiers
+	ItemTotal   float64            `json:"item_total"`
 }
 
-// Feedback model
-type Feedback struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Email       string    `json:"email"`
-	FoodQuality int       `json:"food_quality"`
-	Service     int       `json:"service"`
-	Comments    string    `json:"comments"`
-	CreatedAt   time.Time `json:"created_at"`
+// OptionsLabel describes the variant and modifiers picked for the line
+func (i CartItem) OptionsLabel() string {
+	return optionsLabel(i.VariantName, i.Modifiers)
 }
 
 // Custom errors
 var (
-	ErrInsufficientStock = errors.New("insufficient stock")
-)
\ No newline at end of file
+	ErrInsufficientStock    = errors.New("insufficient stock")
+	ErrInvalidQuantity      = errors.New("quantity must be at least 1")
+	ErrEmptyCart            = errors.New("cart is empty")
+	ErrSlotFull             = errors.New("pickup slot is full")
+	ErrSlotUnavailable      = errors.New("pickup slot is not available")
+	ErrProductUnavailable   = errors.New("product is no longer available")
+	ErrInvalidPurchaseOrder = errors.New("purchase order cannot be changed in its current status")
+	ErrOverReceipt          = errors.New("received quantity exceeds what is outstanding")
+	ErrRecipeStock          = errors.New("stock of a product with a recipe follows its ingredients")
+	ErrOrderNotRateable     = errors.New("only collected orders can be rated")
+	ErrAlreadyRated         = errors.New("order has already been rated")
+	ErrFeedbackLimit        = errors.New("feedback already left today")
+	ErrNotPurchased         = errors.New("only customers who bought the product can review it")
+	ErrInvalidOptions       = errors.New("selected options are not valid for the product")
+	ErrOrderNotCancellable  = errors.New("order can no longer be cancelled")
+	ErrInsufficientBalance  = errors.New("wallet balance is too low")
+	ErrInvalidRefund        = errors.New("refund exceeds what can still be refunded")
+	ErrInsufficientTender   = errors.New("amount tendered is less than the total")
+	ErrNoOpenShift          = errors.New("no shift is open")
+	ErrShiftAlreadyOpen     = errors.New("a shift is already open")
+	ErrShiftClosed          = errors.New("shift is already closed")
+	ErrInvalidPickupCode    = errors.New("pickup code is not valid")
+	ErrAlreadyCollected     = errors.New("order has already been collected")
+	ErrOrderNotCollectable  = errors.New("order cannot be collected")
+	ErrInvalidWebhookURL    = errors.New("webhook URL must be an http or https URL")
+	ErrInvalidStatusChange  = errors.New("order cannot move to that status")
+)
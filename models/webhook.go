@@ -0,0 +1,68 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Events integrations can subscribe to
+const (
+	HookOrderPlaced     = "order.placed"
+	HookOrderReady      = "order.ready"
+	HookProductUpdated  = "product.updated"
+	HookStockLow        = "stock.low"
+	HookFeedbackCreated = "feedback.created"
+)
+
+// WebhookEvents lists the events an endpoint can subscribe to
+var WebhookEvents = []string{HookOrderPlaced, HookOrderReady, HookProductUpdated, HookStockLow, HookFeedbackCreated}
+
+// WebhookEndpoint is a URL an integration registered to receive events at
+type WebhookEndpoint struct {
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Secret      string    `json:"-"` // Signs every delivery so the receiver can trust it
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Subscribes reports whether the endpoint wants an event
+func (e WebhookEndpoint) Subscribes(event string) bool {
+	for _, subscribed := range e.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// EventsLabel lists the endpoint's events for display
+func (e WebhookEndpoint) EventsLabel() string {
+	return strings.Join(e.Events, ", ")
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending" // Waiting to be sent, or to be retried
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // Gave up after too many attempts
+)
+
+// WebhookDelivery is one event on its way to one endpoint
+type WebhookDelivery struct {
+	ID            int       `json:"id"`
+	EndpointID    int       `json:"endpoint_id"`
+	EndpointURL   string    `json:"endpoint_url"`
+	Event         string    `json:"event"`
+	EventID       string    `json:"event_id"` // Same for redeliveries, so receivers can drop duplicates
+	Payload       string    `json:"payload"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	ResponseCode  int       `json:"response_code,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	DeliveredAt   time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"auth-website/database"
+	"auth-website/worker"
+)
+
+// Dispatcher delivers the messages waiting in the notification outbox through
+// their channels, retrying the ones that fail
+type Dispatcher struct {
+	DB          *database.DB
+	Channels    map[string]Notifier // Keyed by models.Channel*
+	Interval    time.Duration       // How often to look for messages to send
+	MaxAttempts int                 // Messages are marked failed after this many attempts
+}
+
+// NewDispatcher returns a dispatcher delivering through channels
+func NewDispatcher(db *database.DB, channels map[string]Notifier) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Channels:    channels,
+		Interval:    5 * time.Second,
+		MaxAttempts: 5,
+	}
+}
+
+// Run sends due messages every Interval until stop is closed
+func (d *Dispatcher) Run(stop <-chan struct{}) {
+	worker.Loop("Notification dispatch", d.Interval, nil, stop, d.Process)
+}
+
+// Process sends every due message. Failed messages are retried with
+// exponential backoff until MaxAttempts is reached.
+func (d *Dispatcher) Process() error {
+	messages, err := d.DB.GetDueOutboxMessages(time.Now(), 50)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		notifier, ok := d.Channels[m.Channel]
+		if !ok {
+			err = fmt.Errorf("no %s channel is configured", m.Channel)
+		} else {
+			err = notifier.Notify(Message{
+				ID:      m.ID,
+				Attempt: m.Attempts + 1,
+				Subject: m.Subject,
+				Body:    m.Body,
+				UserID:  m.UserID,
+				To:      m.Recipient,
+				Event:   m.Event,
+				Link:    m.Link,
+			})
+		}
+
+		if err != nil {
+			attempts := m.Attempts + 1
+			giveUp := !ok || attempts >= d.MaxAttempts
+			log.Printf("Failed to send %s notification %d (attempt %d): %v", m.Channel, m.ID, attempts, err)
+			if err := d.DB.MarkOutboxMessageFailed(m.ID, err.Error(), time.Now().Add(worker.Backoff(d.Interval, attempts)), giveUp); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.DB.MarkOutboxMessageSent(m.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
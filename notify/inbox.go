@@ -0,0 +1,16 @@
+package notify
+
+import "auth-website/database"
+
+// InboxNotifier puts messages in the user's in-app inbox
+type InboxNotifier struct {
+	DB *database.DB
+}
+
+// Notify adds msg to the inbox of msg.UserID
+func (n InboxNotifier) Notify(msg Message) error {
+	if msg.UserID == 0 {
+		return ErrNoRecipient
+	}
+	return n.DB.AddNotification(msg.UserID, msg.Event, msg.Subject, msg.Body, msg.Link)
+}
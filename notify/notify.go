@@ -0,0 +1,30 @@
+package notify
+
+import "log"
+
+// Message is a notification to deliver to staff or users
+type Message struct {
+	ID      int // Outbox message ID, the same for every attempt at sending it
+	Attempt int // Which attempt at sending the message this is, from 1
+	Subject string
+	Body    string
+	UserID  int    // User the message is for, 0 for staff alerts
+	To      string // Email address or URL for channels that deliver to one; empty for the default
+	Event   string
+	Link    string // Page the message is about
+}
+
+// Notifier delivers messages through some channel
+type Notifier interface {
+	Notify(msg Message) error
+}
+
+// LogNotifier writes messages to the standard logger. It is the default when
+// no other channel is configured.
+type LogNotifier struct{}
+
+// Notify logs the message
+func (LogNotifier) Notify(msg Message) error {
+	log.Printf("Notification: %s: %s", msg.Subject, msg.Body)
+	return nil
+}
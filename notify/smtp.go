@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrNoRecipient is returned for messages that have nobody to go to
+var ErrNoRecipient = errors.New("notify: message has no recipient")
+
+// SMTPNotifier emails messages through an SMTP server
+type SMTPNotifier struct {
+	Addr     string // host:port of the server
+	From     string
+	Username string // Optional, for servers that need to log in
+	Password string
+	To       []string // Recipients of messages that do not name one, such as staff alerts
+}
+
+// Notify emails msg to msg.To, or to the default recipients
+func (n *SMTPNotifier) Notify(msg Message) error {
+	to := n.To
+	if msg.To != "" {
+		to = []string{msg.To}
+	}
+	if len(to) == 0 {
+		return ErrNoRecipient
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, err := net.SplitHostPort(n.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+
+	return smtp.SendMail(n.Addr, auth, n.From, to, n.compose(to, msg))
+}
+
+// compose builds the email for msg
+func (n *SMTPNotifier) compose(to []string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerSafe(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// headerSafe stops a value from starting new header lines
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
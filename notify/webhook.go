@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-website/database"
+	"auth-website/webhooks"
+)
+
+// publicClient is the client webhook notifications are posted with when
+// none is configured. Users choose the URLs, so it refuses internal addresses.
+var publicClient = webhooks.PublicClient(10 * time.Second)
+
+// WebhookNotifier posts messages as JSON to the URL a user registered, signed
+// with the user's webhook secret the same way integration webhooks are
+type WebhookNotifier struct {
+	DB     *database.DB
+	Client *http.Client
+}
+
+// webhookPayload is the JSON body posted for a message
+type webhookPayload struct {
+	Event   string    `json:"event,omitempty"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Link    string    `json:"link,omitempty"`
+	UserID  int       `json:"user_id,omitempty"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// Notify posts msg to msg.To. Any response other than 2xx is an error.
+func (n WebhookNotifier) Notify(msg Message) error {
+	if msg.To == "" {
+		return ErrNoRecipient
+	}
+
+	_, secret, err := n.DB.GetUserWebhook(msg.UserID)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Event:   msg.Event,
+		Subject: msg.Subject,
+		Body:    msg.Body,
+		Link:    msg.Link,
+		UserID:  msg.UserID,
+		SentAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	client := n.Client
+	if client == nil {
+		client = publicClient
+	}
+	_, err = webhooks.Post(client, msg.To, secret, msg.Event, "ntf_"+strconv.Itoa(msg.ID), msg.Attempt, body)
+	return err
+}
@@ -0,0 +1,115 @@
+package printing
+
+import "bytes"
+
+// ESC/POS command bytes
+const (
+	esc = 0x1B
+	gs  = 0x1D
+)
+
+// Text alignments
+const (
+	AlignLeft   = 0
+	AlignCenter = 1
+	AlignRight  = 2
+)
+
+// Builder accumulates an ESC/POS byte stream for a thermal printer
+type Builder struct {
+	buf bytes.Buffer
+}
+
+// NewBuilder returns a builder that starts by resetting the printer
+func NewBuilder() *Builder {
+	b := &Builder{}
+	b.buf.Write([]byte{esc, '@'})
+	return b
+}
+
+// Align sets the alignment of the lines that follow
+func (b *Builder) Align(align int) *Builder {
+	b.buf.Write([]byte{esc, 'a', byte(align)})
+	return b
+}
+
+// Bold turns emphasised text on or off
+func (b *Builder) Bold(on bool) *Builder {
+	b.buf.Write([]byte{esc, 'E', boolByte(on)})
+	return b
+}
+
+// Size sets the character width and height multipliers, from 1 to 8
+func (b *Builder) Size(width, height int) *Builder {
+	b.buf.Write([]byte{gs, '!', byte((clamp(width, 1, 8)-1)<<4 | (clamp(height, 1, 8) - 1))})
+	return b
+}
+
+// Text writes text as is. Characters outside printable ASCII are replaced
+// with '?' since printers' code pages differ.
+func (b *Builder) Text(s string) *Builder {
+	for _, r := range s {
+		if r == '\n' || (r >= 0x20 && r < 0x7F) {
+			b.buf.WriteRune(r)
+		} else {
+			b.buf.WriteByte('?')
+		}
+	}
+	return b
+}
+
+// Line writes text followed by a line feed
+func (b *Builder) Line(s string) *Builder {
+	return b.Text(s).Text("\n")
+}
+
+// Feed prints and feeds n lines
+func (b *Builder) Feed(n int) *Builder {
+	b.buf.Write([]byte{esc, 'd', byte(clamp(n, 0, 255))})
+	return b
+}
+
+// QR prints data as a QR code with modules of the given size in dots
+func (b *Builder) QR(data string, moduleSize int) *Builder {
+	// Select model 2
+	b.buf.Write([]byte{gs, '(', 'k', 4, 0, '1', 'A', '2', 0})
+	// Module size
+	b.buf.Write([]byte{gs, '(', 'k', 3, 0, '1', 'C', byte(clamp(moduleSize, 1, 16))})
+	// Error correction level M
+	b.buf.Write([]byte{gs, '(', 'k', 3, 0, '1', 'E', '1'})
+	// Store the data in the symbol storage area
+	n := len(data) + 3
+	b.buf.Write([]byte{gs, '(', 'k', byte(n % 256), byte(n / 256), '1', 'P', '0'})
+	b.buf.WriteString(data)
+	// Print the stored symbol
+	b.buf.Write([]byte{gs, '(', 'k', 3, 0, '1', 'Q', '0'})
+	return b
+}
+
+// Cut feeds the paper past the cutter and makes a partial cut
+func (b *Builder) Cut() *Builder {
+	b.buf.Write([]byte{gs, 'V', 'B', 0})
+	return b
+}
+
+// Bytes returns the stream built so far
+func (b *Builder) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func boolByte(on bool) byte {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
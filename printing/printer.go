@@ -0,0 +1,93 @@
+package printing
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrUnknownTarget is returned for printer targets that are not understood
+var ErrUnknownTarget = errors.New("printer target must start with tcp://, device: or file:")
+
+// Printer sends a rendered job to a printer
+type Printer interface {
+	Print(data []byte) error
+}
+
+// TCPPrinter prints to a network printer listening for raw jobs, usually on port 9100
+type TCPPrinter struct {
+	Addr    string
+	Timeout time.Duration
+}
+
+// Print connects to the printer and writes the job
+func (p TCPPrinter) Print(data []byte) error {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	conn, err := net.DialTimeout("tcp", p.Addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err = conn.Write(data)
+	return err
+}
+
+// DevicePrinter prints to a printer attached locally, e.g. /dev/usb/lp0
+type DevicePrinter struct {
+	Path string
+}
+
+// Print writes the job to the device file
+func (p DevicePrinter) Print(data []byte) error {
+	f, err := os.OpenFile(p.Path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// FilePrinter is a test mode printer that writes each job to a new file in Dir
+type FilePrinter struct {
+	Dir string
+}
+
+// Print writes the job to a timestamped .bin file
+func (p FilePrinter) Print(data []byte) error {
+	if err := os.MkdirAll(p.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("receipt-%s.bin", time.Now().Format("20060102-150405.000000000"))
+	return os.WriteFile(filepath.Join(p.Dir, name), data, 0644)
+}
+
+// ParseTarget returns the printer for a target such as "tcp://10.0.0.5:9100",
+// "device:/dev/usb/lp0" or "file:./receipts"
+func ParseTarget(target string) (Printer, error) {
+	switch {
+	case strings.HasPrefix(target, "tcp://"):
+		addr := strings.TrimPrefix(target, "tcp://")
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "9100")
+		}
+		return TCPPrinter{Addr: addr}, nil
+	case strings.HasPrefix(target, "device:"):
+		return DevicePrinter{Path: strings.TrimPrefix(target, "device:")}, nil
+	case strings.HasPrefix(target, "file:"):
+		return FilePrinter{Dir: strings.TrimPrefix(target, "file:")}, nil
+	}
+	return nil, ErrUnknownTarget
+}
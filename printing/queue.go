@@ -0,0 +1,105 @@
+package printing
+
+import (
+	"log"
+	"time"
+
+	"auth-website/database"
+	"auth-website/models"
+	"auth-website/worker"
+)
+
+// Queue prints receipts in the background, retrying jobs the printer did not take
+type Queue struct {
+	DB          *database.DB
+	Printer     Printer
+	Interval    time.Duration // How often to look for jobs due a retry
+	MaxAttempts int           // Jobs are marked failed after this many attempts
+	Width       int           // Characters per line
+
+	wake chan struct{}
+}
+
+// NewQueue returns a queue that sends jobs to printer
+func NewQueue(db *database.DB, printer Printer) *Queue {
+	return &Queue{
+		DB:          db,
+		Printer:     printer,
+		Interval:    30 * time.Second,
+		MaxAttempts: 5,
+		Width:       DefaultWidth,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// EnqueueOrder renders the receipt for an order and queues it to be printed
+func (q *Queue) EnqueueOrder(orderID int) (int, error) {
+	order, err := q.DB.GetOrderByID(orderID)
+	if err != nil {
+		return 0, err
+	}
+	token, err := q.DB.GetOrderToken(order)
+	if err != nil {
+		return 0, err
+	}
+	taxRate, err := q.DB.GetTaxRate()
+	if err != nil {
+		return 0, err
+	}
+	header, err := q.DB.GetSetting(models.SettingReceiptHeader, models.DefaultReceiptHeader)
+	if err != nil {
+		return 0, err
+	}
+	pickupCode, err := q.DB.GetPickupCode(orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	receipt := Receipt{Order: *order, Token: token, TaxRate: taxRate, ShopName: header, PickupCode: pickupCode}
+	data := RenderReceipt(receipt, q.Width)
+	id, err := q.DB.EnqueuePrintJob(orderID, data)
+	if err != nil {
+		return 0, err
+	}
+
+	q.Wake()
+	return id, nil
+}
+
+// Wake makes the queue look for due jobs straight away
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run prints due jobs every Interval, or when woken, until stop is closed
+func (q *Queue) Run(stop <-chan struct{}) {
+	worker.Loop("Print queue", q.Interval, q.wake, stop, q.Process)
+}
+
+// Process sends every due job to the printer. Failed jobs are retried with
+// exponential backoff until MaxAttempts is reached.
+func (q *Queue) Process() error {
+	jobs, err := q.DB.GetDuePrintJobs(time.Now(), 20)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if err := q.Printer.Print(job.Data); err != nil {
+			attempts := job.Attempts + 1
+			giveUp := attempts >= q.MaxAttempts
+			log.Printf("Failed to print receipt for order %d (attempt %d): %v", job.OrderID, attempts, err)
+			if err := q.DB.MarkPrintJobFailed(job.ID, err.Error(), time.Now().Add(worker.Backoff(q.Interval, attempts)), giveUp); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := q.DB.MarkPrintJobPrinted(job.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
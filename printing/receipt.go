@@ -0,0 +1,115 @@
+package printing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"auth-website/models"
+)
+
+// DefaultWidth is the number of characters on a line of 80mm paper in the default font
+const DefaultWidth = 42
+
+// Receipt is everything printed on a customer's receipt
+type Receipt struct {
+	Order    models.Order
+	Token    int     // Number called out when the order is ready
+	TaxRate  float64 // Percent of tax included in the prices
+	ShopName string
+	// PickupCode is the signed code printed as a QR code for the pickup
+	// counter to scan. The order ID is printed instead when it is empty.
+	PickupCode string
+}
+
+// Tax returns the tax included in the order total
+func (r Receipt) Tax() float64 {
+	if r.TaxRate <= 0 {
+		return 0
+	}
+	return r.Order.TotalPrice * r.TaxRate / (100 + r.TaxRate)
+}
+
+// Subtotal returns the order total before tax
+func (r Receipt) Subtotal() float64 {
+	return r.Order.TotalPrice - r.Tax()
+}
+
+// RenderReceipt formats a receipt as ESC/POS bytes for lines of width characters
+func RenderReceipt(r Receipt, width int) []byte {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	order := r.Order
+	rule := strings.Repeat("-", width)
+
+	b := NewBuilder()
+
+	// Header with the token in large print
+	b.Align(AlignCenter).Bold(true).Line(r.ShopName).Bold(false)
+	b.Line(order.CreatedAt.Local().Format("Jan 2, 2006 15:04"))
+	if r.Token > 0 {
+		b.Feed(1).Line("TOKEN").Size(3, 3).Bold(true).Line(strconv.Itoa(r.Token)).Bold(false).Size(1, 1)
+	}
+	b.Feed(1).Line(fmt.Sprintf("Order #%d", order.ID))
+	if order.CashierName != "" {
+		b.Line("Served by " + order.CashierName)
+	}
+	if order.PickupSlotLabel != "" {
+		b.Line("Pickup " + order.PickupSlotLabel)
+	}
+
+	// Items
+	b.Align(AlignLeft).Line(rule)
+	for _, item := range order.Items {
+		b.Line(columns(fmt.Sprintf("%dx %s", item.Quantity, item.ProductName), money(item.ItemTotal), width))
+		if label := item.OptionsLabel(); label != "" {
+			b.Line("   " + truncate(label, width-3))
+		}
+	}
+	b.Line(rule)
+
+	// Totals
+	if tax := r.Tax(); tax > 0 {
+		b.Line(columns("Subtotal", money(r.Subtotal()), width))
+		b.Line(columns(fmt.Sprintf("Tax %s%%", strconv.FormatFloat(r.TaxRate, 'f', -1, 64)), money(tax), width))
+	}
+	b.Bold(true).Line(columns("TOTAL", money(order.TotalPrice), width)).Bold(false)
+	b.Line("Paid by " + order.PaymentMethod)
+	if order.Tendered > 0 {
+		b.Line(columns("Tendered", money(order.Tendered), width))
+		b.Line(columns("Change", money(order.Change()), width))
+	}
+
+	// QR code for the pickup counter to scan
+	qr := r.PickupCode
+	if qr == "" {
+		qr = strconv.Itoa(order.ID)
+	}
+	b.Feed(1).Align(AlignCenter).QR(qr, 6).Feed(1)
+	b.Line("Thank you!").Feed(3).Cut()
+
+	return b.Bytes()
+}
+
+// columns puts left and right at either end of a line of width characters
+func columns(left, right string, width int) string {
+	space := width - len(right) - 1
+	left = truncate(left, space)
+	return left + strings.Repeat(" ", width-len(left)-len(right)) + right
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+func money(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
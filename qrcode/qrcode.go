@@ -0,0 +1,468 @@
+// Package qrcode encodes short text as QR code symbols. It supports byte mode
+// at error correction level M in versions 1 to 9, which holds up to 180 bytes:
+// plenty for the order codes the canteen prints and shows.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrTooLong is returned for text that does not fit in a version 9 symbol
+var ErrTooLong = errors.New("qrcode: text too long")
+
+// version describes the codeword layout of a QR version at level M
+type version struct {
+	ecPerBlock int
+	blocks     []int // Data codewords of each block
+	alignment  []int // Row and column centres of the alignment patterns
+	remainder  int   // Bits left over after the last codeword
+}
+
+// versions lists versions 1 to 9 at error correction level M
+var versions = []version{
+	{10, []int{16}, nil, 0},
+	{16, []int{28}, []int{6, 18}, 7},
+	{26, []int{44}, []int{6, 22}, 7},
+	{18, []int{32, 32}, []int{6, 26}, 7},
+	{24, []int{43, 43}, []int{6, 30}, 7},
+	{16, []int{27, 27, 27, 27}, []int{6, 34}, 7},
+	{18, []int{31, 31, 31, 31}, []int{6, 22, 38}, 0},
+	{22, []int{38, 38, 39, 39}, []int{6, 24, 42}, 0},
+	{22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}, 0},
+}
+
+// dataCapacity returns the number of data codewords in a version
+func (v version) dataCapacity() int {
+	total := 0
+	for _, n := range v.blocks {
+		total += n
+	}
+	return total
+}
+
+// Code is an encoded QR symbol
+type Code struct {
+	Size     int // Modules along each side
+	modules  [][]bool
+	function [][]bool // Finder, timing, alignment and format modules
+}
+
+// Dark reports whether the module at column x and row y is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode returns the smallest symbol holding text
+func Encode(text string) (*Code, error) {
+	c, err := encodeUnmasked(text)
+	if err != nil {
+		return nil, err
+	}
+	c.applyBestMask()
+	return c, nil
+}
+
+// encodeUnmasked returns the smallest symbol holding text with no mask applied
+func encodeUnmasked(text string) (*Code, error) {
+	data := []byte(text)
+
+	for i, v := range versions {
+		// Mode, 8-bit character count and the data itself
+		if 4+8+len(data)*8 > v.dataCapacity()*8 {
+			continue
+		}
+		c := newCode(i + 1)
+		c.drawFunctionPatterns(i+1, v)
+		c.drawCodewords(v.interleave(v.encodeData(data)))
+		return c, nil
+	}
+	return nil, ErrTooLong
+}
+
+func newCode(ver int) *Code {
+	size := ver*4 + 17
+	c := &Code{Size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for y := range c.modules {
+		c.modules[y] = make([]bool, size)
+		c.function[y] = make([]bool, size)
+	}
+	return c
+}
+
+// setFunction sets a function module, which data and masks leave alone
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+// drawFunctionPatterns draws everything but the data, reserving the format areas
+func (c *Code) drawFunctionPatterns(ver int, v version) {
+	// Timing patterns
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	// Alignment patterns, except where they would overlap the finders
+	last := len(v.alignment) - 1
+	for i, y := range v.alignment {
+		for j, x := range v.alignment {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas until the mask is chosen
+	c.drawFormat(0)
+	c.drawVersion(ver)
+}
+
+// drawFinder draws a finder pattern centred on x, y
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment draws an alignment pattern centred on x, y
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// formatBits returns the 15 bits of format information for a mask at level M
+func formatBits(mask int) int {
+	// Level M is 00 followed by the mask, protected by a BCH(15,5) code
+	data := mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// drawFormat draws both copies of the format information for a mask at level M
+func (c *Code) drawFormat(mask int) {
+	bits := formatBits(mask)
+
+	// Around the top left finder
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	// Split between the other two finders
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true) // Always dark
+}
+
+// drawVersion draws both copies of the version information from version 7 up
+func (c *Code) drawVersion(ver int) {
+	if ver < 7 {
+		return
+	}
+
+	bits := versionBits(ver)
+
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// versionBits returns the 18 bits of version information, the version
+// protected by a BCH(18,6) code
+func versionBits(ver int) int {
+	rem := ver
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return ver<<12 | rem
+}
+
+// encodeData returns the padded data codewords holding data in byte mode
+func (v version) encodeData(data []byte) []byte {
+	capacity := v.dataCapacity() * 8
+	var bb bitBuffer
+	bb.append(0x4, 4)
+	bb.append(len(data), 8)
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+
+	// Terminator, then up to a whole codeword
+	bb.append(0, min(4, capacity-len(bb)))
+	bb.append(0, (8-len(bb)%8)%8)
+
+	// Fill up with alternating pad codewords
+	for pad := 0xEC; len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	return bb.bytes()
+}
+
+// interleave splits data into blocks, adds their error correction codewords
+// and interleaves the lot into the final codeword sequence
+func (v version) interleave(data []byte) []byte {
+	divisor := rsDivisor(v.ecPerBlock)
+
+	var dataBlocks, ecBlocks [][]byte
+	for _, n := range v.blocks {
+		block := data[:n]
+		data = data[n:]
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+	}
+
+	var result []byte
+	longest := v.blocks[len(v.blocks)-1]
+	for i := 0; i < longest; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// drawCodewords places the codewords in the zigzag of two-module columns from
+// the bottom right. Remainder bits are left light.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				c.modules[y][x] = bit(int(codewords[i>>3]), 7-i&7)
+				i++
+			}
+		}
+	}
+}
+
+// masks are the eight data mask conditions; a module is flipped when true
+var masks = []func(x, y int) bool{
+	func(x, y int) bool { return (x+y)%2 == 0 },
+	func(x, y int) bool { return y%2 == 0 },
+	func(x, y int) bool { return x%3 == 0 },
+	func(x, y int) bool { return (x+y)%3 == 0 },
+	func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+	func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+	func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+	func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+}
+
+// applyMask flips the data modules selected by a mask. Applying it twice undoes it.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y][x] && masks[mask](x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask that gives the lowest penalty score
+func (c *Code) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := range masks {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormat(best)
+}
+
+// penalty scores how hard the symbol is to read: long runs, blocks, finder
+// look-alikes and an uneven balance of dark and light modules
+func (c *Code) penalty() int {
+	penalty := 0
+	dark := 0
+
+	for a := 0; a < c.Size; a++ {
+		rowRun, colRun := 1, 1
+		for b := 0; b < c.Size; b++ {
+			if c.modules[a][b] {
+				dark++
+			}
+			if b == 0 {
+				continue
+			}
+
+			// Runs of five or more in rows and columns
+			if c.modules[a][b] == c.modules[a][b-1] {
+				rowRun++
+				if rowRun == 5 {
+					penalty += 3
+				} else if rowRun > 5 {
+					penalty++
+				}
+			} else {
+				rowRun = 1
+			}
+			if c.modules[b][a] == c.modules[b-1][a] {
+				colRun++
+				if colRun == 5 {
+					penalty += 3
+				} else if colRun > 5 {
+					penalty++
+				}
+			} else {
+				colRun = 1
+			}
+
+			// 2x2 blocks of one colour
+			if a > 0 {
+				m := c.modules[a][b]
+				if m == c.modules[a][b-1] && m == c.modules[a-1][b] && m == c.modules[a-1][b-1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// Patterns that look like finders
+	finder := []bool{true, false, true, true, true, false, true}
+	for a := 0; a < c.Size; a++ {
+		for b := 0; b+7 <= c.Size; b++ {
+			row, col := true, true
+			for k, want := range finder {
+				row = row && c.modules[a][b+k] == want
+				col = col && c.modules[b+k][a] == want
+			}
+			if row && (c.lightRun(b-4, a, 4, true) || c.lightRun(b+7, a, 4, true)) {
+				penalty += 40
+			}
+			if col && (c.lightRun(a, b-4, 4, false) || c.lightRun(a, b+7, 4, false)) {
+				penalty += 40
+			}
+		}
+	}
+
+	// Balance of dark modules, in steps of 5% away from half
+	total := c.Size * c.Size
+	percent := dark * 100 / total
+	penalty += abs(percent-50) / 5 * 10
+
+	return penalty
+}
+
+// lightRun reports whether n modules from x, y along a row or column are all
+// light. Modules outside the symbol count as light.
+func (c *Code) lightRun(x, y, n int, horizontal bool) bool {
+	for i := 0; i < n; i++ {
+		xx, yy := x, y
+		if horizontal {
+			xx += i
+		} else {
+			yy += i
+		}
+		if xx >= 0 && xx < c.Size && yy >= 0 && yy < c.Size && c.modules[yy][xx] {
+			return false
+		}
+	}
+	return true
+}
+
+// SVG draws the symbol with modules of scale pixels and the standard four
+// module quiet zone
+func (c *Code) SVG(scale int) []byte {
+	const quiet = 4
+	full := (c.Size + 2*quiet) * scale
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		full, full, c.Size+2*quiet, c.Size+2*quiet)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="`)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+quiet, y+quiet)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
+
+// bitBuffer is a sequence of bits, most significant first
+type bitBuffer []bool
+
+func (bb *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, bit(value, i))
+	}
+}
+
+func (bb bitBuffer) bytes() []byte {
+	result := make([]byte, (len(bb)+7)/8)
+	for i, b := range bb {
+		if b {
+			result[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+	return result
+}
+
+func bit(value, i int) bool {
+	return (value>>i)&1 != 0
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
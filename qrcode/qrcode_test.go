@@ -0,0 +1,187 @@
+package qrcode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// rows draws a symbol as one line of # and . per row
+func rows(c *Code) string {
+	var lines []string
+	for y := 0; y < c.Size; y++ {
+		var line strings.Builder
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				line.WriteByte('#')
+			} else {
+				line.WriteByte('.')
+			}
+		}
+		lines = append(lines, line.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// masked encodes text with the given mask instead of the best one
+func masked(t *testing.T, text string, mask int) *Code {
+	t.Helper()
+
+	c, err := encodeUnmasked(text)
+	if err != nil {
+		t.Fatalf("encodeUnmasked(%q): %v", text, err)
+	}
+	c.applyMask(mask)
+	c.drawFormat(mask)
+	return c
+}
+
+func TestFormatBits(t *testing.T) {
+	// Level M entries of the format information table in ISO/IEC 18004
+	want := []int{0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0}
+	for mask, bits := range want {
+		if got := formatBits(mask); got != bits {
+			t.Errorf("mask %d: got %015b, want %015b", mask, got, bits)
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	want := map[int]int{7: 0x07C94, 8: 0x085BC, 9: 0x09A99}
+	for ver, bits := range want {
+		if got := versionBits(ver); got != bits {
+			t.Errorf("version %d: got %018b, want %018b", ver, got, bits)
+		}
+	}
+}
+
+func TestEncodeSmallSymbol(t *testing.T) {
+	// Drawn by a reference encoder for version 1-M with mask 0
+	want := strings.Join([]string{
+		"#######.......#######",
+		"#.....#.##.##.#.....#",
+		"#.###.#....#..#.###.#",
+		"#.###.#...#...#.###.#",
+		"#.###.#.###.#.#.###.#",
+		"#.....#..##.#.#.....#",
+		"#######.#.#.#.#######",
+		"...........##........",
+		"#.#.#.#...##....#..#.",
+		"##..##.##.....##.#...",
+		"##.#..#..##.#...#..##",
+		"##.#.#...##...#.....#",
+		"#..#..#.#...#.#.#.##.",
+		"........#..#.#..#..#.",
+		"#######..#.#.##.#.###",
+		"#.....#..#####......#",
+		"#.###.#.#..#.###..###",
+		"#.###.#.......###..#.",
+		"#.###.#.###.#...###.#",
+		"#.....#..#....###..#.",
+		"#######.#.#.#.#.#####",
+	}, "\n")
+
+	if got := rows(masked(t, "ORDER-1", 0)); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEncodeMatchesReference(t *testing.T) {
+	// SHA-256 of the rows a reference encoder draws for each mask, covering
+	// a single block, a pickup code, several blocks of one size, blocks of
+	// two sizes with version information, and the largest symbol supported
+	tests := []struct {
+		text  string
+		size  int
+		masks [8]string
+	}{
+		{"ORDER-1", 21, [8]string{
+			"321b9d86a23ca7c4fcca607dab2aa04b168b61add2a8873a4dd2fc08635a68ea",
+			"66ac0a8317c40238a671a5d6da90bd444b5d4d1fccaff1ca91f0a5aa0cfe9539",
+			"20bce5f430f52a26bb4208aea9578d04b9bc1e2eadd3f984a1e7834df095abb7",
+			"512302d552902b36d2a80064096f45d2c85bf1e6d9624414ad30feae42a4a2af",
+			"b8de3566f2b6d0d42da34c98db881634cd8c6f69e20e62920b3ee85471b17bc7",
+			"feaeef1d74a3871e8cf89eadad8bbeb9d41736e00d1cd7dfee5d9b6a9d955bf1",
+			"ebc92c739346623646e007c0a23c1f10758b1a75fb64a3109ab48f7ec1b772ea",
+			"e3f541d043261f2af78816a2e2c5e5cd71f2864d5633cf257226448b6c57d78e",
+		}},
+		{"ORDER-1234-ABCDEFGH-ABCDEFGHIJKLMNOP", 29, [8]string{
+			"8c32561fed794b5d3be725b8f650493de5850cbc5074a6d82199cd3d6c05bab1",
+			"a3e20025eca0f0dc5c72989132c5abba57a0b01baef3809cf9eac284b7e1c599",
+			"6204ec9864245b0cd87a5eb450104751bb242c5ec22190ef5fa6e5260fd6e3b5",
+			"abfa6e6740dc1e16e600f8a39a0abf45e2ad155e0a7b858a88247f047c313465",
+			"78ea87a82c1c6e3b54e2f04c04c2de6d46190ad3c71adfcddc2fc1026cccec0e",
+			"a20c3ad2302e59fb84b244f3d77b59981ac04ae1e4ebf936f11fc0960b214f16",
+			"68b48d7a4bebb75404a2aaefb41c91ea0a80bc5c963f801ea5a95b9c6e2a777d",
+			"8ef45e24fcbbb2d9e7d9c66b237798d95b4fa16c68d27acd7dee790d3d198c8c",
+		}},
+		{strings.Repeat("abcdefghij", 10), 41, [8]string{
+			"921ad202f8959feeb83ee79b0bbc49ddc404042597b7cf806a2820d259c02641",
+			"a978b03560c05d47613ba4a2e5643ffdfc6383db4a3a0d9c8b79afe5d0478d6d",
+			"ea4c763727fbb446bc42d1056c96c6f07e22f508337d5ad4f739c2000aaec20d",
+			"935a7c6140160b4a64f797f157975c9213fbe28cae40d7b9daace8837cd72b79",
+			"dc969c1696dbd89654a5be6a711d48b4ad7d9e084b16227d47a8e3bb2e12f1ab",
+			"1737c20dd71dc19b0a91823b5f6ba9018eca8c9afc0fb79b7d66f521d222888f",
+			"bf59e6d27adb3e87096a2608d4f908365df9cc5ce6a198a559a6c13f877348d9",
+			"9273549289ba5a79f8516364cb1a5a63e2abe8288b7176b7cf882237e34fd87a",
+		}},
+		{strings.Repeat("0123456789", 14), 49, [8]string{
+			"17e6d38f510f4cb39259b3064e44da823c1707137a983399a5f6b3efceeceb47",
+			"de743330b60553b533b4ec3926ffd6e5437d1e407b71bc55cd32ff752c4a1de2",
+			"d784ff15ab22f0fbb4ff0569e0d3fb74aae08fc464d01ab095767c9ee26184a2",
+			"00058206a6bdbb46ec9d7e5e7785b163f2eb33794d17ac2685353bc114981238",
+			"f0e167343d97892d9113188ed6ad7265a517bcaf8111f7fd09bfe5d1de12bd31",
+			"a3e8a3cdd3f9cd77bd1ee212f6f754e2b658721b3c1ea5cb249d19c68a896590",
+			"d0eae69f3124164f1fe3a8e89a4a4eabb4e3408991cfd6225a9d701d7845c1ff",
+			"0b72fbc42f72ddc148ae5338120ba45407d731f99dca08913658abf0b6f7cf38",
+		}},
+		{strings.Repeat("ORDER-42-", 20), 53, [8]string{
+			"07f43bf10fc9707fe06408fe425793a771d2dfa04ecf1d4f871be641a4144f6f",
+			"b6f729a343ddf2306dd86fc7e7fcea269275389d8d0e7ea2ad4e55484f090641",
+			"42b2a03e1d7b36914952b8a9ac511f9c37eecdc194cac1a84857ef5e5b6a7c8b",
+			"98666499375af2af48231486b15210d022f81da605fed216d402534644d47197",
+			"7498ad93ce5b87ed5e771550a261f73a088c4729ac75439fc3f192abce2e57ef",
+			"36ca28e70a449d6040497ebf662ade4558c9c16e49928aebe1203298d9641ed5",
+			"c453800f5fdb4fc4fb95ea10b922112c09feef19f3a98438816956246036ee98",
+			"fbd816fa0fb2621a0045f8d7a3692b4533204696cb9f538983657f2e794a3b1f",
+		}},
+	}
+
+	hash := func(c *Code) string {
+		sum := sha256.Sum256([]byte(rows(c)))
+		return hex.EncodeToString(sum[:])
+	}
+
+	for _, tt := range tests {
+		for mask, want := range tt.masks {
+			c := masked(t, tt.text, mask)
+			if c.Size != tt.size {
+				t.Fatalf("%d bytes: got size %d, want %d", len(tt.text), c.Size, tt.size)
+			}
+			if got := hash(c); got != want {
+				t.Errorf("%d bytes with mask %d: symbol differs from the reference", len(tt.text), mask)
+			}
+		}
+
+		// Whichever mask Encode picks, the symbol must be one of those
+		c, err := Encode(tt.text)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		got, found := hash(c), false
+		for _, want := range tt.masks {
+			found = found || got == want
+		}
+		if !found {
+			t.Errorf("%d bytes: Encode drew a symbol matching none of the masks", len(tt.text))
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(strings.Repeat("x", 181)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("got error %v, want %v", err, ErrTooLong)
+	}
+}
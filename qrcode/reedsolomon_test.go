@@ -0,0 +1,63 @@
+package qrcode
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testBlock returns n data codewords that are the same in every run
+func testBlock(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*37 + 11)
+	}
+	return data
+}
+
+func TestRSRemainder(t *testing.T) {
+	// Expected remainders come from a reference encoder. The first is the
+	// "HELLO WORLD" 1-M example worked through in most QR tutorials.
+	tests := []struct {
+		name string
+		data []byte
+		ec   int
+		want []byte
+	}{
+		{
+			"HELLO WORLD 1-M",
+			[]byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			10,
+			[]byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+		{
+			"version 2",
+			testBlock(28),
+			16,
+			[]byte{252, 224, 124, 238, 54, 241, 151, 44, 249, 226, 229, 208, 128, 39, 204, 155},
+		},
+		{
+			"version 3",
+			testBlock(44),
+			26,
+			[]byte{5, 219, 57, 240, 19, 102, 152, 8, 151, 218, 11, 249, 38, 254, 223, 247, 96, 29, 56, 196, 25, 57, 234, 141, 248, 255},
+		},
+		{
+			"version 5",
+			testBlock(43),
+			24,
+			[]byte{25, 156, 207, 167, 24, 221, 209, 242, 238, 170, 245, 246, 147, 8, 125, 189, 133, 188, 59, 22, 33, 168, 32, 148},
+		},
+		{
+			"version 8",
+			testBlock(39),
+			22,
+			[]byte{179, 7, 196, 143, 168, 17, 148, 160, 102, 144, 226, 79, 14, 30, 205, 226, 102, 79, 194, 242, 207, 102},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := rsRemainder(tt.data, rsDivisor(tt.ec)); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
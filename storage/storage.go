@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotOwned is returned when asked to delete a file the storage did not create
+var ErrNotOwned = errors.New("file does not belong to this storage")
+
+// Storage keeps uploaded files and hands out the URLs they are served from
+type Storage interface {
+	// Save stores data under a new unique name with the given extension and returns its URL
+	Save(ext string, data []byte) (string, error)
+	// Delete removes the file served at url
+	Delete(url string) error
+	// Owns reports whether url points at a file kept by this storage
+	Owns(url string) bool
+}
+
+// LocalStorage keeps files in a directory on disk that is served under URLPrefix
+type LocalStorage struct {
+	Dir       string
+	URLPrefix string // e.g. "/uploads/"
+}
+
+// NewLocalStorage creates dir if needed and returns a storage serving it under urlPrefix
+func NewLocalStorage(dir, urlPrefix string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(urlPrefix, "/") {
+		urlPrefix += "/"
+	}
+	return &LocalStorage{Dir: dir, URLPrefix: urlPrefix}, nil
+}
+
+// Save writes data to a randomly named file in the storage directory
+func (s *LocalStorage) Save(ext string, data []byte) (string, error) {
+	name, err := randomName()
+	if err != nil {
+		return "", err
+	}
+	name += ext
+
+	if err := os.WriteFile(filepath.Join(s.Dir, name), data, 0644); err != nil {
+		return "", err
+	}
+	return s.URLPrefix + name, nil
+}
+
+// Delete removes the file behind url. Missing files are not an error.
+func (s *LocalStorage) Delete(url string) error {
+	if !s.Owns(url) {
+		return ErrNotOwned
+	}
+	err := os.Remove(filepath.Join(s.Dir, path.Base(url)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Owns reports whether url was handed out by this storage
+func (s *LocalStorage) Owns(url string) bool {
+	name := strings.TrimPrefix(url, s.URLPrefix)
+	return name != url && name != "" && !strings.ContainsAny(name, `/\`) && name != ".."
+}
+
+// randomName returns a random hex string suitable as a file name
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
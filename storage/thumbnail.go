@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	// Register the decoders for the accepted upload formats
+	_ "image/gif"
+	_ "image/png"
+)
+
+// MaxImagePixels caps the width x height of images Thumbnail decodes. A
+// small compressed file can claim huge dimensions, and decoding it would
+// allocate memory for every one of its pixels.
+const MaxImagePixels = 25_000_000
+
+// ErrImageTooLarge is returned for images with more than MaxImagePixels pixels
+var ErrImageTooLarge = errors.New("image dimensions are too large")
+
+// Thumbnail decodes an image and returns a JPEG scaled down to fit within
+// maxWidth x maxHeight. Images that already fit are re-encoded unscaled.
+// Images over MaxImagePixels are rejected with ErrImageTooLarge before
+// being decoded.
+func Thumbnail(data []byte, maxWidth, maxHeight int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+	if height > maxHeight {
+		width = width * maxHeight / height
+		height = maxHeight
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(src, width, height), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scale resizes src to width x height by averaging the source pixels that
+// fall into each destination pixel, which keeps downscaled photos smooth
+func scale(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			// JPEG has no alpha channel, so flatten transparent areas onto white.
+			// The averaged channels are alpha-premultiplied, which makes this an addition.
+			white := 0xffff - a/n
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r/n + white),
+				G: uint16(g/n + white),
+				B: uint16(b/n + white),
+				A: 0xffff,
+			})
+		}
+	}
+	return dst
+}
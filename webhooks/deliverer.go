@@ -0,0 +1,113 @@
+package webhooks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-website/database"
+	"auth-website/worker"
+)
+
+// Headers sent with every delivery besides the signature
+const (
+	EventHeader    = "X-Canteen-Event"
+	DeliveryHeader = "X-Canteen-Delivery" // The event ID, the same for every attempt and redelivery
+)
+
+// defaultClient posts deliveries when no client is given. Endpoint URLs are
+// typed in by people, so it refuses internal addresses as well as timing out.
+var defaultClient = PublicClient(10 * time.Second)
+
+// Deliverer posts the queued webhook deliveries to their endpoints, retrying
+// the ones that fail
+type Deliverer struct {
+	DB          *database.DB
+	Client      *http.Client
+	Interval    time.Duration // How often to look for deliveries to send
+	RetryDelay  time.Duration // Wait before the first retry, doubled for every further failure
+	MaxAttempts int           // Deliveries are marked failed after this many attempts
+}
+
+// NewDeliverer returns a deliverer with the default timings
+func NewDeliverer(db *database.DB) *Deliverer {
+	return &Deliverer{
+		DB:          db,
+		Client:      defaultClient,
+		Interval:    5 * time.Second,
+		RetryDelay:  30 * time.Second,
+		MaxAttempts: 8,
+	}
+}
+
+// Run sends due deliveries every Interval until stop is closed
+func (d *Deliverer) Run(stop <-chan struct{}) {
+	worker.Loop("Webhook delivery", d.Interval, nil, stop, d.Process)
+}
+
+// Process sends every due delivery. Failed deliveries are retried with
+// exponential backoff until MaxAttempts is reached.
+func (d *Deliverer) Process() error {
+	deliveries, err := d.DB.GetDueWebhookDeliveries(time.Now(), 50)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		code, err := d.send(delivery)
+		if err != nil {
+			attempts := delivery.Attempts + 1
+			log.Printf("Failed to deliver webhook %d to %s (attempt %d): %v", delivery.ID, delivery.EndpointURL, attempts, err)
+			retryAt := time.Now().Add(worker.Backoff(d.RetryDelay, attempts))
+			if err := d.DB.MarkWebhookFailed(delivery.ID, code, err.Error(), retryAt, attempts >= d.MaxAttempts); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.DB.MarkWebhookDelivered(delivery.ID, code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send posts a delivery and returns the response status code
+func (d *Deliverer) send(delivery database.DueWebhookDelivery) (int, error) {
+	return Post(d.Client, delivery.EndpointURL, delivery.Secret, delivery.Event, delivery.EventID, delivery.Attempts+1, []byte(delivery.Payload))
+}
+
+// Post sends a signed JSON body to url and returns the response status code,
+// 0 if the endpoint could not be reached. deliveryID should stay the same
+// across retries so receivers can drop duplicates; attempt counts them from
+// 1. Any response other than 2xx is an error.
+func Post(client *http.Client, url, secret, event, deliveryID string, attempt int, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Smart-Canteen-Webhooks/1.0")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set("X-Canteen-Attempt", strconv.Itoa(attempt))
+	req.Header.Set(SignatureHeader, Sign(secret, time.Now(), body))
+
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,75 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"auth-website/models"
+)
+
+// ErrInternalAddress is returned for webhook URLs that lead into the server's
+// own network, which users must not be able to make the server call
+var ErrInternalAddress = errors.New("webhook URL points to an internal address")
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not public either
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// internalIP reports whether ip is anything but a public unicast address:
+// loopback, private, link-local (which holds cloud metadata services),
+// unspecified or multicast
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || sharedAddressSpace.Contains(ip)
+}
+
+// CheckPublicURL checks that raw is an http or https URL whose host resolves
+// only to public addresses. It fails with models.ErrInvalidWebhookURL for
+// other URLs and with ErrInternalAddress for internal hosts.
+func CheckPublicURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return models.ErrInvalidWebhookURL
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if internalIP(addr.IP) {
+			return ErrInternalAddress
+		}
+	}
+	return nil
+}
+
+// PublicClient returns an HTTP client that refuses to connect to internal
+// addresses. The check runs on the address actually dialled, so it also
+// covers redirects and hosts that resolve differently after CheckPublicURL.
+func PublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+				return ErrInternalAddress
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialled instead of the host, hiding where requests go
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the signature of every delivery, in the form
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>" keyed by the endpoint secret>"
+const SignatureHeader = "X-Canteen-Signature"
+
+// Signature verification errors
+var (
+	ErrInvalidSignature = errors.New("webhook signature does not match")
+	ErrStaleSignature   = errors.New("webhook signature is too old")
+)
+
+// Sign returns the signature header value for a body sent at timestamp
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify checks a signature header against a received body, rejecting
+// signatures older than tolerance so captured deliveries cannot be replayed.
+// A zero tolerance accepts any age.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var t string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	expected := mac(secret, t, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+				return ErrStaleSignature
+			}
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// mac returns the HMAC-SHA256 of "<t>.<body>"
+func mac(secret, t string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(t))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"log"
+	"time"
+)
+
+// Loop calls process straight away and then every interval, or as soon as
+// wake receives, until stop is closed. A nil wake or stop never fires.
+// Errors are logged under name, since there is nobody to return them to.
+func Loop(name string, interval time.Duration, wake, stop <-chan struct{}, process func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := process(); err != nil {
+			log.Printf("%s failed: %v", name, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wake:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Backoff returns how long to wait before retrying after attempts failures:
+// base after the first, doubled for each further failure up to an hour
+func Backoff(base time.Duration, attempts int) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+	d := base
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+	return d
+}